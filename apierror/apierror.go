@@ -0,0 +1,137 @@
+// Package apierror defines the typed errors returned by HTTP handlers and
+// renders them as RFC 7807 problem details.
+package apierror
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// TypeBaseURI prefixes the slug of every problem type URI.
+var TypeBaseURI = "https://github.com/rsomcio/restapi/problems/"
+
+// FieldError describes a single failed validation rule on a request field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is an error that carries everything needed to build an HTTP
+// response. Cause is logged but never sent to the client.
+type Error struct {
+	Status int
+	Slug   string
+	Title  string
+	Detail string
+	Fields []FieldError
+	Cause  error
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %v", e.Detail, e.Cause)
+	}
+	return e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// Type returns the problem type URI for e.
+func (e *Error) Type() string {
+	return TypeBaseURI + e.Slug
+}
+
+// New builds an Error for an arbitrary status code, using the standard
+// status text as title.
+func New(status int, detail string) *Error {
+	return &Error{
+		Status: status,
+		Slug:   slugForStatus(status),
+		Title:  http.StatusText(status),
+		Detail: detail,
+	}
+}
+
+func BadRequest(detail string) *Error {
+	return New(http.StatusBadRequest, detail)
+}
+
+func Validation(fields []FieldError) *Error {
+	return &Error{
+		Status: http.StatusBadRequest,
+		Slug:   "validation-error",
+		Title:  "Validation Error",
+		Detail: "Validation failed",
+		Fields: fields,
+	}
+}
+
+func Unauthorized(detail string) *Error {
+	return New(http.StatusUnauthorized, detail)
+}
+
+func Forbidden(detail string) *Error {
+	return New(http.StatusForbidden, detail)
+}
+
+func NotFound(detail string) *Error {
+	return New(http.StatusNotFound, detail)
+}
+
+func Conflict(detail string) *Error {
+	return New(http.StatusConflict, detail)
+}
+
+func TooManyRequests(detail string) *Error {
+	return New(http.StatusTooManyRequests, detail)
+}
+
+func Internal(detail string, cause error) *Error {
+	e := New(http.StatusInternalServerError, detail)
+	e.Cause = cause
+	return e
+}
+
+func Unavailable(detail string, cause error) *Error {
+	e := New(http.StatusServiceUnavailable, detail)
+	e.Cause = cause
+	return e
+}
+
+func Timeout(detail string, cause error) *Error {
+	e := New(http.StatusGatewayTimeout, detail)
+	e.Cause = cause
+	return e
+}
+
+func slugForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "bad-request"
+	case http.StatusUnauthorized:
+		return "unauthorized"
+	case http.StatusForbidden:
+		return "forbidden"
+	case http.StatusNotFound:
+		return "not-found"
+	case http.StatusMethodNotAllowed:
+		return "method-not-allowed"
+	case http.StatusConflict:
+		return "conflict"
+	case http.StatusRequestEntityTooLarge:
+		return "payload-too-large"
+	case http.StatusTooManyRequests:
+		return "rate-limited"
+	case http.StatusServiceUnavailable:
+		return "service-unavailable"
+	case http.StatusGatewayTimeout:
+		return "timeout"
+	case http.StatusInternalServerError:
+		return "internal-error"
+	default:
+		return fmt.Sprintf("http-%d", status)
+	}
+}
@@ -0,0 +1,100 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTestApp(opts Options) *fiber.App {
+	app := fiber.New(fiber.Config{
+		ErrorHandler: Handler(opts),
+	})
+	app.Use(requestid.New())
+
+	app.Get("/not-found", func(c *fiber.Ctx) error {
+		return NotFound("Event not found")
+	})
+	app.Get("/validation", func(c *fiber.Ctx) error {
+		return Validation([]FieldError{{Field: "name", Code: "required", Message: "name is required"}})
+	})
+	app.Get("/internal", func(c *fiber.Ctx) error {
+		return Internal("Failed to fetch events", errors.New("connection refused"))
+	})
+	app.Get("/plain", func(c *fiber.Ctx) error {
+		return errors.New("boom")
+	})
+
+	return app
+}
+
+func TestProblemResponses(t *testing.T) {
+	app := setupTestApp(Options{})
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedType   string
+		expectedTitle  string
+		expectedDetail string
+	}{
+		{"typed not found", "/not-found", 404, TypeBaseURI + "not-found", "Not Found", "Event not found"},
+		{"validation", "/validation", 400, TypeBaseURI + "validation-error", "Validation Error", "Validation failed"},
+		{"internal hides cause", "/internal", 500, TypeBaseURI + "internal-error", "Internal Server Error", "Failed to fetch events"},
+		{"untyped error", "/plain", 500, TypeBaseURI + "internal-error", "Internal Server Error", "Internal server error"},
+		{"unknown route", "/missing", 404, TypeBaseURI + "not-found", "Not Found", "Cannot GET /missing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest("GET", tt.path, nil))
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+			assert.Equal(t, ProblemContentType, resp.Header.Get("Content-Type"))
+
+			var problem Problem
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&problem))
+			assert.Equal(t, tt.expectedType, problem.Type)
+			assert.Equal(t, tt.expectedTitle, problem.Title)
+			assert.Equal(t, tt.expectedStatus, problem.Status)
+			assert.Equal(t, tt.expectedDetail, problem.Detail)
+			assert.Equal(t, tt.path, problem.Instance)
+			assert.Equal(t, resp.Header.Get(fiber.HeaderXRequestID), problem.RequestID)
+			assert.NotEmpty(t, problem.RequestID)
+		})
+	}
+}
+
+func TestLegacyResponses(t *testing.T) {
+	app := setupTestApp(Options{Legacy: true})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/validation", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.Equal(t, fiber.MIMEApplicationJSON, resp.Header.Get("Content-Type"))
+
+	var body struct {
+		Error  string       `json:"error"`
+		Fields []FieldError `json:"fields"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "Validation failed", body.Error)
+	assert.Len(t, body.Fields, 1)
+}
+
+func TestFromPreservesWrappedErrors(t *testing.T) {
+	cause := errors.New("connection refused")
+	wrapped := errors.Join(errors.New("context"), Unavailable("Database unavailable", cause))
+
+	apiErr := From(wrapped)
+	assert.Equal(t, 503, apiErr.Status)
+	assert.ErrorIs(t, apiErr, cause)
+}
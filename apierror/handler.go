@@ -0,0 +1,80 @@
+package apierror
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rsomcio/restapi/logging"
+)
+
+// ProblemContentType is the media type of RFC 7807 responses.
+const ProblemContentType = "application/problem+json"
+
+// Problem is the RFC 7807 response body, extended with the request ID and
+// validation field errors.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Fields    []FieldError `json:"fields,omitempty"`
+}
+
+// Options configures the error handler.
+type Options struct {
+	// Legacy renders {"error": ..., "fields": ...} bodies instead of
+	// problem details, for clients that predate RFC 7807 support.
+	Legacy bool
+
+	// Logger receives server errors. Defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+// From converts any error into an *Error. Fiber errors keep their status
+// code; anything else becomes an opaque 500.
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return New(fiberErr.Code, fiberErr.Message)
+	}
+
+	return Internal("Internal server error", err)
+}
+
+// Handler returns a fiber.ErrorHandler that renders errors returned by
+// handlers and middleware.
+func Handler(opts Options) fiber.ErrorHandler {
+	return func(c *fiber.Ctx, err error) error {
+		apiErr := From(err)
+		if apiErr.Status >= fiber.StatusInternalServerError {
+			logging.Ctx(c, opts.Logger).Error("Request failed", "status", apiErr.Status, "error", apiErr)
+		}
+
+		c.Status(apiErr.Status)
+		if opts.Legacy {
+			body := fiber.Map{"error": apiErr.Detail}
+			if len(apiErr.Fields) > 0 {
+				body["fields"] = apiErr.Fields
+			}
+			return c.JSON(body)
+		}
+
+		return c.JSON(Problem{
+			Type:      apiErr.Type(),
+			Title:     apiErr.Title,
+			Status:    apiErr.Status,
+			Detail:    apiErr.Detail,
+			Instance:  c.OriginalURL(),
+			RequestID: c.GetRespHeader(fiber.HeaderXRequestID),
+			Fields:    apiErr.Fields,
+		}, ProblemContentType)
+	}
+}
@@ -0,0 +1,104 @@
+// Package apikey issues API keys, stores only their hashes, and checks the
+// keys that clients present.
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rsomcio/restapi/database"
+)
+
+// keyPrefix starts every key so that leaked keys are easy to recognise.
+const keyPrefix = "rk_"
+
+// ErrNotFound is returned for keys that do not exist or have been revoked.
+var ErrNotFound = errors.New("API key not found")
+
+// Key describes an issued key. The key itself is shown once, when created,
+// and only its hash and first characters are kept.
+type Key struct {
+	ID        string     `json:"id" db:"id"`
+	Name      string     `json:"name" db:"name"`
+	Prefix    string     `json:"prefix" db:"prefix"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at" db:"revoked_at"`
+}
+
+const keyColumns = "id, name, prefix, created_at, revoked_at"
+
+// generate returns a new random key.
+func generate() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	return keyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hash is what is stored for secret. Keys are random, so a fast hash is
+// enough to make a stolen table useless.
+func hash(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+// Create issues a key called name and returns its record and the key.
+func Create(ctx context.Context, name string) (Key, string, error) {
+	secret, err := generate()
+	if err != nil {
+		return Key{}, "", err
+	}
+
+	var key Key
+	query := "INSERT INTO api_keys (name, prefix, key_hash) VALUES ($1, $2, $3) RETURNING " + keyColumns
+	err = database.DB.GetContext(ctx, &key, query, name, secret[:len(keyPrefix)+6], hash(secret))
+	if err != nil {
+		return Key{}, "", fmt.Errorf("failed to create API key: %w", err)
+	}
+	return key, secret, nil
+}
+
+// Revoke stops the key with the given ID from being accepted.
+func Revoke(ctx context.Context, id string) (Key, error) {
+	var key Key
+	query := "UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND revoked_at IS NULL RETURNING " + keyColumns
+	err := database.DB.GetContext(ctx, &key, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Key{}, ErrNotFound
+	}
+	if err != nil {
+		return Key{}, fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	return key, nil
+}
+
+// List returns every key, revoked ones included, oldest first.
+func List(ctx context.Context) ([]Key, error) {
+	keys := []Key{}
+	query := "SELECT " + keyColumns + " FROM api_keys ORDER BY created_at, id"
+	if err := database.DB.SelectContext(ctx, &keys, query); err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// Lookup returns the unrevoked key matching secret.
+func Lookup(ctx context.Context, secret string) (Key, error) {
+	var key Key
+	query := "SELECT " + keyColumns + " FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL"
+	err := database.DB.GetContext(ctx, &key, query, hash(secret))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Key{}, ErrNotFound
+	}
+	if err != nil {
+		return Key{}, err
+	}
+	return key, nil
+}
@@ -0,0 +1,99 @@
+package apikey
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rsomcio/restapi/apierror"
+	"github.com/rsomcio/restapi/database"
+	"github.com/rsomcio/restapi/handlers"
+	"github.com/rsomcio/restapi/logging"
+)
+
+// maxCached bounds the cache, which otherwise grows with every invalid key
+// a client tries.
+const maxCached = 10000
+
+// Config configures Middleware.
+type Config struct {
+	// Lookup finds the key for a secret, returning ErrNotFound for unknown
+	// and revoked keys. It defaults to the package's Lookup.
+	Lookup func(ctx context.Context, secret string) (Key, error)
+	// CacheTTL is how long a lookup, successful or not, is reused, and so
+	// how long a revoked key may still be accepted. Zero disables caching.
+	CacheTTL time.Duration
+	// Logger reports failed lookups.
+	Logger *slog.Logger
+}
+
+type cached struct {
+	key     Key
+	found   bool
+	expires time.Time
+}
+
+// Middleware rejects requests without a valid key with 401 and records the
+// key's ID as the request's principal.
+func Middleware(cfg Config) fiber.Handler {
+	lookup := cfg.Lookup
+	if lookup == nil {
+		lookup = Lookup
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	var mu sync.Mutex
+	cache := make(map[[sha256.Size]byte]cached)
+
+	return func(c *fiber.Ctx) error {
+		secret := handlers.APIKey(c)
+		if secret == "" {
+			return apierror.Unauthorized("API key required")
+		}
+
+		id := sha256.Sum256([]byte(secret))
+		now := time.Now()
+		mu.Lock()
+		entry, ok := cache[id]
+		mu.Unlock()
+
+		if !ok || now.After(entry.expires) {
+			key, err := lookup(c.UserContext(), secret)
+			switch {
+			case errors.Is(err, ErrNotFound):
+				entry = cached{}
+			case err != nil:
+				logging.Ctx(c, logger).Error("API key lookup failed", "error", err)
+				if database.IsUnavailable(err) {
+					return apierror.Unavailable("Database unavailable", err)
+				}
+				return apierror.Internal("Failed to check API key", err)
+			default:
+				entry = cached{key: key, found: true}
+			}
+
+			if cfg.CacheTTL > 0 {
+				entry.expires = now.Add(cfg.CacheTTL)
+				mu.Lock()
+				if len(cache) >= maxCached {
+					clear(cache)
+				}
+				cache[id] = entry
+				mu.Unlock()
+			}
+		}
+
+		if !entry.found {
+			return apierror.Unauthorized("Invalid API key")
+		}
+		c.Locals(logging.PrincipalKey, entry.key.ID)
+		return c.Next()
+	}
+}
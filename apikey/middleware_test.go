@@ -0,0 +1,115 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rsomcio/restapi/apierror"
+	"github.com/rsomcio/restapi/handlers"
+	"github.com/rsomcio/restapi/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	a, err := generate()
+	require.NoError(t, err)
+	b, err := generate()
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(a, keyPrefix))
+	assert.Len(t, a, len(keyPrefix)+43)
+	assert.NotEqual(t, a, b)
+	assert.Equal(t, hash(a), hash(a))
+	assert.NotEqual(t, hash(a), hash(b))
+}
+
+func TestMiddleware(t *testing.T) {
+	lookups := 0
+	failing := false
+	lookup := func(ctx context.Context, secret string) (Key, error) {
+		lookups++
+		if failing {
+			return Key{}, errors.New("boom")
+		}
+		if secret == "rk_good" {
+			return Key{ID: "key-1", Name: "ci"}, nil
+		}
+		return Key{}, ErrNotFound
+	}
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.Handler(apierror.Options{})})
+	app.Use(Middleware(Config{Lookup: lookup, CacheTTL: time.Minute}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(c.Locals(logging.PrincipalKey).(string))
+	})
+
+	send := func(key string) (int, string) {
+		req := httptest.NewRequest("GET", "/", nil)
+		if key != "" {
+			req.Header.Set(handlers.APIKeyHeader, key)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := send("")
+	assert.Equal(t, 401, status)
+	assert.Contains(t, body, "API key required")
+	assert.Equal(t, 0, lookups)
+
+	status, body = send("rk_good")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "key-1", body, "the key's ID is the principal")
+
+	status, body = send("rk_bad")
+	assert.Equal(t, 401, status)
+	assert.Contains(t, body, "Invalid API key")
+
+	failing = true
+	status, _ = send("rk_good")
+	assert.Equal(t, 200, status, "lookups are cached")
+	status, _ = send("rk_bad")
+	assert.Equal(t, 401, status, "failed lookups are cached too")
+	assert.Equal(t, 2, lookups)
+
+	status, _ = send("rk_new")
+	assert.Equal(t, 500, status)
+}
+
+func TestMiddlewareWebSocketProtocol(t *testing.T) {
+	lookup := func(ctx context.Context, secret string) (Key, error) {
+		if secret == "rk_good" {
+			return Key{ID: "key-1"}, nil
+		}
+		return Key{}, ErrNotFound
+	}
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.Handler(apierror.Options{})})
+	app.Use(Middleware(Config{Lookup: lookup}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(c.Locals(logging.PrincipalKey).(string))
+	})
+
+	// Browsers cannot set headers on a WebSocket handshake, so they pass
+	// the key as a subprotocol.
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(fiber.HeaderSecWebSocketProtocol, "events.v1, "+handlers.APIKeyProtocolPrefix+"rk_good")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "key-1", string(body))
+
+	req.Header.Set(fiber.HeaderSecWebSocketProtocol, "events.v1")
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, 401, resp.StatusCode)
+}
@@ -0,0 +1,34 @@
+// Package cache stores rendered responses so that repeated reads do not
+// reach the database. Backends are an in-process LRU and any server that
+// speaks the Redis protocol.
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Backends accepted by the cache.backend setting.
+const (
+	BackendNone   = "none"
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+)
+
+// Cache is a byte-oriented key/value store with per-entry TTLs. Counters
+// created with Incr never expire; they are used as generation numbers so
+// that many entries can be invalidated at once.
+type Cache interface {
+	// Get returns the value for key and whether it was present.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value under key for ttl. A zero ttl never expires.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes key if present.
+	Delete(ctx context.Context, key string) error
+	// Add stores value under key for ttl only if key is absent, atomically,
+	// and reports whether it did.
+	Add(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	// Incr atomically increments the integer stored at key, treating a
+	// missing key as 0, and returns the new value.
+	Incr(ctx context.Context, key string) (int64, error)
+}
@@ -0,0 +1,317 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedis is a minimal in-process server speaking the subset of the Redis
+// protocol that Redis uses.
+type fakeRedis struct {
+	password string
+
+	mu      sync.Mutex
+	data    map[string]string
+	expires map[string]time.Time
+	conns   int
+}
+
+func newFakeRedis(t *testing.T, password string) (*fakeRedis, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	f := &fakeRedis{password: password, data: map[string]string{}, expires: map[string]time.Time{}}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.conns++
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+	return f, ln.Addr().String()
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := f.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(args[0])
+		if cmd == "AUTH" {
+			if len(args) == 2 && args[1] == f.password {
+				authed = true
+				io.WriteString(conn, "+OK\r\n")
+			} else {
+				io.WriteString(conn, "-WRONGPASS invalid password\r\n")
+			}
+			continue
+		}
+		if !authed {
+			io.WriteString(conn, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+		io.WriteString(conn, f.exec(cmd, args[1:]))
+	}
+}
+
+func (f *fakeRedis) exec(cmd string, args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(args) > 0 {
+		if exp, ok := f.expires[args[0]]; ok && !time.Now().Before(exp) {
+			delete(f.data, args[0])
+			delete(f.expires, args[0])
+		}
+	}
+
+	switch cmd {
+	case "SELECT":
+		return "+OK\r\n"
+	case "GET":
+		v, ok := f.data[args[0]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+	case "SET":
+		var expires time.Time
+		for i := 2; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "NX":
+				if _, ok := f.data[args[0]]; ok {
+					return "$-1\r\n"
+				}
+			case "PX":
+				i++
+				ms, _ := strconv.Atoi(args[i])
+				expires = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			}
+		}
+		f.data[args[0]] = args[1]
+		delete(f.expires, args[0])
+		if !expires.IsZero() {
+			f.expires[args[0]] = expires
+		}
+		return "+OK\r\n"
+	case "DEL":
+		_, ok := f.data[args[0]]
+		delete(f.data, args[0])
+		if ok {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	case "INCR":
+		var n int64
+		if v, ok := f.data[args[0]]; ok {
+			var err error
+			if n, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return "-ERR value is not an integer or out of range\r\n"
+			}
+		}
+		n++
+		f.data[args[0]] = strconv.FormatInt(n, 10)
+		return fmt.Sprintf(":%d\r\n", n)
+	}
+	return fmt.Sprintf("-ERR unknown command '%s'\r\n", cmd)
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func backends(t *testing.T) map[string]Cache {
+	_, addr := newFakeRedis(t, "hunter2")
+	redis := NewRedis(addr, "hunter2", 1, time.Second)
+	t.Cleanup(func() { redis.Close() })
+
+	return map[string]Cache{
+		"memory": NewMemory(100),
+		"redis":  redis,
+	}
+}
+
+func TestCacheBackends(t *testing.T) {
+	ctx := context.Background()
+
+	for name, c := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			_, ok, err := c.Get(ctx, "missing")
+			require.NoError(t, err)
+			assert.False(t, ok)
+
+			require.NoError(t, c.Set(ctx, "key", []byte("value\r\nwith newline"), 0))
+			value, ok, err := c.Get(ctx, "key")
+			require.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, "value\r\nwith newline", string(value))
+
+			require.NoError(t, c.Set(ctx, "empty", []byte{}, 0))
+			value, ok, err = c.Get(ctx, "empty")
+			require.NoError(t, err)
+			assert.True(t, ok)
+			assert.Empty(t, value)
+
+			require.NoError(t, c.Delete(ctx, "key"))
+			_, ok, err = c.Get(ctx, "key")
+			require.NoError(t, err)
+			assert.False(t, ok)
+
+			n, err := c.Incr(ctx, "generation")
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), n)
+			n, err = c.Incr(ctx, "generation")
+			require.NoError(t, err)
+			assert.Equal(t, int64(2), n)
+			value, ok, err = c.Get(ctx, "generation")
+			require.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, "2", string(value))
+
+			added, err := c.Add(ctx, "claim", []byte("first"), 20*time.Millisecond)
+			require.NoError(t, err)
+			assert.True(t, added)
+			added, err = c.Add(ctx, "claim", []byte("second"), 0)
+			require.NoError(t, err)
+			assert.False(t, added, "present keys are kept")
+			value, _, _ = c.Get(ctx, "claim")
+			assert.Equal(t, "first", string(value))
+
+			require.NoError(t, c.Set(ctx, "short", []byte("v"), 20*time.Millisecond))
+			time.Sleep(40 * time.Millisecond)
+			_, ok, err = c.Get(ctx, "short")
+			require.NoError(t, err)
+			assert.False(t, ok)
+
+			added, err = c.Add(ctx, "claim", []byte("second"), 0)
+			require.NoError(t, err)
+			assert.True(t, added, "expired keys are replaced")
+		})
+	}
+}
+
+func TestMemoryEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(2)
+
+	require.NoError(t, m.Set(ctx, "a", []byte("1"), 0))
+	require.NoError(t, m.Set(ctx, "b", []byte("2"), 0))
+	_, _, _ = m.Get(ctx, "a")
+	require.NoError(t, m.Set(ctx, "c", []byte("3"), 0))
+
+	_, ok, _ := m.Get(ctx, "b")
+	assert.False(t, ok, "b was least recently used")
+	_, ok, _ = m.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, 2, m.Len())
+
+	// Counters survive any amount of churn.
+	_, err := m.Incr(ctx, "generation")
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, m.Set(ctx, strconv.Itoa(i), []byte("x"), 0))
+	}
+	n, err := m.Incr(ctx, "generation")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+}
+
+func TestMemoryExpiresEntries(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	m := NewMemory(10)
+	m.now = func() time.Time { return now }
+
+	require.NoError(t, m.Set(ctx, "k", []byte("v"), time.Minute))
+	now = now.Add(59 * time.Second)
+	_, ok, _ := m.Get(ctx, "k")
+	assert.True(t, ok)
+
+	now = now.Add(time.Second)
+	_, ok, _ = m.Get(ctx, "k")
+	assert.False(t, ok)
+	assert.Equal(t, 0, m.Len())
+}
+
+func TestRedisReusesConnectionsAndReportsErrors(t *testing.T) {
+	ctx := context.Background()
+	fake, addr := newFakeRedis(t, "")
+	r := NewRedis(addr, "", 0, time.Second)
+	defer r.Close()
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, r.Set(ctx, "k", []byte("not a number"), 0))
+	}
+	fake.mu.Lock()
+	assert.Equal(t, 1, fake.conns)
+	fake.mu.Unlock()
+
+	_, err := r.Incr(ctx, "k")
+	var replyErr redisError
+	require.ErrorAs(t, err, &replyErr)
+
+	// An error reply leaves the connection usable.
+	_, ok, err := r.Get(ctx, "k")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	_, addr = newFakeRedis(t, "right")
+	_, _, err = NewRedis(addr, "wrong", 0, time.Second).Get(ctx, "k")
+	assert.ErrorContains(t, err, "WRONGPASS")
+}
+
+func TestRedisUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	r := NewRedis(addr, "", 0, 100*time.Millisecond)
+	_, _, err = r.Get(context.Background(), "k")
+	assert.Error(t, err)
+}
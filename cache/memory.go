@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Memory is an in-process LRU cache. Entries are evicted when they expire or
+// when more than maxEntries are stored. Counters are kept apart from the LRU
+// and are never evicted, so a generation number cannot fall back to a value
+// that older entries were stored under.
+type Memory struct {
+	mu         sync.Mutex
+	maxEntries int
+	ll         *list.List
+	items      map[string]*list.Element
+	counters   map[string]int64
+	now        func() time.Time
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewMemory returns an LRU holding at most maxEntries entries.
+func NewMemory(maxEntries int) *Memory {
+	return &Memory{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+		counters:   make(map[string]int64),
+		now:        time.Now,
+	}
+}
+
+func (m *Memory) Get(_ context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if n, ok := m.counters[key]; ok {
+		return []byte(strconv.FormatInt(n, 10)), true, nil
+	}
+
+	el, ok := m.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := el.Value.(*memoryEntry)
+	if !entry.expires.IsZero() && !m.now().Before(entry.expires) {
+		m.remove(el)
+		return nil, false, nil
+	}
+	m.ll.MoveToFront(el)
+	return entry.value, true, nil
+}
+
+func (m *Memory) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.counters, key)
+	m.set(key, value, ttl)
+	return nil
+}
+
+func (m *Memory) Add(_ context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.counters[key]; ok {
+		return false, nil
+	}
+	if el, ok := m.items[key]; ok {
+		entry := el.Value.(*memoryEntry)
+		if entry.expires.IsZero() || m.now().Before(entry.expires) {
+			return false, nil
+		}
+	}
+	m.set(key, value, ttl)
+	return true, nil
+}
+
+func (m *Memory) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.counters, key)
+	if el, ok := m.items[key]; ok {
+		m.remove(el)
+	}
+	return nil
+}
+
+func (m *Memory) Incr(_ context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := m.counters[key]
+	if el, ok := m.items[key]; ok {
+		var err error
+		if n, err = strconv.ParseInt(string(el.Value.(*memoryEntry).value), 10, 64); err != nil {
+			return 0, fmt.Errorf("cache: value of %q is not an integer", key)
+		}
+		m.remove(el)
+	}
+	n++
+	m.counters[key] = n
+	return n, nil
+}
+
+// Len returns the number of stored entries, excluding counters and
+// including expired entries that have not been evicted yet.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ll.Len()
+}
+
+func (m *Memory) set(key string, value []byte, ttl time.Duration) {
+	var expires time.Time
+	if ttl > 0 {
+		expires = m.now().Add(ttl)
+	}
+
+	if el, ok := m.items[key]; ok {
+		entry := el.Value.(*memoryEntry)
+		entry.value, entry.expires = value, expires
+		m.ll.MoveToFront(el)
+		return
+	}
+
+	m.items[key] = m.ll.PushFront(&memoryEntry{key: key, value: value, expires: expires})
+	for m.maxEntries > 0 && m.ll.Len() > m.maxEntries {
+		m.remove(m.ll.Back())
+	}
+}
+
+func (m *Memory) remove(el *list.Element) {
+	m.ll.Remove(el)
+	delete(m.items, el.Value.(*memoryEntry).key)
+}
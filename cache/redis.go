@@ -0,0 +1,223 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Redis is a Cache backed by a server speaking the Redis protocol (RESP),
+// such as Redis, Valkey or KeyDB. Only GET, SET, DEL and INCR are used, so
+// any compatible server works.
+type Redis struct {
+	addr     string
+	password string
+	db       int
+	timeout  time.Duration
+	idle     chan *redisConn
+}
+
+// redisIdleConns is the number of idle connections kept for reuse.
+const redisIdleConns = 16
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// redisError is an error reply sent by the server.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// NewRedis returns a client for the server at addr. Connections are opened
+// lazily and idle ones are kept for reuse. timeout bounds dialling and each
+// command when the caller's context has no deadline.
+func NewRedis(addr, password string, db int, timeout time.Duration) *Redis {
+	return &Redis{
+		addr:     addr,
+		password: password,
+		db:       db,
+		timeout:  timeout,
+		idle:     make(chan *redisConn, redisIdleConns),
+	}
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := r.do(ctx, "GET", key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("redis: unexpected GET reply %T", reply)
+	}
+	return value, true, nil
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := r.do(ctx, args...)
+	return err
+}
+
+func (r *Redis) Add(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	args := []string{"SET", key, string(value), "NX"}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	reply, err := r.do(ctx, args...)
+	return err == nil && reply != nil, err
+}
+
+func (r *Redis) Delete(ctx context.Context, key string) error {
+	_, err := r.do(ctx, "DEL", key)
+	return err
+}
+
+func (r *Redis) Incr(ctx context.Context, key string) (int64, error) {
+	reply, err := r.do(ctx, "INCR", key)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected INCR reply %T", reply)
+	}
+	return n, nil
+}
+
+// Close closes the idle connections.
+func (r *Redis) Close() error {
+	for {
+		select {
+		case conn := <-r.idle:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do sends one command and reads its reply. Connections are returned to the
+// pool only after a clean round trip, so a half-read reply is never seen by
+// the next caller.
+func (r *Redis) do(ctx context.Context, args ...string) (any, error) {
+	conn, err := r.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.roundTrip(r.deadline(ctx), args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		conn.Close()
+		return nil, err
+	}
+
+	select {
+	case r.idle <- conn:
+	default:
+		conn.Close()
+	}
+	return reply, err
+}
+
+func (r *Redis) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-r.idle:
+		return conn, nil
+	default:
+	}
+
+	dialer := net.Dialer{Deadline: r.deadline(ctx)}
+	nc, err := dialer.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	conn := &redisConn{Conn: nc, r: bufio.NewReader(nc)}
+
+	if r.password != "" {
+		if _, err := conn.roundTrip(r.deadline(ctx), "AUTH", r.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if r.db != 0 {
+		if _, err := conn.roundTrip(r.deadline(ctx), "SELECT", strconv.Itoa(r.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (r *Redis) deadline(ctx context.Context) time.Time {
+	if deadline, ok := ctx.Deadline(); ok {
+		return deadline
+	}
+	if r.timeout > 0 {
+		return time.Now().Add(r.timeout)
+	}
+	return time.Time{}
+}
+
+func (c *redisConn) roundTrip(deadline time.Time, args ...string) (any, error) {
+	if err := c.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	buf := fmt.Appendf(nil, "*%d\r\n", len(args))
+	for _, arg := range args {
+		buf = fmt.Appendf(buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.Write(buf); err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	return readReply(c.r)
+}
+
+// readReply decodes one RESP reply. Bulk strings are returned as []byte,
+// integers as int64, simple strings as string and nil bulk strings as nil.
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed bulk length %q", body)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("redis: %w", err)
+		}
+		return data[:n], nil
+	default:
+		return nil, fmt.Errorf("redis: unsupported reply type %q", kind)
+	}
+}
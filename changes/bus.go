@@ -0,0 +1,163 @@
+// Package changes fans changes to events out to the clients streaming them,
+// within one process.
+package changes
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+
+	"github.com/rsomcio/restapi/models"
+)
+
+var (
+	// ErrOverflow ends a subscription whose subscriber fell more than its
+	// buffer behind.
+	ErrOverflow = errors.New("changes: subscriber fell behind")
+	// ErrClosed ends the subscriptions of a closed bus.
+	ErrClosed = errors.New("changes: bus closed")
+)
+
+// Change is a change to an event as received by a bus.
+type Change struct {
+	// ID identifies the change, from which SubscribeAfter resumes. It is
+	// the Seq of the change's outbox message, so every instance gives a
+	// change the same ID.
+	ID    string
+	Type  string
+	Event models.Event
+}
+
+// Bus hands every change published to it to every subscription, and keeps
+// the latest changes for subscribers that reconnect.
+type Bus struct {
+	replaySize int
+
+	mu     sync.Mutex
+	replay []Change
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// NewBus returns a Bus that keeps the last replaySize changes.
+func NewBus(replaySize int) *Bus {
+	return &Bus{
+		replaySize: replaySize,
+		subs:       make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish hands a change of eventType to event, numbered seq in the outbox,
+// to the subscriptions. It never blocks: a subscription whose buffer is full
+// is ended with ErrOverflow.
+func (b *Bus) Publish(seq int64, eventType string, event models.Event) Change {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	change := Change{ID: strconv.FormatInt(seq, 10), Type: eventType, Event: event}
+	if b.replaySize > 0 {
+		if len(b.replay) == b.replaySize {
+			b.replay = b.replay[1:]
+		}
+		b.replay = append(b.replay, change)
+	}
+	if b.closed {
+		return change
+	}
+	for sub := range b.subs {
+		select {
+		case sub.c <- change:
+		default:
+			b.end(sub, ErrOverflow)
+		}
+	}
+	return change
+}
+
+// Subscribe returns a subscription to the changes published from now on,
+// holding up to buffer changes its subscriber has yet to receive.
+func (b *Bus) Subscribe(buffer int) *Subscription {
+	sub, _, _ := b.SubscribeAfter("", buffer)
+	return sub
+}
+
+// SubscribeAfter is Subscribe for a subscriber that last received the change
+// with the given ID, from this bus or from that of another instance. It also
+// returns the changes published to this bus after that one, which come
+// before those on the subscription. resumed is false when the change is no
+// longer kept, or not known yet; the subscriber has then missed changes. An
+// empty lastID resumes nothing.
+func (b *Bus) SubscribeAfter(lastID string, buffer int) (sub *Subscription, missed []Change, resumed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub = &Subscription{bus: b, c: make(chan Change, buffer)}
+	if b.closed {
+		sub.err = ErrClosed
+		close(sub.c)
+	} else {
+		b.subs[sub] = struct{}{}
+	}
+
+	if lastID == "" {
+		return sub, nil, true
+	}
+	// Instances publish changes in the order they commit, which they
+	// all see alike but for changes committing at the same moment, so
+	// the changes to replay are those after lastID here.
+	for i := len(b.replay) - 1; i >= 0; i-- {
+		if b.replay[i].ID == lastID {
+			return sub, append([]Change(nil), b.replay[i+1:]...), true
+		}
+	}
+	return sub, nil, false
+}
+
+// Close ends every subscription with ErrClosed, as when the server shuts
+// down. Later subscriptions end at once.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subs {
+		b.end(sub, ErrClosed)
+	}
+}
+
+// end removes sub, with b.mu held.
+func (b *Bus) end(sub *Subscription, err error) {
+	delete(b.subs, sub)
+	sub.err = err
+	close(sub.c)
+}
+
+// Subscription receives the changes published to a bus.
+type Subscription struct {
+	bus *Bus
+	c   chan Change
+	err error
+}
+
+// Changes returns the channel the changes arrive on. It is closed when the
+// subscription ends, after which Err tells why.
+func (s *Subscription) Changes() <-chan Change {
+	return s.c
+}
+
+// Err returns ErrOverflow or ErrClosed once the bus has ended the
+// subscription, and nil before then or when Close ended it.
+func (s *Subscription) Err() error {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	return s.err
+}
+
+// Close ends the subscription. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	if _, ok := s.bus.subs[s]; ok {
+		delete(s.bus.subs, s)
+		close(s.c)
+	}
+}
@@ -0,0 +1,110 @@
+package changes
+
+import (
+	"testing"
+
+	"github.com/rsomcio/restapi/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ids(changes []Change) []string {
+	var out []string
+	for _, c := range changes {
+		out = append(out, c.ID)
+	}
+	return out
+}
+
+func TestPublishFansOut(t *testing.T) {
+	b := NewBus(10)
+	first, second := b.Subscribe(4), b.Subscribe(4)
+
+	change := b.Publish(1, models.EventCreated, models.Event{ID: "e1"})
+	assert.Equal(t, change, <-first.Changes())
+	assert.Equal(t, change, <-second.Changes())
+
+	second.Close()
+	second.Close()
+	b.Publish(2, models.EventUpdated, models.Event{ID: "e1"})
+	assert.Equal(t, models.EventUpdated, (<-first.Changes()).Type)
+	_, open := <-second.Changes()
+	assert.False(t, open)
+	assert.NoError(t, second.Err())
+}
+
+func TestSlowSubscriberIsEnded(t *testing.T) {
+	b := NewBus(10)
+	slow, fast := b.Subscribe(1), b.Subscribe(4)
+
+	b.Publish(1, models.EventCreated, models.Event{ID: "e1"})
+	b.Publish(2, models.EventUpdated, models.Event{ID: "e1"})
+
+	assert.Equal(t, models.EventCreated, (<-slow.Changes()).Type)
+	_, open := <-slow.Changes()
+	assert.False(t, open, "a full buffer ends the subscription instead of blocking")
+	assert.ErrorIs(t, slow.Err(), ErrOverflow)
+	assert.Len(t, fast.Changes(), 2)
+}
+
+func TestSubscribeAfter(t *testing.T) {
+	b := NewBus(3)
+	var published []Change
+	for i := 0; i < 5; i++ {
+		published = append(published, b.Publish(int64(i+1), models.EventUpdated, models.Event{ID: "e1"}))
+	}
+
+	sub, missed, resumed := b.SubscribeAfter(published[2].ID, 4)
+	assert.True(t, resumed)
+	assert.Equal(t, ids(published[3:]), ids(missed))
+	next := b.Publish(6, models.EventDeleted, models.Event{ID: "e1"})
+	assert.Equal(t, next.ID, (<-sub.Changes()).ID, "changes after the replay arrive on the subscription")
+
+	_, missed, resumed = b.SubscribeAfter(next.ID, 4)
+	assert.True(t, resumed)
+	assert.Empty(t, missed)
+
+	// published[1] and the changes before it are no longer kept.
+	_, missed, resumed = b.SubscribeAfter(published[1].ID, 4)
+	assert.False(t, resumed)
+	assert.Empty(t, missed)
+
+	for _, id := range []string{"99", "nope"} {
+		_, _, resumed = b.SubscribeAfter(id, 4)
+		assert.False(t, resumed, id)
+	}
+}
+
+func TestSubscribeAfterOnAnotherBus(t *testing.T) {
+	// Every instance's bus is fed the same outbox messages.
+	first, second := NewBus(10), NewBus(10)
+	var last Change
+	for seq := int64(1); seq <= 3; seq++ {
+		last = first.Publish(seq, models.EventUpdated, models.Event{ID: "e1"})
+		second.Publish(seq, models.EventUpdated, models.Event{ID: "e1"})
+	}
+	second.Publish(4, models.EventDeleted, models.Event{ID: "e1"})
+
+	_, missed, resumed := second.SubscribeAfter(last.ID, 4)
+	assert.True(t, resumed, "a client of one instance resumes on another")
+	assert.Equal(t, []string{"4"}, ids(missed))
+}
+
+func TestClose(t *testing.T) {
+	b := NewBus(10)
+	sub := b.Subscribe(4)
+	b.Close()
+
+	_, open := <-sub.Changes()
+	assert.False(t, open)
+	assert.ErrorIs(t, sub.Err(), ErrClosed)
+
+	late := b.Subscribe(4)
+	_, open = <-late.Changes()
+	assert.False(t, open)
+	assert.ErrorIs(t, late.Err(), ErrClosed)
+	require.NotPanics(t, func() {
+		b.Publish(1, models.EventCreated, models.Event{ID: "e1"})
+		late.Close()
+	})
+}
@@ -0,0 +1,140 @@
+// Package cli implements the commands that manage events on a running server
+// through the client package.
+package cli
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/rsomcio/restapi/client"
+	"github.com/spf13/cobra"
+)
+
+// options are the flags shared by every events command.
+type options struct {
+	configFile string
+	profile    string
+	url        string
+	apiKey     string
+	output     string
+	timeout    time.Duration
+}
+
+// session is what a command needs once the options and profile are resolved.
+type session struct {
+	client  *client.Client
+	output  string
+	timeout time.Duration
+}
+
+// EventsCommand returns the `events` command tree.
+func EventsCommand() *cobra.Command {
+	var opts options
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "Manage events on a running server",
+		Long: `Manage events on a running server.
+
+The server and credentials come from a profile in the CLI config file
+(` + ConfigFileEnv + ` or ` + defaultConfigFile() + `), selected with --profile,
+` + ProfileEnv + ` or the file's default, and can be overridden with
+` + URLEnv + `, ` + APIKeyEnv + ` and the flags below.`,
+	}
+
+	flags := cmd.PersistentFlags()
+	flags.StringVar(&opts.configFile, "config", "", "CLI config file with profiles")
+	flags.StringVarP(&opts.profile, "profile", "p", "", "profile to use")
+	flags.StringVar(&opts.url, "url", "", "base URL of the server")
+	flags.StringVar(&opts.apiKey, "api-key", "", "API key to send")
+	flags.StringVarP(&opts.output, "output", "o", "", "output format: table, json or yaml")
+	flags.DurationVar(&opts.timeout, "timeout", 0, "give up on a command after this long, including retries")
+
+	cmd.AddCommand(
+		createCommand(&opts),
+		getCommand(&opts),
+		listCommand(&opts),
+		updateCommand(&opts),
+		deleteCommand(&opts),
+		importCommand(&opts),
+		exportCommand(&opts),
+	)
+	return cmd
+}
+
+// session resolves the settings of a command in increasing order of
+// precedence: defaults, the profile, environment variables and flags.
+func (o *options) session(cmd *cobra.Command) (*session, error) {
+	path, explicit := o.configFile, o.configFile != ""
+	if !explicit {
+		path, explicit = os.LookupEnv(ConfigFileEnv)
+	}
+	if !explicit {
+		path = defaultConfigFile()
+	}
+	name := o.profile
+	if name == "" {
+		name = os.Getenv(ProfileEnv)
+	}
+
+	p := Profile{URL: defaultURL, Output: FormatTable, Timeout: 30 * time.Second}
+	if path != "" {
+		loaded, err := loadProfile(path, name, explicit)
+		if err != nil {
+			return nil, err
+		}
+		if loaded.URL != "" {
+			p.URL = loaded.URL
+		}
+		if loaded.APIKey != "" {
+			p.APIKey = loaded.APIKey
+		}
+		if loaded.Output != "" {
+			p.Output = loaded.Output
+		}
+		if loaded.Timeout != 0 {
+			p.Timeout = loaded.Timeout
+		}
+	}
+
+	if v := os.Getenv(URLEnv); v != "" {
+		p.URL = v
+	}
+	if v := os.Getenv(APIKeyEnv); v != "" {
+		p.APIKey = v
+	}
+	flags := cmd.Flags()
+	if flags.Changed("url") {
+		p.URL = o.url
+	}
+	if flags.Changed("api-key") {
+		p.APIKey = o.apiKey
+	}
+	if flags.Changed("output") {
+		p.Output = o.output
+	}
+	if flags.Changed("timeout") {
+		p.Timeout = o.timeout
+	}
+
+	if err := checkFormat(p.Output); err != nil {
+		return nil, err
+	}
+	var clientOpts []client.Option
+	if p.APIKey != "" {
+		clientOpts = append(clientOpts, client.WithAPIKey(p.APIKey))
+	}
+	c, err := client.New(p.URL, clientOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return &session{client: c, output: p.Output, timeout: p.Timeout}, nil
+}
+
+// context bounds a command by the session timeout.
+func (s *session) context(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	if s.timeout <= 0 {
+		return cmd.Context(), func() {}
+	}
+	return context.WithTimeout(cmd.Context(), s.timeout)
+}
@@ -0,0 +1,276 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rsomcio/restapi/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAPI keeps events in memory and answers the event routes the way the
+// server does, including replaying writes with a repeated idempotency key.
+type fakeAPI struct {
+	mu       sync.Mutex
+	events   map[string]models.Event
+	nextID   int
+	replays  map[string][]byte
+	requests []string
+}
+
+func newFakeAPI(t *testing.T) (*fakeAPI, string) {
+	api := &fakeAPI{events: map[string]models.Event{}, replays: map[string][]byte{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/events", api.create)
+	mux.HandleFunc("GET /api/events", api.list)
+	mux.HandleFunc("GET /api/events/{id}", api.get)
+	mux.HandleFunc("PUT /api/events/{id}", api.update)
+	mux.HandleFunc("DELETE /api/events/{id}", api.delete)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api.mu.Lock()
+		defer api.mu.Unlock()
+		api.requests = append(api.requests, r.Method+" "+r.URL.RequestURI())
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return api, srv.URL
+}
+
+func (a *fakeAPI) create(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Idempotency-Key")
+	if body, ok := a.replays[key]; ok {
+		w.WriteHeader(201)
+		w.Write(body)
+		return
+	}
+	var req models.CreateEventRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	if req.VenueName == "" {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(400)
+		w.Write([]byte(`{"title":"Validation Error","status":400,"detail":"Validation failed","fields":[{"field":"venue_name","code":"required","message":"venue_name is required"}]}`))
+		return
+	}
+	a.nextID++
+	event := eventFrom(strconv.Itoa(a.nextID), models.UpdateEventRequest(req))
+	a.events[event.ID] = event
+	body, _ := json.Marshal(event)
+	if key != "" {
+		a.replays[key] = body
+	}
+	w.WriteHeader(201)
+	w.Write(body)
+}
+
+func (a *fakeAPI) list(w http.ResponseWriter, r *http.Request) {
+	events := make([]models.Event, 0, len(a.events))
+	for _, e := range a.events {
+		events = append(events, e)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	events = events[min(offset, len(events)):]
+	if limit, _ := strconv.Atoi(r.URL.Query().Get("limit")); limit > 0 {
+		events = events[:min(limit, len(events))]
+	}
+	json.NewEncoder(w).Encode(events)
+}
+
+func (a *fakeAPI) get(w http.ResponseWriter, r *http.Request) {
+	event, ok := a.events[r.PathValue("id")]
+	if !ok {
+		w.WriteHeader(404)
+		w.Write([]byte(`{"title":"Not Found","status":404,"detail":"Event not found"}`))
+		return
+	}
+	json.NewEncoder(w).Encode(event)
+}
+
+func (a *fakeAPI) update(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, ok := a.events[id]; !ok {
+		w.WriteHeader(404)
+		return
+	}
+	var req models.UpdateEventRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	a.events[id] = eventFrom(id, req)
+	json.NewEncoder(w).Encode(a.events[id])
+}
+
+func (a *fakeAPI) delete(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, ok := a.events[id]; !ok {
+		w.WriteHeader(404)
+		return
+	}
+	delete(a.events, id)
+	w.WriteHeader(204)
+}
+
+// eventFrom returns the event stored for req, with the date as Postgres
+// returns it.
+func eventFrom(id string, req models.UpdateEventRequest) models.Event {
+	return models.Event{
+		ID: id, Name: req.Name, Description: req.Description, VenueName: req.VenueName,
+		Address: req.Address, Date: req.Date + "T00:00:00Z", Time: req.Time,
+		ContactMobile: req.ContactMobile, ContactEmail: req.ContactEmail, ContactInstagram: req.ContactInstagram,
+	}
+}
+
+// run executes the events command with args, isolated from the user's CLI
+// config and environment.
+func run(t *testing.T, stdin string, args ...string) (stdout, stderr string, err error) {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	for _, env := range []string{ConfigFileEnv, ProfileEnv, URLEnv, APIKeyEnv} {
+		t.Setenv(env, "")
+		os.Unsetenv(env)
+	}
+
+	var out, errOut bytes.Buffer
+	cmd := EventsCommand()
+	cmd.SetArgs(args)
+	cmd.SetIn(strings.NewReader(stdin))
+	cmd.SetOut(&out)
+	cmd.SetErr(&errOut)
+	err = cmd.Execute()
+	return out.String(), errOut.String(), err
+}
+
+func TestEventCommands(t *testing.T) {
+	api, url := newFakeAPI(t)
+
+	out, _, err := run(t, "", "create", "--url", url, "--name", "Spring Fair", "--venue", "Town Hall",
+		"--address", "1 Main St", "--date", "2025-04-12", "--time", "10:00:00", "--contact-email", "fair@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "ID  DATE        TIME      NAME         VENUE\n"+
+		"1   2025-04-12  10:00:00  Spring Fair  Town Hall\n", out)
+
+	out, _, err = run(t, "", "update", "1", "--url", url, "--time", "11:00:00", "--contact-email", "", "-o", "json")
+	require.NoError(t, err)
+	var updated models.Event
+	require.NoError(t, json.Unmarshal([]byte(out), &updated))
+	assert.Equal(t, "Spring Fair", updated.Name, "fields not given keep their values")
+	assert.Equal(t, "11:00:00", updated.Time)
+	assert.Equal(t, "2025-04-12T00:00:00Z", updated.Date, "the stored date was sent back as YYYY-MM-DD")
+	assert.Nil(t, updated.ContactEmail)
+
+	out, _, err = run(t, "", "get", "1", "--url", url, "-o", "yaml")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out, "id: \"1\"\nname: Spring Fair\ndescription: null\nvenue_name: Town Hall\n"), out)
+
+	_, _, err = run(t, "", "create", "--url", url, "--name", "No Venue")
+	require.Error(t, err)
+	assert.Equal(t, "client: 400 Validation failed\n  venue_name: venue_name is required", err.Error())
+
+	out, _, err = run(t, "", "list", "--url", url, "--limit", "1", "--offset", "0", "-o", "json")
+	require.NoError(t, err)
+	assert.Contains(t, api.requests, "GET /api/events?limit=1")
+	assert.True(t, strings.HasPrefix(out, "[\n  {\n    \"id\": \"1\""), out)
+
+	_, stderr, err := run(t, "", "delete", "1", "--url", url)
+	require.NoError(t, err)
+	assert.Equal(t, "Deleted 1\n", stderr)
+	_, _, err = run(t, "", "get", "1", "--url", url)
+	assert.EqualError(t, err, "client: 404 Event not found")
+}
+
+func TestImportExport(t *testing.T) {
+	api, url := newFakeAPI(t)
+
+	// Unquoted YAML dates decode as timestamps; they are sent as dates.
+	events := `
+- name: Fair
+  venue_name: Hall
+  address: 1 Main St
+  date: 2025-04-12
+  time: "10:00:00"
+- name: Market
+  venue_name: Square
+  address: 2 Main St
+  date: 2025-05-01
+  time: "09:00:00"
+  contact_instagram: market
+`
+	out, stderr, err := run(t, events, "import", "-", "--url", url)
+	require.NoError(t, err)
+	assert.Equal(t, "Imported 2 events\n", stderr)
+	assert.Contains(t, out, "2   2025-05-01  09:00:00  Market  Square")
+
+	_, _, err = run(t, events, "import", "-", "--url", url)
+	require.NoError(t, err)
+	assert.Len(t, api.events, 2, "importing the same file again replays the creates")
+
+	path := filepath.Join(t.TempDir(), "events.json")
+	_, stderr, err = run(t, "", "export", "--url", url, "--out", path)
+	require.NoError(t, err)
+	assert.Equal(t, "Exported 2 events\n", stderr)
+
+	exported, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var got []models.Event
+	require.NoError(t, json.Unmarshal(exported, &got))
+	require.Len(t, got, 2)
+	assert.Equal(t, "2025-04-12", got[0].Date)
+	assert.Equal(t, "market", *got[1].ContactInstagram)
+
+	reqs, err := readEvents(EventsCommand(), path)
+	require.NoError(t, err)
+	assert.Equal(t, "Market", reqs[1].Name, "exports can be imported")
+}
+
+func TestProfiles(t *testing.T) {
+	_, staging := newFakeAPI(t)
+	api, prod := newFakeAPI(t)
+
+	config := filepath.Join(t.TempDir(), "cli.yaml")
+	require.NoError(t, os.WriteFile(config, []byte(`
+default: staging
+profiles:
+  staging:
+    url: `+staging+`
+  prod:
+    url: `+prod+`
+    output: json
+`), 0o600))
+
+	p, err := loadProfile(config, "", true)
+	require.NoError(t, err)
+	assert.Equal(t, staging, p.URL)
+
+	p, err = loadProfile(config, "prod", true)
+	require.NoError(t, err)
+	assert.Equal(t, Profile{URL: prod, Output: "json"}, p)
+
+	_, err = loadProfile(config, "dev", true)
+	assert.EqualError(t, err, `profile "dev" not found in `+config+` (have prod, staging)`)
+	_, err = loadProfile(filepath.Join(t.TempDir(), "missing.yaml"), "", true)
+	assert.Error(t, err, "a named config file must exist")
+	p, err = loadProfile(filepath.Join(t.TempDir(), "missing.yaml"), "", false)
+	assert.NoError(t, err, "the default config file is optional")
+	assert.Equal(t, Profile{}, p)
+
+	out, _, err := run(t, "", "list", "--config", config, "--profile", "prod")
+	require.NoError(t, err)
+	assert.Equal(t, "[]\n", out, "the profile's output format applies")
+	assert.Equal(t, []string{"GET /api/events"}, api.requests)
+
+	out, _, err = run(t, "", "list", "--config", config, "--profile", "prod", "-o", "table")
+	require.NoError(t, err)
+	assert.Equal(t, "ID  DATE  TIME  NAME  VENUE\n", out, "flags override the profile")
+
+	_, _, err = run(t, "", "list", "--config", config, "-o", "xml")
+	assert.EqualError(t, err, `output format must be table, json or yaml, got "xml"`)
+}
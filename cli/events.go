@@ -0,0 +1,406 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rsomcio/restapi/client"
+	"github.com/rsomcio/restapi/models"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// eventFlags set the fields of an event from the command line, on top of an
+// optional JSON or YAML file.
+type eventFlags struct {
+	file      string
+	name      string
+	desc      string
+	venue     string
+	address   string
+	date      string
+	time      string
+	mobile    string
+	email     string
+	instagram string
+}
+
+func (f *eventFlags) register(fs *pflag.FlagSet) {
+	fs.StringVarP(&f.file, "file", "f", "", "read the event from a JSON or YAML file (- for stdin)")
+	fs.StringVar(&f.name, "name", "", "event name")
+	fs.StringVar(&f.desc, "description", "", "description; empty to clear")
+	fs.StringVar(&f.venue, "venue", "", "venue name")
+	fs.StringVar(&f.address, "address", "", "venue address")
+	fs.StringVar(&f.date, "date", "", "date as YYYY-MM-DD")
+	fs.StringVar(&f.time, "time", "", "time as HH:MM:SS")
+	fs.StringVar(&f.mobile, "contact-mobile", "", "contact phone number; empty to clear")
+	fs.StringVar(&f.email, "contact-email", "", "contact email; empty to clear")
+	fs.StringVar(&f.instagram, "contact-instagram", "", "contact Instagram handle; empty to clear")
+}
+
+// build returns the event in the file, if any, or base, with the flags that
+// were set applied on top.
+func (f *eventFlags) build(cmd *cobra.Command, base models.CreateEventRequest) (models.CreateEventRequest, error) {
+	req := base
+	if f.file != "" {
+		reqs, err := readEvents(cmd, f.file)
+		if err != nil {
+			return req, err
+		}
+		if len(reqs) != 1 {
+			return req, fmt.Errorf("%s holds %d events, expected one", f.file, len(reqs))
+		}
+		req = reqs[0]
+	}
+
+	fs := cmd.Flags()
+	set := func(flag string, dst *string, value string) {
+		if fs.Changed(flag) {
+			*dst = value
+		}
+	}
+	optional := func(flag string, dst **string, value string) {
+		if fs.Changed(flag) {
+			*dst = nil
+			if value != "" {
+				*dst = &value
+			}
+		}
+	}
+	set("name", &req.Name, f.name)
+	optional("description", &req.Description, f.desc)
+	set("venue", &req.VenueName, f.venue)
+	set("address", &req.Address, f.address)
+	set("date", &req.Date, f.date)
+	set("time", &req.Time, f.time)
+	optional("contact-mobile", &req.ContactMobile, f.mobile)
+	optional("contact-email", &req.ContactEmail, f.email)
+	optional("contact-instagram", &req.ContactInstagram, f.instagram)
+	return req, nil
+}
+
+// readEvents reads one event or a list of them from a JSON or YAML file, or
+// from stdin when path is -. Fields other than those of a request, such as
+// the id and timestamps of exported events, are ignored.
+func readEvents(cmd *cobra.Command, path string) ([]models.CreateEventRequest, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(cmd.InOrStdin())
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read events: %w", err)
+	}
+	return ParseEvents(data, path)
+}
+
+// ParseEvents decodes a YAML or JSON list of events, or a single event, as
+// written by export. source names the data in errors.
+func ParseEvents(data []byte, source string) ([]models.CreateEventRequest, error) {
+	// JSON is YAML, so one decoder reads both.
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", source, err)
+	}
+	items, ok := doc.([]interface{})
+	if !ok {
+		items = []interface{}{doc}
+	}
+
+	reqs := make([]models.CreateEventRequest, len(items))
+	for i, item := range items {
+		if _, ok := item.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("%s: event %d is not an object", source, i+1)
+		}
+		// Round trip through JSON to decode by the json field names.
+		raw, err := json.Marshal(item)
+		if err != nil {
+			return nil, fmt.Errorf("%s: event %d: %w", source, i+1, err)
+		}
+		if err := json.Unmarshal(raw, &reqs[i]); err != nil {
+			return nil, fmt.Errorf("%s: event %d: %w", source, i+1, err)
+		}
+		reqs[i].Date = eventDate(reqs[i].Date)
+	}
+	return reqs, nil
+}
+
+// requestFrom returns the request that would recreate event.
+func requestFrom(event *models.Event) models.CreateEventRequest {
+	return models.CreateEventRequest{
+		Name:             event.Name,
+		Description:      event.Description,
+		VenueName:        event.VenueName,
+		Address:          event.Address,
+		Date:             eventDate(event.Date),
+		Time:             event.Time,
+		ContactMobile:    event.ContactMobile,
+		ContactEmail:     event.ContactEmail,
+		ContactInstagram: event.ContactInstagram,
+	}
+}
+
+// explain adds the field errors of an API error to its message.
+func explain(err error) error {
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || len(apiErr.Fields) == 0 {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString(err.Error())
+	for _, f := range apiErr.Fields {
+		fmt.Fprintf(&b, "\n  %s: %s", f.Field, f.Message)
+	}
+	return errors.New(b.String())
+}
+
+func createCommand(opts *options) *cobra.Command {
+	var fields eventFlags
+	var key string
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create an event",
+		Example: `  restapi events create --name "Spring Fair" --venue "Town Hall" \
+    --address "1 Main St" --date 2025-04-12 --time 10:00:00
+  restapi events create -f event.yaml`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := opts.session(cmd)
+			if err != nil {
+				return err
+			}
+			req, err := fields.build(cmd, models.CreateEventRequest{})
+			if err != nil {
+				return err
+			}
+			var callOpts []client.CallOption
+			if key != "" {
+				callOpts = append(callOpts, client.WithIdempotencyKey(key))
+			}
+
+			ctx, cancel := s.context(cmd)
+			defer cancel()
+			event, err := s.client.CreateEvent(ctx, req, callOpts...)
+			if err != nil {
+				return explain(err)
+			}
+			return writeEvents(cmd.OutOrStdout(), s.output, []models.Event{*event}, true)
+		},
+	}
+	fields.register(cmd.Flags())
+	cmd.Flags().StringVar(&key, "idempotency-key", "", "key that makes repeating this command create the event once")
+	return cmd
+}
+
+func getCommand(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "get ID",
+		Short: "Show an event",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := opts.session(cmd)
+			if err != nil {
+				return err
+			}
+			ctx, cancel := s.context(cmd)
+			defer cancel()
+			event, err := s.client.GetEvent(ctx, args[0])
+			if err != nil {
+				return explain(err)
+			}
+			return writeEvents(cmd.OutOrStdout(), s.output, []models.Event{*event}, true)
+		},
+	}
+}
+
+func listCommand(opts *options) *cobra.Command {
+	var list client.ListOptions
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List events ordered by date and time",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := opts.session(cmd)
+			if err != nil {
+				return err
+			}
+			ctx, cancel := s.context(cmd)
+			defer cancel()
+			events, err := s.client.ListEvents(ctx, list)
+			if err != nil {
+				return explain(err)
+			}
+			return writeEvents(cmd.OutOrStdout(), s.output, events, false)
+		},
+	}
+	cmd.Flags().IntVar(&list.Limit, "limit", 0, fmt.Sprintf("return at most this many events (1-%d); all when unset", client.MaxPageSize))
+	cmd.Flags().IntVar(&list.Offset, "offset", 0, "skip this many events")
+	return cmd
+}
+
+func updateCommand(opts *options) *cobra.Command {
+	var fields eventFlags
+	cmd := &cobra.Command{
+		Use:   "update ID",
+		Short: "Change fields of an event",
+		Long: `Change fields of an event. Fields not given keep their current values,
+unless --file supplies the whole event.`,
+		Example: `  restapi events update 3f2b... --time 11:00:00 --contact-email ""`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := opts.session(cmd)
+			if err != nil {
+				return err
+			}
+			ctx, cancel := s.context(cmd)
+			defer cancel()
+
+			current, err := s.client.GetEvent(ctx, args[0])
+			if err != nil {
+				return explain(err)
+			}
+			req, err := fields.build(cmd, requestFrom(current))
+			if err != nil {
+				return err
+			}
+			event, err := s.client.UpdateEvent(ctx, args[0], models.UpdateEventRequest(req))
+			if err != nil {
+				return explain(err)
+			}
+			return writeEvents(cmd.OutOrStdout(), s.output, []models.Event{*event}, true)
+		},
+	}
+	fields.register(cmd.Flags())
+	return cmd
+}
+
+func deleteCommand(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete ID...",
+		Short: "Delete events",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := opts.session(cmd)
+			if err != nil {
+				return err
+			}
+			ctx, cancel := s.context(cmd)
+			defer cancel()
+			for _, id := range args {
+				if err := s.client.DeleteEvent(ctx, id); err != nil {
+					return fmt.Errorf("failed to delete %s: %w", id, explain(err))
+				}
+				fmt.Fprintf(cmd.ErrOrStderr(), "Deleted %s\n", id)
+			}
+			return nil
+		},
+	}
+}
+
+func importCommand(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "import FILE",
+		Short: "Create the events in a JSON or YAML file",
+		Long: `Create the events in a JSON or YAML file (- for stdin) holding one event
+or a list of them, such as the output of export. Each event is sent with an
+idempotency key derived from its position and contents, so running the same
+import again after a failure does not create the events that already
+succeeded twice, for as long as the server keeps the keys.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := opts.session(cmd)
+			if err != nil {
+				return err
+			}
+			reqs, err := readEvents(cmd, args[0])
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := s.context(cmd)
+			defer cancel()
+			created := make([]models.Event, 0, len(reqs))
+			for i, req := range reqs {
+				event, err := s.client.CreateEvent(ctx, req, client.WithIdempotencyKey(importKey(i, req)))
+				if err != nil {
+					writeEvents(cmd.OutOrStdout(), s.output, created, false)
+					return fmt.Errorf("event %d of %d: %w", i+1, len(reqs), explain(err))
+				}
+				created = append(created, *event)
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "Imported %d events\n", len(created))
+			return writeEvents(cmd.OutOrStdout(), s.output, created, false)
+		},
+	}
+}
+
+// importKey identifies the i-th event of an import by its contents.
+func importKey(i int, req models.CreateEventRequest) string {
+	data, _ := json.Marshal(req)
+	sum := sha256.Sum256(append([]byte(fmt.Sprintf("%d:", i)), data...))
+	return "import-" + hex.EncodeToString(sum[:16])
+}
+
+func exportCommand(opts *options) *cobra.Command {
+	var format, path string
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Write every event to a JSON or YAML file",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != FormatJSON && format != FormatYAML {
+				return fmt.Errorf("export format must be json or yaml, got %q", format)
+			}
+			s, err := opts.session(cmd)
+			if err != nil {
+				return err
+			}
+			ctx, cancel := s.context(cmd)
+			defer cancel()
+
+			events := []models.Event{}
+			for event, err := range s.client.AllEvents(ctx, client.MaxPageSize) {
+				if err != nil {
+					return explain(err)
+				}
+				event.Date = eventDate(event.Date)
+				events = append(events, event)
+			}
+
+			if path == "" || path == "-" {
+				err = write(cmd.OutOrStdout(), format, events)
+			} else {
+				err = writeFile(path, format, events)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to write export: %w", err)
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "Exported %d events\n", len(events))
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", FormatJSON, "json or yaml")
+	cmd.Flags().StringVar(&path, "out", "", "file to write instead of stdout")
+	return cmd
+}
+
+func writeFile(path, format string, v interface{}) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f, format, v); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
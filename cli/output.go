@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rsomcio/restapi/models"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats.
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatYAML  = "yaml"
+)
+
+func checkFormat(format string) error {
+	switch format {
+	case FormatTable, FormatJSON, FormatYAML:
+		return nil
+	}
+	return fmt.Errorf("output format must be table, json or yaml, got %q", format)
+}
+
+// writeEvents prints events in format. A single event is printed as an
+// object rather than a one-element list.
+func writeEvents(w io.Writer, format string, events []models.Event, single bool) error {
+	if format == FormatTable {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tDATE\tTIME\tNAME\tVENUE")
+		for _, e := range events {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", e.ID, eventDate(e.Date), e.Time, e.Name, e.VenueName)
+		}
+		return tw.Flush()
+	}
+
+	var v interface{} = events
+	if single && len(events) == 1 {
+		v = events[0]
+	} else if events == nil {
+		v = []models.Event{}
+	}
+	return write(w, format, v)
+}
+
+// write prints v as JSON or YAML. YAML keeps the JSON field names and order.
+func write(w io.Writer, format string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if format == FormatJSON {
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+
+	// JSON is YAML, so decoding it into a node keeps the key order; clearing
+	// the flow and quoting styles then makes it print as block YAML.
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	blockStyle(&node)
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, child := range n.Content {
+		blockStyle(child)
+	}
+}
+
+// eventDate trims the midnight time that DATE columns come back with, so
+// that dates print, and import, as YYYY-MM-DD.
+func eventDate(date string) string {
+	if d, _, ok := strings.Cut(date, "T"); ok && len(d) == len("2006-01-02") {
+		return d
+	}
+	return date
+}
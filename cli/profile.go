@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Environment variables that override the selected profile. Flags override
+// them in turn.
+const (
+	ConfigFileEnv = "RESTAPI_CLI_CONFIG"
+	ProfileEnv    = "RESTAPI_PROFILE"
+	URLEnv        = "RESTAPI_URL"
+	APIKeyEnv     = "RESTAPI_API_KEY"
+)
+
+const defaultURL = "http://localhost:3000"
+
+// Profile holds the settings for talking to one deployment of the API.
+type Profile struct {
+	URL     string        `yaml:"url" toml:"url"`
+	APIKey  string        `yaml:"api_key" toml:"api_key"`
+	Output  string        `yaml:"output" toml:"output"`
+	Timeout time.Duration `yaml:"timeout" toml:"timeout"`
+}
+
+// profileFile is the CLI config file: named profiles and the one used when
+// none is selected.
+type profileFile struct {
+	Default  string             `yaml:"default" toml:"default"`
+	Profiles map[string]Profile `yaml:"profiles" toml:"profiles"`
+}
+
+// defaultConfigFile is where the CLI looks for profiles when neither
+// -config nor RESTAPI_CLI_CONFIG names a file.
+func defaultConfigFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "restapi", "cli.yaml")
+}
+
+// loadProfile reads path and returns the profile called name, or the file's
+// default profile when name is empty. A missing file at the default path is
+// not an error; it yields an empty profile.
+func loadProfile(path, name string, explicitPath bool) (Profile, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !explicitPath {
+		if name != "" {
+			return Profile{}, fmt.Errorf("profile %q not found: no config file at %s", name, path)
+		}
+		return Profile{}, nil
+	}
+	if err != nil {
+		return Profile{}, fmt.Errorf("failed to read CLI config: %w", err)
+	}
+
+	var file profileFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&file); err != nil {
+			return Profile{}, fmt.Errorf("failed to parse CLI config %s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), &file)
+		if err != nil {
+			return Profile{}, fmt.Errorf("failed to parse CLI config %s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return Profile{}, fmt.Errorf("failed to parse CLI config %s: unknown key %s", path, undecoded[0])
+		}
+	default:
+		return Profile{}, fmt.Errorf("CLI config %s must end in .yaml, .yml or .toml", path)
+	}
+
+	if name == "" {
+		name = file.Default
+	}
+	if name == "" {
+		return Profile{}, nil
+	}
+	profile, ok := file.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(file.Profiles))
+		for n := range file.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return Profile{}, fmt.Errorf("profile %q not found in %s (have %s)", name, path, strings.Join(names, ", "))
+	}
+	return profile, nil
+}
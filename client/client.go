@@ -0,0 +1,242 @@
+// Package client is a typed Go client for the events API. It retries failed
+// requests with backoff, makes writes safe to retry with idempotency keys and
+// reports API errors as *Error.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	apiKeyHeader         = "X-API-Key"
+	idempotencyKeyHeader = "Idempotency-Key"
+	requestIDHeader      = "X-Request-ID"
+)
+
+// Client calls the events API at a base URL. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	apiKey     string
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sends requests through hc instead of http.DefaultClient.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithAPIKey authenticates every request with key.
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithRetries sets how many times a request is retried after a network
+// error, a 429 or a 5xx response. Zero disables retries; the default is 3.
+func WithRetries(n int) Option {
+	return func(c *Client) {
+		c.retries = n
+	}
+}
+
+// WithBackoff sets the delay before the first retry, which doubles after
+// each further attempt up to max. The defaults are 100ms and 5s. A longer
+// Retry-After from the server takes precedence.
+func WithBackoff(initial, max time.Duration) Option {
+	return func(c *Client) {
+		c.backoff = initial
+		c.maxBackoff = max
+	}
+}
+
+// New returns a client for the API served at baseURL, such as
+// "https://events.example.com".
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("client: base URL %q must be an absolute http or https URL", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		retries:    3,
+		backoff:    100 * time.Millisecond,
+		maxBackoff: 5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.backoff <= 0 {
+		return nil, fmt.Errorf("client: backoff must be positive")
+	}
+	return c, nil
+}
+
+// CallOption configures a single call.
+type CallOption func(*call)
+
+type call struct {
+	idempotencyKey string
+}
+
+// WithIdempotencyKey sends key with a write so that the server applies it at
+// most once however often it is retried, including by the caller after the
+// client has given up. Writes without one get a random key that is reused
+// only for the client's own retries.
+func WithIdempotencyKey(key string) CallOption {
+	return func(c *call) {
+		c.idempotencyKey = key
+	}
+}
+
+// do sends a request with in as its JSON body, retrying as configured, and
+// decodes a successful response into out. Either may be nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out interface{}, opts []CallOption) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return fmt.Errorf("client: failed to encode request: %w", err)
+		}
+	}
+
+	var cl call
+	for _, opt := range opts {
+		opt(&cl)
+	}
+	if method != http.MethodGet && cl.idempotencyKey == "" {
+		cl.idempotencyKey = uuid.NewString()
+	}
+
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := c.attempt(ctx, method, target, body, cl, out)
+		if err == nil {
+			return nil
+		}
+		if attempt >= c.retries || !retryable(ctx, err) {
+			return err
+		}
+
+		delay := backoff + time.Duration(rand.Int64N(int64(backoff)/5+1))
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > c.maxBackoff {
+			backoff = c.maxBackoff
+		}
+	}
+}
+
+// attempt sends one request. On failure it also returns how long the server
+// asked the client to wait before retrying, if it did.
+func (c *Client) attempt(ctx context.Context, method, target string, body []byte, cl call, out interface{}) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("client: failed to build request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set(apiKeyHeader, c.apiKey)
+	}
+	if cl.idempotencyKey != "" {
+		req.Header.Set(idempotencyKeyHeader, cl.idempotencyKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, &networkError{err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return retryAfter(resp.Header.Get("Retry-After")), parseError(resp)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		io.Copy(io.Discard, resp.Body)
+		return 0, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return 0, &networkError{fmt.Errorf("failed to decode response: %w", err)}
+	}
+	return 0, nil
+}
+
+// networkError is a failure to exchange a request and response with the
+// server, which may or may not have processed the request.
+type networkError struct {
+	err error
+}
+
+func (e *networkError) Error() string { return "client: " + e.err.Error() }
+func (e *networkError) Unwrap() error { return e.err }
+
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	switch err := err.(type) {
+	case *networkError:
+		return true
+	case *Error:
+		return err.Status == http.StatusTooManyRequests ||
+			(err.Status >= 500 && err.Status != http.StatusNotImplemented)
+	}
+	return false
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP
+// date, returning zero when it is absent or malformed.
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,295 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rsomcio/restapi/apierror"
+	"github.com/rsomcio/restapi/config"
+	"github.com/rsomcio/restapi/database"
+	"github.com/rsomcio/restapi/models"
+	"github.com/rsomcio/restapi/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startServer serves the real application on a local port and returns its
+// base URL.
+func startServer(t *testing.T, configure func(cfg *config.Config)) string {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Features.Tracing = false
+	cfg.Features.Metrics = false
+	cfg.Server.ValidateResponses = true
+	if configure != nil {
+		configure(cfg)
+	}
+	app := server.New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go app.Listener(ln)
+	t.Cleanup(func() { app.Shutdown() })
+	return "http://" + ln.Addr().String()
+}
+
+func newClient(t *testing.T, baseURL string, opts ...Option) *Client {
+	t.Helper()
+	opts = append([]Option{WithBackoff(time.Millisecond, 10*time.Millisecond)}, opts...)
+	c, err := New(baseURL, opts...)
+	require.NoError(t, err)
+	return c
+}
+
+func TestNew(t *testing.T) {
+	for _, baseURL := range []string{"", "localhost:3000", "ftp://example.com", "http://"} {
+		_, err := New(baseURL)
+		assert.Error(t, err, baseURL)
+	}
+	_, err := New("http://localhost:3000", WithBackoff(0, 0))
+	assert.Error(t, err)
+}
+
+func TestValidationErrors(t *testing.T) {
+	c := newClient(t, startServer(t, nil))
+	ctx := context.Background()
+
+	_, err := c.CreateEvent(ctx, models.CreateEventRequest{Name: "Fair", Date: "2024-03-15", Time: "14:30:00"})
+	require.ErrorIs(t, err, ErrInvalid)
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, 400, apiErr.Status)
+	assert.Equal(t, apierror.TypeBaseURI+"validation-error", apiErr.Type)
+	assert.NotEmpty(t, apiErr.RequestID)
+	assert.Equal(t, []FieldError{
+		{Field: "venue_name", Code: "required", Message: "venue_name is required"},
+		{Field: "address", Code: "required", Message: "address is required"},
+	}, apiErr.Fields)
+
+	_, err = c.GetEvent(ctx, "abc")
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, []FieldError{{Field: "id", Code: "uuid", Message: "id must be a valid UUID"}}, apiErr.Fields)
+	assert.False(t, errors.Is(err, ErrNotFound))
+
+	_, err = c.ListEvents(ctx, ListOptions{Limit: MaxPageSize + 1})
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, []FieldError{{Field: "limit", Code: "max", Message: "limit must be at most 100"}}, apiErr.Fields)
+}
+
+func TestLegacyErrors(t *testing.T) {
+	c := newClient(t, startServer(t, func(cfg *config.Config) {
+		cfg.Server.ErrorFormat = "legacy"
+	}))
+
+	err := c.DeleteEvent(context.Background(), "abc")
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, 400, apiErr.Status)
+	assert.Equal(t, "Validation failed", apiErr.Detail)
+	assert.Equal(t, "Bad Request", apiErr.Title)
+	assert.NotEmpty(t, apiErr.RequestID, "taken from the X-Request-ID header")
+	assert.Len(t, apiErr.Fields, 1)
+}
+
+// flaky fails the first failures requests it receives with 503 and proxies
+// the rest to target, recording the idempotency key of each request.
+type flaky struct {
+	mu       sync.Mutex
+	failures int
+	keys     []string
+	proxy    *httputil.ReverseProxy
+}
+
+func newFlaky(t *testing.T, target string, failures int) (*flaky, string) {
+	u, err := url.Parse(target)
+	require.NoError(t, err)
+	f := &flaky{failures: failures, proxy: httputil.NewSingleHostReverseProxy(u)}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv.URL
+}
+
+func (f *flaky) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.keys = append(f.keys, r.Header.Get(idempotencyKeyHeader))
+	fail := len(f.keys) <= f.failures
+	f.mu.Unlock()
+
+	if fail {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	f.proxy.ServeHTTP(w, r)
+}
+
+func TestRetries(t *testing.T) {
+	target := startServer(t, nil)
+	ctx := context.Background()
+
+	f, baseURL := newFlaky(t, target, 2)
+	c := newClient(t, baseURL)
+	_, err := c.CreateEvent(ctx, models.CreateEventRequest{})
+	require.ErrorIs(t, err, ErrInvalid, "the third attempt reaches the server")
+	require.Len(t, f.keys, 3)
+	assert.NotEmpty(t, f.keys[0])
+	assert.Equal(t, []string{f.keys[0], f.keys[0], f.keys[0]}, f.keys, "retries reuse the idempotency key")
+
+	f, baseURL = newFlaky(t, target, 2)
+	c = newClient(t, baseURL, WithRetries(1))
+	_, err = c.UpdateEvent(ctx, "abc", models.UpdateEventRequest{}, WithIdempotencyKey("update-1"))
+	require.ErrorIs(t, err, ErrUnavailable)
+	assert.Equal(t, []string{"update-1", "update-1"}, f.keys)
+
+	f, baseURL = newFlaky(t, target, 0)
+	c = newClient(t, baseURL)
+	_, err = c.GetEvent(ctx, "abc")
+	require.ErrorIs(t, err, ErrInvalid)
+	assert.Equal(t, []string{""}, f.keys, "client errors are not retried and reads carry no key")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ln.Close()
+	c = newClient(t, "http://"+ln.Addr().String(), WithRetries(2))
+	_, err = c.GetEvent(ctx, "abc")
+	var netErr *networkError
+	assert.ErrorAs(t, err, &netErr, "connection errors are returned after the retries")
+}
+
+func TestRateLimited(t *testing.T) {
+	c := newClient(t, startServer(t, func(cfg *config.Config) {
+		cfg.RateLimit.WritePerMinute = 1
+		cfg.RateLimit.WriteBurst = 1
+	}))
+
+	_, err := c.CreateEvent(context.Background(), models.CreateEventRequest{})
+	require.ErrorIs(t, err, ErrInvalid)
+
+	// The server asks for about a minute; the client waits for it rather
+	// than its own short backoff, until the context gives up.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = c.CreateEvent(ctx, models.CreateEventRequest{})
+	require.ErrorIs(t, err, ErrRateLimited)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert.Equal(t, time.Duration(0), retryAfter(""))
+	assert.Equal(t, time.Duration(0), retryAfter("soon"))
+	assert.Equal(t, 7*time.Second, retryAfter("7"))
+	d := retryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.InDelta(t, float64(time.Minute), float64(d), float64(2*time.Second))
+}
+
+func TestAllEvents(t *testing.T) {
+	var events []models.Event
+	for i := 0; i < 5; i++ {
+		events = append(events, models.Event{ID: strconv.Itoa(i)})
+	}
+	var mu sync.Mutex
+	var pages []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		pages = append(pages, r.URL.RawQuery)
+		mu.Unlock()
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		end := min(offset+limit, len(events))
+		offset = min(offset, end)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(events[offset:end])
+	}))
+	defer srv.Close()
+	c := newClient(t, srv.URL)
+
+	var ids []string
+	for event, err := range c.AllEvents(context.Background(), 2) {
+		require.NoError(t, err)
+		ids = append(ids, event.ID)
+	}
+	assert.Equal(t, []string{"0", "1", "2", "3", "4"}, ids)
+	assert.Equal(t, []string{"limit=2", "limit=2&offset=2", "limit=2&offset=4"}, pages)
+
+	pages = nil
+	for event := range c.AllEvents(context.Background(), 2) {
+		if event.ID == "2" {
+			break
+		}
+	}
+	assert.Len(t, pages, 2, "stopping early fetches no further pages")
+}
+
+func TestEventsIntegration(t *testing.T) {
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("DATABASE_URL not set, skipping integration test")
+	}
+
+	cfg := config.Default()
+	cfg.Database.URL = databaseURL
+	require.NoError(t, database.Connect(context.Background(), cfg.Database))
+	t.Cleanup(func() { database.Close() })
+	require.NoError(t, database.CreateTables())
+
+	c := newClient(t, startServer(t, nil))
+	ctx := context.Background()
+
+	req := models.CreateEventRequest{
+		Name:      "Client SDK Test Event",
+		VenueName: "Test Venue",
+		Address:   "123 Test Street",
+		Date:      "2099-03-15",
+		Time:      "14:30:00",
+	}
+	created, err := c.CreateEvent(ctx, req, WithIdempotencyKey(t.Name()+time.Now().String()))
+	require.NoError(t, err)
+	t.Cleanup(func() { c.DeleteEvent(context.Background(), created.ID) })
+	assert.Equal(t, req.Name, created.Name)
+
+	key := WithIdempotencyKey(created.ID)
+	first, err := c.CreateEvent(ctx, req, key)
+	require.NoError(t, err)
+	t.Cleanup(func() { c.DeleteEvent(context.Background(), first.ID) })
+	again, err := c.CreateEvent(ctx, req, key)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, again.ID, "a repeated key replays the first response")
+
+	got, err := c.GetEvent(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, got.ID)
+
+	updated, err := c.UpdateEvent(ctx, created.ID, models.UpdateEventRequest{
+		Name: "Renamed", VenueName: req.VenueName, Address: req.Address, Date: req.Date, Time: req.Time,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed", updated.Name)
+
+	var seen []string
+	for event, err := range c.AllEvents(ctx, 1) {
+		require.NoError(t, err)
+		if event.ID == created.ID || event.ID == first.ID {
+			seen = append(seen, event.ID)
+		}
+	}
+	assert.ElementsMatch(t, []string{created.ID, first.ID}, seen)
+
+	require.NoError(t, c.DeleteEvent(ctx, created.ID))
+	_, err = c.GetEvent(ctx, created.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, c.DeleteEvent(ctx, created.ID), ErrNotFound)
+}
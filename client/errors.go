@@ -0,0 +1,96 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Sentinels for the API errors callers usually branch on. Match them with
+// errors.Is; use errors.As with *Error for the details.
+var (
+	ErrInvalid     = errors.New("invalid request")
+	ErrNotFound    = errors.New("not found")
+	ErrConflict    = errors.New("conflict")
+	ErrRateLimited = errors.New("rate limited")
+	ErrUnavailable = errors.New("service unavailable")
+)
+
+// FieldError describes why one field of a request was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is an error response from the API, read from either its problem
+// details or its legacy error body.
+type Error struct {
+	Status    int
+	Type      string
+	Title     string
+	Detail    string
+	RequestID string
+	Fields    []FieldError
+}
+
+func (e *Error) Error() string {
+	msg := e.Detail
+	if msg == "" {
+		msg = e.Title
+	}
+	return fmt.Sprintf("client: %d %s", e.Status, msg)
+}
+
+// Is reports whether target is the sentinel for the status of e.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrInvalid:
+		return e.Status == http.StatusBadRequest
+	case ErrNotFound:
+		return e.Status == http.StatusNotFound
+	case ErrConflict:
+		return e.Status == http.StatusConflict
+	case ErrRateLimited:
+		return e.Status == http.StatusTooManyRequests
+	case ErrUnavailable:
+		return e.Status == http.StatusServiceUnavailable || e.Status == http.StatusGatewayTimeout
+	}
+	return false
+}
+
+// parseError builds an *Error from an error response, falling back to the
+// status line when the body is not one the API produces.
+func parseError(resp *http.Response) *Error {
+	var body struct {
+		Type      string       `json:"type"`
+		Title     string       `json:"title"`
+		Detail    string       `json:"detail"`
+		RequestID string       `json:"request_id"`
+		Fields    []FieldError `json:"fields"`
+		Legacy    string       `json:"error"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	json.Unmarshal(data, &body)
+
+	e := &Error{
+		Status:    resp.StatusCode,
+		Type:      body.Type,
+		Title:     body.Title,
+		Detail:    body.Detail,
+		RequestID: body.RequestID,
+		Fields:    body.Fields,
+	}
+	if e.Detail == "" {
+		e.Detail = body.Legacy
+	}
+	if e.Title == "" {
+		e.Title = http.StatusText(resp.StatusCode)
+	}
+	if e.RequestID == "" {
+		e.RequestID = resp.Header.Get(requestIDHeader)
+	}
+	return e
+}
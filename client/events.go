@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"iter"
+	"net/url"
+	"strconv"
+
+	"github.com/rsomcio/restapi/models"
+)
+
+// MaxPageSize is the largest page the server returns.
+const MaxPageSize = 100
+
+// ListOptions selects a page of events. A zero Limit returns every event
+// from Offset on.
+type ListOptions struct {
+	Limit  int
+	Offset int
+}
+
+// CreateEvent creates an event and returns it as stored.
+func (c *Client) CreateEvent(ctx context.Context, req models.CreateEventRequest, opts ...CallOption) (*models.Event, error) {
+	var event models.Event
+	if err := c.do(ctx, "POST", "/api/events", nil, req, &event, opts); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// GetEvent returns the event with the given ID.
+func (c *Client) GetEvent(ctx context.Context, id string) (*models.Event, error) {
+	var event models.Event
+	if err := c.do(ctx, "GET", "/api/events/"+url.PathEscape(id), nil, nil, &event, nil); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// ListEvents returns one page of events ordered by date and time.
+func (c *Client) ListEvents(ctx context.Context, opts ListOptions) ([]models.Event, error) {
+	query := url.Values{}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Offset > 0 {
+		query.Set("offset", strconv.Itoa(opts.Offset))
+	}
+
+	var events []models.Event
+	if err := c.do(ctx, "GET", "/api/events", query, nil, &events, nil); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// AllEvents iterates over every event, fetching pageSize of them at a time;
+// a pageSize outside 1..MaxPageSize means MaxPageSize. Iteration stops at the
+// first error, which is yielded with a zero event. Events created or deleted
+// while iterating may shift the pages, so an event can be skipped or seen
+// twice.
+func (c *Client) AllEvents(ctx context.Context, pageSize int) iter.Seq2[models.Event, error] {
+	if pageSize <= 0 || pageSize > MaxPageSize {
+		pageSize = MaxPageSize
+	}
+	return func(yield func(models.Event, error) bool) {
+		for offset := 0; ; offset += pageSize {
+			events, err := c.ListEvents(ctx, ListOptions{Limit: pageSize, Offset: offset})
+			if err != nil {
+				yield(models.Event{}, err)
+				return
+			}
+			for _, event := range events {
+				if !yield(event, nil) {
+					return
+				}
+			}
+			if len(events) < pageSize {
+				return
+			}
+		}
+	}
+}
+
+// UpdateEvent replaces the event with the given ID and returns it as stored.
+func (c *Client) UpdateEvent(ctx context.Context, id string, req models.UpdateEventRequest, opts ...CallOption) (*models.Event, error) {
+	var event models.Event
+	if err := c.do(ctx, "PUT", "/api/events/"+url.PathEscape(id), nil, req, &event, opts); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// DeleteEvent deletes the event with the given ID.
+func (c *Client) DeleteEvent(ctx context.Context, id string, opts ...CallOption) error {
+	return c.do(ctx, "DELETE", "/api/events/"+url.PathEscape(id), nil, nil, nil, opts)
+}
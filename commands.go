@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rsomcio/restapi/apikey"
+	"github.com/rsomcio/restapi/cli"
+	"github.com/rsomcio/restapi/config"
+	"github.com/rsomcio/restapi/database"
+	"github.com/rsomcio/restapi/handlers"
+	"github.com/rsomcio/restapi/logging"
+	"github.com/rsomcio/restapi/models"
+	"github.com/spf13/cobra"
+)
+
+//go:embed fixtures/events.yaml
+var fixtureEvents []byte
+
+// adminCommand returns a command that loads the configuration from the
+// server flags in its arguments and connects to the database before calling
+// fn with the remaining arguments, of which there must be minArgs to maxArgs.
+func adminCommand(use, short string, minArgs, maxArgs int, fn func(ctx context.Context, cmd *cobra.Command, args []string) error) *cobra.Command {
+	return &cobra.Command{
+		Use:                use,
+		Short:              short,
+		Args:               cobra.ArbitraryArgs,
+		DisableFlagParsing: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, args, err := loadAdminConfig(args, minArgs, maxArgs)
+			if err != nil || cfg == nil {
+				return err
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			if err := database.Connect(ctx, cfg.Database); err != nil {
+				return err
+			}
+			defer database.Close()
+			return fn(ctx, cmd, args)
+		},
+	}
+}
+
+// loadAdminConfig is config.LoadArgs for admin commands, which log to stderr
+// so that their output can be piped. It returns a nil config after printing
+// the flag help.
+func loadAdminConfig(args []string, minArgs, maxArgs int) (*config.Config, []string, error) {
+	cfg, args, err := config.LoadArgs(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(args) < minArgs || len(args) > maxArgs {
+		if minArgs == maxArgs {
+			return nil, nil, fmt.Errorf("expected %d arguments after the flags, got %d", minArgs, len(args))
+		}
+		return nil, nil, fmt.Errorf("expected %d to %d arguments after the flags, got %d", minArgs, maxArgs, len(args))
+	}
+
+	level, err := logging.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+	logger := logging.New(os.Stderr, level)
+	slog.SetDefault(logger)
+	database.SetLogger(logger)
+	return cfg, args, nil
+}
+
+func serveCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:                "serve [-config FILE] [flags]",
+		Short:              "Serve the API, applying pending migrations first",
+		Args:               cobra.ArbitraryArgs,
+		DisableFlagParsing: true,
+		RunE:               serveE,
+	}
+}
+
+// serveE runs the server with the flags in args.
+func serveE(cmd *cobra.Command, args []string) error {
+	if err := run(args); err != nil {
+		cmd.SilenceErrors = true
+		slog.Error("Server stopped", "error", err)
+		return err
+	}
+	return nil
+}
+
+func migrateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply, revert and list schema migrations",
+	}
+	cmd.AddCommand(
+		adminCommand("up [flags]", "Apply pending migrations", 0, 0,
+			func(ctx context.Context, cmd *cobra.Command, _ []string) error {
+				applied, err := database.MigrateUp(ctx)
+				if err != nil {
+					return err
+				}
+				for _, mig := range applied {
+					fmt.Fprintf(cmd.OutOrStdout(), "Applied %04d_%s\n", mig.Version, mig.Name)
+				}
+				if len(applied) == 0 {
+					fmt.Fprintln(cmd.OutOrStdout(), "Schema is up to date")
+				}
+				return nil
+			}),
+		adminCommand("down [flags] [STEPS]", "Revert the most recent migrations, one by default", 0, 1,
+			func(ctx context.Context, cmd *cobra.Command, args []string) error {
+				steps := 1
+				if len(args) == 1 {
+					n, err := strconv.Atoi(args[0])
+					if err != nil || n < 1 {
+						return fmt.Errorf("steps must be a positive integer, got %q", args[0])
+					}
+					steps = n
+				}
+				reverted, err := database.MigrateDown(ctx, steps)
+				if err != nil {
+					return err
+				}
+				for _, mig := range reverted {
+					fmt.Fprintf(cmd.OutOrStdout(), "Reverted %04d_%s\n", mig.Version, mig.Name)
+				}
+				if len(reverted) == 0 {
+					fmt.Fprintln(cmd.OutOrStdout(), "No migrations to revert")
+				}
+				return nil
+			}),
+		adminCommand("status [flags]", "List migrations and when they were applied", 0, 0,
+			func(ctx context.Context, cmd *cobra.Command, _ []string) error {
+				states, err := database.MigrationStatus(ctx)
+				if err != nil {
+					return err
+				}
+				tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+				fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+				for _, s := range states {
+					applied := "pending"
+					if s.AppliedAt != nil {
+						applied = s.AppliedAt.UTC().Format(time.RFC3339)
+					}
+					fmt.Fprintf(tw, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+				}
+				return tw.Flush()
+			}),
+	)
+	return cmd
+}
+
+func seedCommand() *cobra.Command {
+	return adminCommand("seed [flags] [FILE]", "Load events from a YAML or JSON file, or the sample events", 0, 1,
+		func(ctx context.Context, cmd *cobra.Command, args []string) error {
+			data, source := fixtureEvents, "fixtures/events.yaml"
+			if len(args) == 1 {
+				var err error
+				if data, err = os.ReadFile(args[0]); err != nil {
+					return fmt.Errorf("failed to read events: %w", err)
+				}
+				source = args[0]
+			}
+			reqs, err := cli.ParseEvents(data, source)
+			if err != nil {
+				return err
+			}
+			for i, req := range reqs {
+				if fields := handlers.ValidateEvent(req); fields != nil {
+					msgs := make([]string, len(fields))
+					for j, f := range fields {
+						msgs[j] = f.Message
+					}
+					return fmt.Errorf("%s: event %d: %s", source, i+1, strings.Join(msgs, "; "))
+				}
+			}
+
+			if ready, err := database.SchemaReady(ctx); err != nil {
+				return err
+			} else if !ready {
+				return errors.New("schema migrations are pending, run restapi migrate up first")
+			}
+			added, err := seedEvents(ctx, reqs)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Seeded %d events, %d already present\n", added, len(reqs)-added)
+			return nil
+		})
+}
+
+// seedEvents inserts reqs in one transaction, skipping events that already
+// exist with the same name, venue and date so that seeding can be repeated.
+// It returns how many were inserted.
+func seedEvents(ctx context.Context, reqs []models.CreateEventRequest) (int, error) {
+	tx, err := database.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to seed events: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO events (name, description, venue_name, address, date, time, contact_mobile, contact_email, contact_instagram)
+		SELECT $1::text, $2::text, $3::text, $4::text, $5::date, $6::time, $7::text, $8::text, $9::text
+		WHERE NOT EXISTS (SELECT 1 FROM events WHERE name = $1 AND venue_name = $3 AND date = $5)`
+
+	added := 0
+	for _, req := range reqs {
+		res, err := tx.ExecContext(ctx, query, req.Name, req.Description, req.VenueName, req.Address, req.Date, req.Time, req.ContactMobile, req.ContactEmail, req.ContactInstagram)
+		if err != nil {
+			return 0, fmt.Errorf("failed to seed %q: %w", req.Name, err)
+		}
+		n, _ := res.RowsAffected()
+		added += int(n)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to seed events: %w", err)
+	}
+	return added, nil
+}
+
+func apikeyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apikey",
+		Short: "Create, list and revoke API keys",
+	}
+	cmd.AddCommand(
+		adminCommand("create [flags] NAME", "Create an API key and print it", 1, 1,
+			func(ctx context.Context, cmd *cobra.Command, args []string) error {
+				key, secret, err := apikey.Create(ctx, args[0])
+				if err != nil {
+					return err
+				}
+				// The key goes to stdout alone, so that it can be captured.
+				fmt.Fprintln(cmd.OutOrStdout(), secret)
+				fmt.Fprintf(cmd.ErrOrStderr(), "Created API key %s (%s). It is not stored and cannot be shown again.\n", key.ID, key.Name)
+				return nil
+			}),
+		adminCommand("list [flags]", "List API keys", 0, 0,
+			func(ctx context.Context, cmd *cobra.Command, _ []string) error {
+				keys, err := apikey.List(ctx)
+				if err != nil {
+					return err
+				}
+				tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+				fmt.Fprintln(tw, "ID\tNAME\tPREFIX\tCREATED\tREVOKED")
+				for _, k := range keys {
+					revoked := "-"
+					if k.RevokedAt != nil {
+						revoked = k.RevokedAt.UTC().Format(time.RFC3339)
+					}
+					fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", k.ID, k.Name, k.Prefix, k.CreatedAt.UTC().Format(time.RFC3339), revoked)
+				}
+				return tw.Flush()
+			}),
+		adminCommand("revoke [flags] ID", "Revoke an API key", 1, 1,
+			func(ctx context.Context, cmd *cobra.Command, args []string) error {
+				if _, err := uuid.Parse(args[0]); err != nil {
+					return fmt.Errorf("invalid API key ID %q", args[0])
+				}
+				key, err := apikey.Revoke(ctx, args[0])
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.ErrOrStderr(), "Revoked %s (%s)\n", key.ID, key.Name)
+				return nil
+			}),
+	)
+	return cmd
+}
+
+func checkConfigCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:                "check-config [-config FILE] [flags]",
+		Short:              "Validate the configuration and print it with secrets masked",
+		Args:               cobra.ArbitraryArgs,
+		DisableFlagParsing: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := loadAdminConfig(args, 0, 0)
+			if err != nil || cfg == nil {
+				return err
+			}
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(cfg.Redacted()); err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.ErrOrStderr(), "Configuration is valid")
+			return nil
+		},
+	}
+}
@@ -0,0 +1,380 @@
+// Package config loads the service configuration from defaults, an optional
+// YAML or TOML file, environment variables and command-line flags, in
+// increasing order of precedence.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rsomcio/restapi/cache"
+	"github.com/rsomcio/restapi/logging"
+	"github.com/rsomcio/restapi/ratelimit"
+	"github.com/rsomcio/restapi/tracing"
+)
+
+// Every leaf field carries its file key (yaml/toml), its environment
+// variable (env), its flag name (flag) and a usage string. Fields tagged
+// secret are redacted when the configuration is printed.
+
+type Config struct {
+	Server    Server    `yaml:"server" toml:"server"`
+	Database  Database  `yaml:"database" toml:"database"`
+	Log       Log       `yaml:"log" toml:"log"`
+	CORS      CORS      `yaml:"cors" toml:"cors"`
+	Security  Security  `yaml:"security" toml:"security"`
+	Tracing   Tracing   `yaml:"tracing" toml:"tracing"`
+	Cache     Cache     `yaml:"cache" toml:"cache"`
+	RateLimit RateLimit `yaml:"rate_limit" toml:"rate_limit"`
+	Webhooks  Webhooks  `yaml:"webhooks" toml:"webhooks"`
+	Outbox    Outbox    `yaml:"outbox" toml:"outbox"`
+	Stream    Stream    `yaml:"stream" toml:"stream"`
+	Features  Features  `yaml:"features" toml:"features"`
+}
+
+type Server struct {
+	Port                int           `yaml:"port" toml:"port" env:"PORT" flag:"port" usage:"HTTP listen port"`
+	BodyLimit           int           `yaml:"body_limit" toml:"body_limit" env:"BODY_LIMIT" flag:"body-limit" usage:"maximum request body size in bytes"`
+	ReadTimeout         time.Duration `yaml:"read_timeout" toml:"read_timeout" env:"READ_TIMEOUT" flag:"read-timeout" usage:"maximum duration for reading a request"`
+	WriteTimeout        time.Duration `yaml:"write_timeout" toml:"write_timeout" env:"WRITE_TIMEOUT" flag:"write-timeout" usage:"maximum duration for writing a response"`
+	IdleTimeout         time.Duration `yaml:"idle_timeout" toml:"idle_timeout" env:"IDLE_TIMEOUT" flag:"idle-timeout" usage:"maximum time to keep idle keep-alive connections open"`
+	ShutdownTimeout     time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" usage:"how long to wait for in-flight requests on shutdown"`
+	ErrorFormat         string        `yaml:"error_format" toml:"error_format" env:"ERROR_FORMAT" flag:"error-format" usage:"problem (RFC 7807) or legacy"`
+	ValidateResponses   bool          `yaml:"validate_responses" toml:"validate_responses" env:"VALIDATE_RESPONSES" flag:"validate-responses" usage:"check every response against the OpenAPI document and fail mismatches with 500 (for tests)"`
+	TrustedProxies      []string      `yaml:"trusted_proxies" toml:"trusted_proxies" env:"TRUSTED_PROXIES" flag:"trusted-proxies" usage:"comma-separated proxy addresses or CIDR ranges whose X-Forwarded-For is believed"`
+	IdempotencyTTL      time.Duration `yaml:"idempotency_ttl" toml:"idempotency_ttl" env:"IDEMPOTENCY_TTL" flag:"idempotency-ttl" usage:"how long the response to a write with an Idempotency-Key is replayed"`
+	DocsScriptURL       string        `yaml:"docs_script_url" toml:"docs_script_url" env:"DOCS_SCRIPT_URL" flag:"docs-script-url" usage:"version-pinned Redoc bundle that /docs loads"`
+	DocsScriptIntegrity string        `yaml:"docs_script_integrity" toml:"docs_script_integrity" env:"DOCS_SCRIPT_INTEGRITY" flag:"docs-script-integrity" usage:"Subresource Integrity hash of docs_script_url (make docs-integrity prints it); /docs is only served when set"`
+}
+
+type Database struct {
+	URL               string        `yaml:"url" toml:"url" env:"DATABASE_URL" flag:"database-url" usage:"PostgreSQL connection string" secret:"true"`
+	MaxOpenConns      int           `yaml:"max_open_conns" toml:"max_open_conns" env:"DB_MAX_OPEN_CONNS" flag:"db-max-open-conns" usage:"maximum open connections (0 = unlimited)"`
+	MaxIdleConns      int           `yaml:"max_idle_conns" toml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS" flag:"db-max-idle-conns" usage:"maximum idle connections"`
+	ConnMaxLifetime   time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME" flag:"db-conn-max-lifetime" usage:"maximum time a connection may be reused (0 = forever)"`
+	ConnMaxIdleTime   time.Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME" flag:"db-conn-max-idle-time" usage:"maximum time a connection may sit idle (0 = forever)"`
+	ConnectTimeout    time.Duration `yaml:"connect_timeout" toml:"connect_timeout" env:"DB_CONNECT_TIMEOUT" flag:"db-connect-timeout" usage:"how long to keep retrying the initial connection"`
+	ConnectBackoff    time.Duration `yaml:"connect_backoff" toml:"connect_backoff" env:"DB_CONNECT_BACKOFF" flag:"db-connect-backoff" usage:"delay before the first connection retry, doubled after each attempt"`
+	ConnectBackoffMax time.Duration `yaml:"connect_backoff_max" toml:"connect_backoff_max" env:"DB_CONNECT_BACKOFF_MAX" flag:"db-connect-backoff-max" usage:"upper bound on the delay between connection retries"`
+
+	ReplicaURLs          []string      `yaml:"replica_urls" toml:"replica_urls" env:"DATABASE_REPLICA_URLS" flag:"database-replica-urls" usage:"comma-separated read replica connection strings" secret:"true"`
+	ReplicaCheckInterval time.Duration `yaml:"replica_check_interval" toml:"replica_check_interval" env:"DB_REPLICA_CHECK_INTERVAL" flag:"db-replica-check-interval" usage:"how often replicas are pinged to decide whether they receive reads"`
+	ReadYourWritesWindow time.Duration `yaml:"read_your_writes_window" toml:"read_your_writes_window" env:"DB_READ_YOUR_WRITES_WINDOW" flag:"db-read-your-writes-window" usage:"how long a client's reads stay on the primary after it writes"`
+
+	QueryTimeout  time.Duration            `yaml:"query_timeout" toml:"query_timeout" env:"DB_QUERY_TIMEOUT" flag:"db-query-timeout" usage:"default time limit for the queries of one request (0 = none)"`
+	RouteTimeouts map[string]time.Duration `yaml:"route_timeouts" toml:"route_timeouts" env:"DB_ROUTE_TIMEOUTS" flag:"db-route-timeouts" usage:"per-route query time limits, e.g. \"GET /api/events=2s,POST /api/events=10s\""`
+}
+
+// TimeoutFor returns the query time limit for the route registered as
+// method and path, falling back to QueryTimeout.
+func (d Database) TimeoutFor(method, path string) time.Duration {
+	if timeout, ok := d.RouteTimeouts[method+" "+path]; ok {
+		return timeout
+	}
+	return d.QueryTimeout
+}
+
+type Log struct {
+	Level string `yaml:"level" toml:"level" env:"LOG_LEVEL" flag:"log-level" usage:"debug, info, warn or error"`
+}
+
+type CORS struct {
+	AllowOrigins     []string      `yaml:"allow_origins" toml:"allow_origins" env:"CORS_ALLOW_ORIGINS" flag:"cors-allow-origins" usage:"comma-separated origins allowed to call the API from browsers, or *; none by default"`
+	AllowMethods     []string      `yaml:"allow_methods" toml:"allow_methods" env:"CORS_ALLOW_METHODS" flag:"cors-allow-methods" usage:"comma-separated methods allowed in cross-origin requests"`
+	AllowHeaders     []string      `yaml:"allow_headers" toml:"allow_headers" env:"CORS_ALLOW_HEADERS" flag:"cors-allow-headers" usage:"comma-separated request headers allowed in cross-origin requests"`
+	ExposeHeaders    []string      `yaml:"expose_headers" toml:"expose_headers" env:"CORS_EXPOSE_HEADERS" flag:"cors-expose-headers" usage:"comma-separated response headers readable by cross-origin callers"`
+	AllowCredentials bool          `yaml:"allow_credentials" toml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS" flag:"cors-allow-credentials" usage:"allow cookies and authorization headers in cross-origin requests"`
+	MaxAge           time.Duration `yaml:"max_age" toml:"max_age" env:"CORS_MAX_AGE" flag:"cors-max-age" usage:"how long browsers may cache preflight responses"`
+}
+
+type Security struct {
+	HSTSMaxAge            time.Duration `yaml:"hsts_max_age" toml:"hsts_max_age" env:"HSTS_MAX_AGE" flag:"hsts-max-age" usage:"Strict-Transport-Security max-age (0 = header off)"`
+	HSTSIncludeSubdomains bool          `yaml:"hsts_include_subdomains" toml:"hsts_include_subdomains" env:"HSTS_INCLUDE_SUBDOMAINS" flag:"hsts-include-subdomains" usage:"extend Strict-Transport-Security to subdomains"`
+	ContentSecurityPolicy string        `yaml:"content_security_policy" toml:"content_security_policy" env:"CONTENT_SECURITY_POLICY" flag:"content-security-policy" usage:"Content-Security-Policy sent with HTML pages"`
+	RequireAPIKey         bool          `yaml:"require_api_key" toml:"require_api_key" env:"REQUIRE_API_KEY" flag:"require-api-key" usage:"reject /api requests without a valid X-API-Key created with restapi apikey create"`
+}
+
+type Tracing struct {
+	Exporter string `yaml:"exporter" toml:"exporter" env:"OTEL_TRACES_EXPORTER" flag:"trace-exporter" usage:"none or otlp"`
+}
+
+type Cache struct {
+	Backend       string        `yaml:"backend" toml:"backend" env:"CACHE_BACKEND" flag:"cache-backend" usage:"none, memory or redis"`
+	TTL           time.Duration `yaml:"ttl" toml:"ttl" env:"CACHE_TTL" flag:"cache-ttl" usage:"how long event reads are cached and may be reused by clients"`
+	MaxEntries    int           `yaml:"max_entries" toml:"max_entries" env:"CACHE_MAX_ENTRIES" flag:"cache-max-entries" usage:"maximum entries held by the memory backend"`
+	RedisAddr     string        `yaml:"redis_addr" toml:"redis_addr" env:"CACHE_REDIS_ADDR" flag:"cache-redis-addr" usage:"host:port of the Redis-compatible server"`
+	RedisPassword string        `yaml:"redis_password" toml:"redis_password" env:"CACHE_REDIS_PASSWORD" flag:"cache-redis-password" usage:"password for the Redis-compatible server" secret:"true"`
+	RedisDB       int           `yaml:"redis_db" toml:"redis_db" env:"CACHE_REDIS_DB" flag:"cache-redis-db" usage:"database number on the Redis-compatible server"`
+	RedisTimeout  time.Duration `yaml:"redis_timeout" toml:"redis_timeout" env:"CACHE_REDIS_TIMEOUT" flag:"cache-redis-timeout" usage:"time limit for each Redis command"`
+}
+
+type RateLimit struct {
+	Enabled        bool   `yaml:"enabled" toml:"enabled" env:"RATE_LIMIT_ENABLED" flag:"rate-limit-enabled" usage:"limit requests per API key or client IP"`
+	Store          string `yaml:"store" toml:"store" env:"RATE_LIMIT_STORE" flag:"rate-limit-store" usage:"memory, or redis to share limits between instances through the server at cache.redis_addr"`
+	ReadPerMinute  int    `yaml:"read_per_minute" toml:"read_per_minute" env:"RATE_LIMIT_READ_PER_MINUTE" flag:"rate-limit-read-per-minute" usage:"sustained GET requests per minute per client"`
+	ReadBurst      int    `yaml:"read_burst" toml:"read_burst" env:"RATE_LIMIT_READ_BURST" flag:"rate-limit-read-burst" usage:"GET requests a client may make at once"`
+	WritePerMinute int    `yaml:"write_per_minute" toml:"write_per_minute" env:"RATE_LIMIT_WRITE_PER_MINUTE" flag:"rate-limit-write-per-minute" usage:"sustained POST, PUT and DELETE requests per minute per client"`
+	WriteBurst     int    `yaml:"write_burst" toml:"write_burst" env:"RATE_LIMIT_WRITE_BURST" flag:"rate-limit-write-burst" usage:"POST, PUT and DELETE requests a client may make at once"`
+	IPPerMinute    int    `yaml:"ip_per_minute" toml:"ip_per_minute" env:"RATE_LIMIT_IP_PER_MINUTE" flag:"rate-limit-ip-per-minute" usage:"sustained requests per minute per client IP, counted before API keys are checked"`
+	IPBurst        int    `yaml:"ip_burst" toml:"ip_burst" env:"RATE_LIMIT_IP_BURST" flag:"rate-limit-ip-burst" usage:"requests a client IP may make at once, counted before API keys are checked"`
+}
+
+type Webhooks struct {
+	Timeout      time.Duration `yaml:"timeout" toml:"timeout" env:"WEBHOOK_TIMEOUT" flag:"webhook-timeout" usage:"time limit for each webhook delivery attempt"`
+	MaxAttempts  int           `yaml:"max_attempts" toml:"max_attempts" env:"WEBHOOK_MAX_ATTEMPTS" flag:"webhook-max-attempts" usage:"attempts to deliver a message before giving up"`
+	Backoff      time.Duration `yaml:"backoff" toml:"backoff" env:"WEBHOOK_BACKOFF" flag:"webhook-backoff" usage:"delay before the first retry, doubled after each attempt"`
+	BackoffMax   time.Duration `yaml:"backoff_max" toml:"backoff_max" env:"WEBHOOK_BACKOFF_MAX" flag:"webhook-backoff-max" usage:"upper bound on the delay between retries"`
+	DisableAfter int           `yaml:"disable_after" toml:"disable_after" env:"WEBHOOK_DISABLE_AFTER" flag:"webhook-disable-after" usage:"undelivered messages in a row after which a webhook is disabled (0 = never)"`
+	Concurrency  int           `yaml:"concurrency" toml:"concurrency" env:"WEBHOOK_CONCURRENCY" flag:"webhook-concurrency" usage:"maximum delivery requests in flight"`
+	Retention    time.Duration `yaml:"retention" toml:"retention" env:"WEBHOOK_RETENTION" flag:"webhook-retention" usage:"how long the record of each delivery attempt is kept (0 = forever)"`
+	// AllowInternal lets webhooks point at loopback, private and
+	// link-local addresses, which are otherwise refused so that webhooks
+	// cannot probe the network the server runs in.
+	AllowInternal bool `yaml:"allow_internal" toml:"allow_internal" env:"WEBHOOK_ALLOW_INTERNAL" flag:"webhook-allow-internal" usage:"allow webhooks to internal addresses such as localhost, for development"`
+}
+
+type Outbox struct {
+	Sinks           []string      `yaml:"sinks" toml:"sinks" env:"OUTBOX_SINKS" flag:"outbox-sinks" usage:"comma-separated destinations of event changes: webhooks, log"`
+	PollInterval    time.Duration `yaml:"poll_interval" toml:"poll_interval" env:"OUTBOX_POLL_INTERVAL" flag:"outbox-poll-interval" usage:"how often the outbox is checked for changes made by other instances"`
+	BatchSize       int           `yaml:"batch_size" toml:"batch_size" env:"OUTBOX_BATCH_SIZE" flag:"outbox-batch-size" usage:"maximum changes relayed at once"`
+	RetryBackoff    time.Duration `yaml:"retry_backoff" toml:"retry_backoff" env:"OUTBOX_RETRY_BACKOFF" flag:"outbox-retry-backoff" usage:"delay before a change that failed to relay is retried, doubled after each attempt"`
+	RetryBackoffMax time.Duration `yaml:"retry_backoff_max" toml:"retry_backoff_max" env:"OUTBOX_RETRY_BACKOFF_MAX" flag:"outbox-retry-backoff-max" usage:"upper bound on the delay between relay retries"`
+	Lease           time.Duration `yaml:"lease" toml:"lease" env:"OUTBOX_LEASE" flag:"outbox-lease" usage:"how long an instance may take to relay the changes it claims before others may claim them"`
+	Retention       time.Duration `yaml:"retention" toml:"retention" env:"OUTBOX_RETENTION" flag:"outbox-retention" usage:"how long relayed changes are kept in the outbox (0 = forever)"`
+}
+
+type Stream struct {
+	ReplaySize int           `yaml:"replay_size" toml:"replay_size" env:"STREAM_REPLAY_SIZE" flag:"stream-replay-size" usage:"latest changes kept for streaming clients that reconnect"`
+	Buffer     int           `yaml:"buffer" toml:"buffer" env:"STREAM_BUFFER" flag:"stream-buffer" usage:"changes a streaming client may fall behind before it is disconnected"`
+	Heartbeat  time.Duration `yaml:"heartbeat" toml:"heartbeat" env:"STREAM_HEARTBEAT" flag:"stream-heartbeat" usage:"how often idle event streams are sent a heartbeat and WebSockets are pinged"`
+}
+
+type Features struct {
+	Metrics bool `yaml:"metrics" toml:"metrics" env:"FEATURE_METRICS" flag:"feature-metrics" usage:"serve Prometheus metrics at /metrics"`
+	Tracing bool `yaml:"tracing" toml:"tracing" env:"FEATURE_TRACING" flag:"feature-tracing" usage:"trace requests and queries with OpenTelemetry"`
+}
+
+// Default returns the configuration used when nothing overrides it.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:            3000,
+			BodyLimit:       4 * 1024 * 1024,
+			ReadTimeout:     30 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			IdleTimeout:     2 * time.Minute,
+			ShutdownTimeout: 15 * time.Second,
+			ErrorFormat:     "problem",
+			IdempotencyTTL:  24 * time.Hour,
+			DocsScriptURL:   "https://cdn.jsdelivr.net/npm/redoc@2.1.5/bundles/redoc.standalone.js",
+		},
+		Database: Database{
+			MaxIdleConns:      2,
+			ConnMaxLifetime:   30 * time.Minute,
+			ConnMaxIdleTime:   5 * time.Minute,
+			ConnectTimeout:    30 * time.Second,
+			ConnectBackoff:    500 * time.Millisecond,
+			ConnectBackoffMax: 5 * time.Second,
+			QueryTimeout:      5 * time.Second,
+
+			ReplicaCheckInterval: 5 * time.Second,
+			ReadYourWritesWindow: 5 * time.Second,
+		},
+		Log: Log{
+			Level: "info",
+		},
+		CORS: CORS{
+			AllowMethods:  []string{"GET", "HEAD", "POST", "PUT", "DELETE"},
+			AllowHeaders:  []string{"Content-Type", "X-API-Key", "X-Request-ID", "Idempotency-Key"},
+			ExposeHeaders: []string{"X-Request-ID", "X-Cache", "Idempotent-Replayed", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"},
+			MaxAge:        10 * time.Minute,
+		},
+		Security: Security{
+			HSTSMaxAge:            180 * 24 * time.Hour,
+			ContentSecurityPolicy: "default-src 'self'; frame-ancestors 'none'",
+		},
+		Tracing: Tracing{
+			Exporter: tracing.ExporterNone,
+		},
+		Cache: Cache{
+			Backend:      cache.BackendMemory,
+			TTL:          30 * time.Second,
+			MaxEntries:   1000,
+			RedisTimeout: 500 * time.Millisecond,
+		},
+		RateLimit: RateLimit{
+			Enabled:        true,
+			Store:          ratelimit.StoreMemory,
+			ReadPerMinute:  600,
+			ReadBurst:      100,
+			WritePerMinute: 60,
+			WriteBurst:     20,
+			IPPerMinute:    1200,
+			IPBurst:        200,
+		},
+		Webhooks: Webhooks{
+			Timeout:      10 * time.Second,
+			MaxAttempts:  6,
+			Backoff:      10 * time.Second,
+			BackoffMax:   10 * time.Minute,
+			DisableAfter: 20,
+			Concurrency:  8,
+			Retention:    7 * 24 * time.Hour,
+		},
+		Outbox: Outbox{
+			Sinks:           []string{"webhooks"},
+			PollInterval:    time.Second,
+			BatchSize:       100,
+			RetryBackoff:    time.Second,
+			RetryBackoffMax: 5 * time.Minute,
+			Lease:           time.Minute,
+			Retention:       24 * time.Hour,
+		},
+		Stream: Stream{
+			ReplaySize: 1000,
+			Buffer:     64,
+			Heartbeat:  15 * time.Second,
+		},
+		Features: Features{
+			Metrics: true,
+			Tracing: true,
+		},
+	}
+}
+
+// sriPattern matches a Subresource Integrity hash.
+var sriPattern = regexp.MustCompile(`^sha(256|384|512)-[A-Za-z0-9+/]+={0,2}$`)
+
+// Validate checks that every setting is usable and returns all problems
+// found, joined into a single error.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port must be between 1 and 65535, got %d", c.Server.Port)
+	check(c.Server.BodyLimit > 0, "server.body_limit must be positive, got %d", c.Server.BodyLimit)
+	check(c.Server.ReadTimeout >= 0, "server.read_timeout must not be negative")
+	check(c.Server.WriteTimeout >= 0, "server.write_timeout must not be negative")
+	check(c.Server.IdleTimeout >= 0, "server.idle_timeout must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	check(c.Server.ErrorFormat == "problem" || c.Server.ErrorFormat == "legacy", "server.error_format must be problem or legacy, got %q", c.Server.ErrorFormat)
+	check(c.Server.IdempotencyTTL > 0, "server.idempotency_ttl must be positive")
+	if docs, err := url.Parse(c.Server.DocsScriptURL); err != nil || docs.Scheme != "https" || docs.Host == "" {
+		check(false, "server.docs_script_url: %q is not an https URL", c.Server.DocsScriptURL)
+	}
+	check(c.Server.DocsScriptIntegrity == "" || sriPattern.MatchString(c.Server.DocsScriptIntegrity),
+		"server.docs_script_integrity: %q is not a hash such as sha384-BASE64", c.Server.DocsScriptIntegrity)
+	for _, proxy := range c.Server.TrustedProxies {
+		_, _, cidrErr := net.ParseCIDR(proxy)
+		check(cidrErr == nil || net.ParseIP(proxy) != nil, "server.trusted_proxies: %q is not an IP address or CIDR range", proxy)
+	}
+
+	check(c.Database.URL != "", "database.url is required (set DATABASE_URL)")
+	check(c.Database.MaxOpenConns >= 0, "database.max_open_conns must not be negative")
+	check(c.Database.MaxIdleConns >= 0, "database.max_idle_conns must not be negative")
+	check(c.Database.MaxOpenConns == 0 || c.Database.MaxIdleConns <= c.Database.MaxOpenConns,
+		"database.max_idle_conns (%d) must not exceed database.max_open_conns (%d)", c.Database.MaxIdleConns, c.Database.MaxOpenConns)
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime must not be negative")
+	check(c.Database.ConnMaxIdleTime >= 0, "database.conn_max_idle_time must not be negative")
+	check(c.Database.ConnectTimeout >= 0, "database.connect_timeout must not be negative")
+	check(c.Database.ConnectBackoff > 0, "database.connect_backoff must be positive")
+	check(c.Database.ConnectBackoffMax >= c.Database.ConnectBackoff,
+		"database.connect_backoff_max (%s) must be at least database.connect_backoff (%s)", c.Database.ConnectBackoffMax, c.Database.ConnectBackoff)
+	check(c.Database.QueryTimeout >= 0, "database.query_timeout must not be negative")
+	check(c.Database.ReplicaCheckInterval > 0, "database.replica_check_interval must be positive")
+	check(c.Database.ReadYourWritesWindow >= 0, "database.read_your_writes_window must not be negative")
+	for route, timeout := range c.Database.RouteTimeouts {
+		method, path, ok := strings.Cut(route, " ")
+		check(ok && method != "" && strings.HasPrefix(path, "/"), "database.route_timeouts: %q is not a route such as \"GET /api/events\"", route)
+		check(timeout > 0, "database.route_timeouts: timeout for %q must be positive", route)
+	}
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		errs = append(errs, fmt.Errorf("log.level: %w", err))
+	}
+
+	for _, origin := range c.CORS.AllowOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		check(err == nil && u.Scheme != "" && u.Host != "", "cors.allow_origins: %q is not an origin such as https://example.com", origin)
+	}
+	check(!c.CORS.AllowCredentials || !slices.Contains(c.CORS.AllowOrigins, "*"),
+		"cors.allow_credentials cannot be used with cors.allow_origins *; list the origins")
+	for _, method := range c.CORS.AllowMethods {
+		check(method != "" && method == strings.ToUpper(method) && !strings.ContainsAny(method, " \t"), "cors.allow_methods: %q is not an HTTP method such as GET", method)
+	}
+	check(c.CORS.MaxAge >= 0, "cors.max_age must not be negative")
+	check(c.Security.HSTSMaxAge >= 0, "security.hsts_max_age must not be negative")
+
+	check(c.Tracing.Exporter == tracing.ExporterNone || c.Tracing.Exporter == tracing.ExporterOTLP,
+		"tracing.exporter must be %s or %s, got %q", tracing.ExporterNone, tracing.ExporterOTLP, c.Tracing.Exporter)
+
+	switch c.RateLimit.Store {
+	case ratelimit.StoreMemory:
+	case ratelimit.StoreRedis:
+		check(c.Cache.RedisAddr != "", "cache.redis_addr is required when rate_limit.store is redis")
+	default:
+		check(false, "rate_limit.store must be %s or %s, got %q", ratelimit.StoreMemory, ratelimit.StoreRedis, c.RateLimit.Store)
+	}
+	switch c.Cache.Backend {
+	case cache.BackendNone:
+	case cache.BackendMemory:
+		check(c.Cache.MaxEntries > 0, "cache.max_entries must be positive, got %d", c.Cache.MaxEntries)
+	case cache.BackendRedis:
+		check(c.Cache.RedisAddr != "", "cache.redis_addr is required when cache.backend is redis")
+		check(c.Cache.RedisDB >= 0, "cache.redis_db must not be negative")
+		check(c.Cache.RedisTimeout > 0, "cache.redis_timeout must be positive")
+	default:
+		check(false, "cache.backend must be %s, %s or %s, got %q", cache.BackendNone, cache.BackendMemory, cache.BackendRedis, c.Cache.Backend)
+	}
+	check(c.Cache.TTL > 0, "cache.ttl must be positive")
+
+	if c.RateLimit.Enabled {
+		check(c.RateLimit.ReadPerMinute > 0, "rate_limit.read_per_minute must be positive")
+		check(c.RateLimit.ReadBurst > 0, "rate_limit.read_burst must be positive")
+		check(c.RateLimit.WritePerMinute > 0, "rate_limit.write_per_minute must be positive")
+		check(c.RateLimit.WriteBurst > 0, "rate_limit.write_burst must be positive")
+		check(c.RateLimit.IPPerMinute > 0, "rate_limit.ip_per_minute must be positive")
+		check(c.RateLimit.IPBurst > 0, "rate_limit.ip_burst must be positive")
+	}
+
+	check(c.Webhooks.Timeout > 0, "webhooks.timeout must be positive")
+	check(c.Webhooks.MaxAttempts > 0, "webhooks.max_attempts must be positive")
+	check(c.Webhooks.Backoff > 0, "webhooks.backoff must be positive")
+	check(c.Webhooks.BackoffMax >= c.Webhooks.Backoff,
+		"webhooks.backoff_max (%s) must be at least webhooks.backoff (%s)", c.Webhooks.BackoffMax, c.Webhooks.Backoff)
+	check(c.Webhooks.DisableAfter >= 0, "webhooks.disable_after must not be negative")
+	check(c.Webhooks.Concurrency > 0, "webhooks.concurrency must be positive")
+	check(c.Webhooks.Retention >= 0, "webhooks.retention must not be negative")
+
+	for _, sink := range c.Outbox.Sinks {
+		check(sink == "webhooks" || sink == "log", "outbox.sinks: %q is not webhooks or log", sink)
+	}
+	check(c.Outbox.PollInterval > 0, "outbox.poll_interval must be positive")
+	check(c.Outbox.BatchSize > 0, "outbox.batch_size must be positive")
+	check(c.Outbox.RetryBackoff > 0, "outbox.retry_backoff must be positive")
+	check(c.Outbox.RetryBackoffMax >= c.Outbox.RetryBackoff,
+		"outbox.retry_backoff_max (%s) must be at least outbox.retry_backoff (%s)", c.Outbox.RetryBackoffMax, c.Outbox.RetryBackoff)
+	check(c.Outbox.Lease > 0, "outbox.lease must be positive")
+	check(c.Webhooks.Timeout < c.Outbox.Lease,
+		"webhooks.timeout (%s) must be less than outbox.lease (%s)", c.Webhooks.Timeout, c.Outbox.Lease)
+	check(c.Outbox.Retention >= 0, "outbox.retention must not be negative")
+
+	check(c.Stream.ReplaySize >= 0, "stream.replay_size must not be negative")
+	check(c.Stream.Buffer > 0, "stream.buffer must be positive")
+	check(c.Stream.Heartbeat > 0, "stream.heartbeat must be positive")
+
+	return errors.Join(errs...)
+}
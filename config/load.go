@@ -0,0 +1,246 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileEnv names the environment variable that points at a config
+// file when the -config flag is not given.
+const ConfigFileEnv = "CONFIG_FILE"
+
+// field is a leaf setting discovered by walking Config with reflection.
+type field struct {
+	path   string // dotted file key, e.g. database.max_open_conns
+	env    string
+	flag   string
+	usage  string
+	secret bool
+	value  reflect.Value
+}
+
+func fields(cfg *Config) []field {
+	var out []field
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			key := prefix + sf.Tag.Get("yaml")
+			if sf.Type.Kind() == reflect.Struct && sf.Type != reflect.TypeOf(time.Duration(0)) {
+				walk(v.Field(i), key+".")
+				continue
+			}
+			out = append(out, field{
+				path:   key,
+				env:    sf.Tag.Get("env"),
+				flag:   sf.Tag.Get("flag"),
+				usage:  sf.Tag.Get("usage"),
+				secret: sf.Tag.Get("secret") == "true",
+				value:  v.Field(i),
+			})
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem(), "")
+	return out
+}
+
+// set parses s according to the type of f and stores it.
+func (f field) set(s string) error {
+	switch f.value.Interface().(type) {
+	case string:
+		f.value.SetString(s)
+	case int:
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("%s: %q is not an integer", f.path, s)
+		}
+		f.value.SetInt(int64(n))
+	case bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a boolean", f.path, s)
+		}
+		f.value.SetBool(b)
+	case time.Duration:
+		d, err := time.ParseDuration(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a duration", f.path, s)
+		}
+		f.value.SetInt(int64(d))
+	case []string:
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		f.value.Set(reflect.ValueOf(items))
+	case map[string]time.Duration:
+		m := make(map[string]time.Duration)
+		for _, item := range strings.Split(s, ",") {
+			if strings.TrimSpace(item) == "" {
+				continue
+			}
+			key, value, ok := strings.Cut(item, "=")
+			if !ok {
+				return fmt.Errorf("%s: %q is not a key=duration pair", f.path, item)
+			}
+			d, err := time.ParseDuration(strings.TrimSpace(value))
+			if err != nil {
+				return fmt.Errorf("%s: %q is not a duration", f.path, value)
+			}
+			m[strings.TrimSpace(key)] = d
+		}
+		f.value.Set(reflect.ValueOf(m))
+	default:
+		return fmt.Errorf("%s: unsupported type %s", f.path, f.value.Type())
+	}
+	return nil
+}
+
+// Load builds the configuration from, in increasing order of precedence:
+// defaults, the file named by -config or CONFIG_FILE, environment variables
+// and the flags in args. The result is validated before it is returned.
+func Load(args []string) (*Config, error) {
+	cfg, _, err := LoadArgs(args)
+	return cfg, err
+}
+
+// LoadArgs is Load for commands that take arguments after the flags, which
+// it returns.
+func LoadArgs(args []string) (*Config, []string, error) {
+	cfg := Default()
+	all := fields(cfg)
+
+	fs := flag.NewFlagSet("restapi", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv(ConfigFileEnv), "path to a YAML or TOML config file")
+	flagValues := make(map[string]*string, len(all))
+	for _, f := range all {
+		if f.flag != "" {
+			flagValues[f.flag] = fs.String(f.flag, "", f.usage+" (env "+f.env+")")
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *configFile != "" {
+		if err := loadFile(cfg, *configFile); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, f := range all {
+		if s, ok := os.LookupEnv(f.env); ok && f.env != "" {
+			if err := f.set(s); err != nil {
+				return nil, nil, fmt.Errorf("env %s: %w", f.env, err)
+			}
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(fl *flag.Flag) {
+		for _, f := range all {
+			if f.flag == fl.Name && flagErr == nil {
+				if err := f.set(*flagValues[fl.Name]); err != nil {
+					flagErr = fmt.Errorf("flag -%s: %w", fl.Name, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, nil, flagErr
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, fs.Args(), nil
+}
+
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil {
+			return fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("failed to parse config file %s: unknown key %s", path, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("config file %s must end in .yaml, .yml or .toml", path)
+	}
+	return nil
+}
+
+// Redacted returns the effective configuration as a flat map of file keys to
+// values, with secrets masked, suitable for logging at startup.
+func (c *Config) Redacted() map[string]interface{} {
+	out := make(map[string]interface{})
+	for _, f := range fields(c) {
+		v := f.value.Interface()
+		if urls, ok := v.([]string); ok && f.secret {
+			redacted := make([]string, len(urls))
+			for i, u := range urls {
+				redacted[i] = redact(u)
+			}
+			v = redacted
+		} else if f.secret {
+			v = redact(f.value.String())
+		} else if d, ok := v.(time.Duration); ok {
+			v = d.String()
+		} else if m, ok := v.(map[string]time.Duration); ok {
+			durations := make(map[string]string, len(m))
+			for k, d := range m {
+				durations[k] = d.String()
+			}
+			v = durations
+		}
+		out[f.path] = v
+	}
+	return out
+}
+
+// redact masks s, keeping the structure of URLs so that the host and
+// database remain visible.
+func redact(s string) string {
+	if s == "" {
+		return ""
+	}
+	if u, err := url.Parse(s); err == nil && u.Scheme != "" && u.Host != "" {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "xxxxx")
+		}
+		q := u.Query()
+		if q.Has("password") {
+			q.Set("password", "xxxxx")
+			u.RawQuery = q.Encode()
+		}
+		return u.String()
+	}
+	return "xxxxx"
+}
@@ -4,82 +4,157 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
-	"log"
-	"os"
-	"runtime"
+	"log/slog"
+	"math/rand/v2"
+	"time"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"github.com/rsomcio/restapi/config"
 )
 
-func logError(msg string, args ...interface{}) {
-	_, file, line, ok := runtime.Caller(1)
-	if ok {
-		log.Printf("[%s:%d] "+msg, append([]interface{}{file, line}, args...)...)
-	} else {
-		log.Printf(msg, args...)
-	}
-}
+var DB *sqlx.DB
 
-func logInfo(msg string, args ...interface{}) {
-	_, file, line, ok := runtime.Caller(1)
-	if ok {
-		log.Printf("[%s:%d] "+msg, append([]interface{}{file, line}, args...)...)
-	} else {
-		log.Printf(msg, args...)
-	}
-}
+var logger = slog.Default()
 
-var DB *sqlx.DB
+// SetLogger replaces the logger used by the database package.
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
 
-func Connect() error {
-	databaseURL := os.Getenv("DATABASE_URL")
-	if databaseURL == "" {
-		return fmt.Errorf("DATABASE_URL environment variable is required")
+// Connect opens the connection pool described by cfg. While the database is
+// unreachable it retries with exponential backoff, starting at
+// cfg.ConnectBackoff and capped at cfg.ConnectBackoffMax, until
+// cfg.ConnectTimeout has elapsed or ctx is cancelled; a zero timeout makes a
+// single attempt. Errors that retrying cannot fix, such as a malformed URL or
+// bad credentials, fail immediately.
+func Connect(ctx context.Context, cfg config.Database) error {
+	if cfg.URL == "" {
+		return fmt.Errorf("database URL is required")
 	}
 
-	var err error
-	DB, err = sqlx.Connect("postgres", databaseURL)
+	db, err := open(cfg.URL, cfg)
 	if err != nil {
 		return fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	if err := DB.Ping(); err != nil {
-		return fmt.Errorf("failed to ping database: %w", err)
+	retryable := IsUnavailable
+	if cfg.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.ConnectTimeout)
+		defer cancel()
+	} else {
+		retryable = func(error) bool { return false }
+	}
+
+	attempts, err := retry(ctx, cfg.ConnectBackoff, cfg.ConnectBackoffMax, retryable, func() error {
+		return db.PingContext(ctx)
+	})
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("failed to connect to database after %d attempts: %w", attempts, err)
 	}
 
-	logInfo("Successfully connected to database")
+	DB = db
+	logger.Info("Successfully connected to database",
+		"attempts", attempts,
+		"max_open_conns", cfg.MaxOpenConns,
+		"max_idle_conns", cfg.MaxIdleConns,
+		"conn_max_lifetime", cfg.ConnMaxLifetime.String(),
+		"conn_max_idle_time", cfg.ConnMaxIdleTime.String(),
+	)
 	return nil
 }
 
+// open creates a traced pool for url with the pool settings of cfg, without
+// connecting.
+func open(url string, cfg config.Database) (*sqlx.DB, error) {
+	connector, err := pq.NewConnector(url)
+	if err != nil {
+		return nil, err
+	}
+
+	db := sqlx.NewDb(sql.OpenDB(tracedConnector{connector}), "postgres")
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	return db, nil
+}
+
+// retry calls fn until it succeeds, returns an error retryable rejects, or
+// ctx is done. The delay between attempts starts at backoff, doubles after
+// each failure up to maxBackoff, and is jittered by up to 20% so that
+// replicas restarting together do not retry in lockstep. It returns the
+// number of attempts made and the last error.
+func retry(ctx context.Context, backoff, maxBackoff time.Duration, retryable func(error) bool, fn func() error) (int, error) {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return attempt, nil
+		}
+		if !retryable(err) {
+			return attempt, err
+		}
+
+		delay := backoff + time.Duration(rand.Int64N(int64(backoff)/5+1))
+		logger.Warn("Database not reachable, retrying", "attempt", attempt, "retry_in", delay.String(), "error", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, err
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// CreateTables brings the schema up to date by applying the migrations that
+// have not been applied yet.
 func CreateTables() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS events (
-		id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
-		name VARCHAR(255) NOT NULL,
-		description TEXT,
-		venue_name VARCHAR(255) NOT NULL,
-		address TEXT NOT NULL,
-		date DATE NOT NULL,
-		time TIME NOT NULL,
-		contact_mobile VARCHAR(20),
-		contact_email VARCHAR(255),
-		contact_instagram VARCHAR(100),
-		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-	);`
-
-	_, err := DB.Exec(schema)
+	applied, err := MigrateUp(context.Background())
 	if err != nil {
 		return fmt.Errorf("failed to create tables: %w", err)
 	}
 
-	logInfo("Database tables created successfully")
+	logger.Info("Database tables created successfully", "migrations_applied", len(applied))
 	return nil
 }
 
+// SchemaReady reports whether every migration built into the binary has been
+// applied.
+func SchemaReady(ctx context.Context) (bool, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return false, err
+	}
+
+	var exists bool
+	if err := DB.GetContext(ctx, &exists, "SELECT to_regclass('public.schema_migrations') IS NOT NULL"); err != nil {
+		return false, fmt.Errorf("failed to check schema: %w", err)
+	}
+	if !exists {
+		return false, nil
+	}
+
+	var version int
+	if err := DB.GetContext(ctx, &version, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations"); err != nil {
+		return false, fmt.Errorf("failed to check schema: %w", err)
+	}
+	return version >= len(migrations), nil
+}
+
 func Close() error {
+	closeReplicas()
 	if DB != nil {
 		return DB.Close()
 	}
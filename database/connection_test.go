@@ -1,49 +1,92 @@
 package database
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/lib/pq"
+	"github.com/rsomcio/restapi/config"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-func TestConnectWithoutDatabaseURL(t *testing.T) {
-	// Save original env var
-	originalURL := os.Getenv("DATABASE_URL")
-	defer func() {
-		if originalURL != "" {
-			os.Setenv("DATABASE_URL", originalURL)
-		} else {
-			os.Unsetenv("DATABASE_URL")
-		}
-	}()
-
-	// Remove DATABASE_URL env var
-	os.Unsetenv("DATABASE_URL")
+// testConfig returns the connection settings for integration tests.
+func testConfig() config.Database {
+	cfg := config.Default().Database
+	cfg.URL = os.Getenv("DATABASE_URL")
+	return cfg
+}
 
-	err := Connect()
+func TestConnectWithoutDatabaseURL(t *testing.T) {
+	err := Connect(context.Background(), config.Database{})
 	require.Error(t, err)
-	assert.Contains(t, err.Error(), "DATABASE_URL environment variable is required")
+	assert.Contains(t, err.Error(), "database URL is required")
 }
 
 func TestConnectWithInvalidDatabaseURL(t *testing.T) {
-	// Save original env var
-	originalURL := os.Getenv("DATABASE_URL")
-	defer func() {
-		if originalURL != "" {
-			os.Setenv("DATABASE_URL", originalURL)
-		} else {
-			os.Unsetenv("DATABASE_URL")
-		}
-	}()
+	err := Connect(context.Background(), config.Database{URL: "invalid-url"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to connect to database")
+}
 
-	// Set invalid DATABASE_URL
-	os.Setenv("DATABASE_URL", "invalid-url")
+func TestConnectRetriesUntilDeadline(t *testing.T) {
+	cfg := config.Default().Database
+	cfg.URL = "postgres://events@127.0.0.1:1/events?sslmode=disable"
+	cfg.ConnectTimeout = 300 * time.Millisecond
+	cfg.ConnectBackoff = 20 * time.Millisecond
+	cfg.ConnectBackoffMax = 50 * time.Millisecond
 
-	err := Connect()
+	start := time.Now()
+	err := Connect(context.Background(), cfg)
 	require.Error(t, err)
-	assert.Contains(t, err.Error(), "failed to connect to database")
+	assert.Contains(t, err.Error(), "failed to connect to database after")
+	assert.NotContains(t, err.Error(), "after 1 attempts")
+	assert.GreaterOrEqual(t, time.Since(start), cfg.ConnectTimeout)
+	assert.Nil(t, DB)
+}
+
+func TestRetry(t *testing.T) {
+	errUnavailable := errors.New("unavailable")
+	errFatal := errors.New("fatal")
+	retryable := func(err error) bool { return err == errUnavailable }
+
+	t.Run("succeeds after transient failures", func(t *testing.T) {
+		calls := 0
+		attempts, err := retry(context.Background(), time.Millisecond, 4*time.Millisecond, retryable, func() error {
+			calls++
+			if calls < 3 {
+				return errUnavailable
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("stops on permanent failure", func(t *testing.T) {
+		attempts, err := retry(context.Background(), time.Millisecond, 4*time.Millisecond, retryable, func() error {
+			return errFatal
+		})
+		assert.Equal(t, errFatal, err)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("stops when context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		attempts, err := retry(ctx, time.Hour, time.Hour, retryable, func() error {
+			return errUnavailable
+		})
+		assert.Equal(t, errUnavailable, err)
+		assert.Equal(t, 1, attempts)
+	})
 }
 
 func TestConnectWithValidDatabaseURL(t *testing.T) {
@@ -59,7 +102,7 @@ func TestConnectWithValidDatabaseURL(t *testing.T) {
 		DB = nil
 	}
 
-	err := Connect()
+	err := Connect(context.Background(), testConfig())
 	require.NoError(t, err)
 	assert.NotNil(t, DB)
 
@@ -94,7 +137,7 @@ func TestCreateTablesWithValidConnection(t *testing.T) {
 
 	// Ensure we have a connection
 	if DB == nil {
-		err := Connect()
+		err := Connect(context.Background(), testConfig())
 		require.NoError(t, err)
 	}
 
@@ -130,7 +173,7 @@ func TestCloseWithValidDB(t *testing.T) {
 	}
 
 	// Create a separate connection for this test
-	err := Connect()
+	err := Connect(context.Background(), testConfig())
 	require.NoError(t, err)
 	require.NotNil(t, DB)
 
@@ -154,7 +197,7 @@ func TestDatabaseSchemaIntegration(t *testing.T) {
 
 	// Ensure we have a connection
 	if DB == nil {
-		err := Connect()
+		err := Connect(context.Background(), testConfig())
 		require.NoError(t, err)
 	}
 
@@ -164,7 +207,7 @@ func TestDatabaseSchemaIntegration(t *testing.T) {
 
 	// Test that we can insert and retrieve a test record
 	testEventID := "550e8400-e29b-41d4-a716-446655440000"
-	
+
 	// Clean up any existing test data
 	DB.Exec("DELETE FROM events WHERE id = $1", testEventID)
 
@@ -190,4 +233,38 @@ func TestDatabaseSchemaIntegration(t *testing.T) {
 	// Clean up test data
 	_, err = DB.Exec("DELETE FROM events WHERE id = $1", testEventID)
 	require.NoError(t, err)
-}
\ No newline at end of file
+}
+
+func TestIsUnavailable(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		unavailable bool
+	}{
+		{"nil", nil, false},
+		{"no rows", sql.ErrNoRows, false},
+		{"bad connection", driver.ErrBadConn, true},
+		{"connection closed", fmt.Errorf("query: %w", sql.ErrConnDone), true},
+		{"network error", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"connection failure", &pq.Error{Code: "08006"}, true},
+		{"too many connections", &pq.Error{Code: "53300"}, true},
+		{"admin shutdown", &pq.Error{Code: "57P01"}, true},
+		{"query canceled", &pq.Error{Code: "57014"}, false},
+		{"unique violation", &pq.Error{Code: "23505"}, false},
+		{"deadline exceeded", context.DeadlineExceeded, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.unavailable, IsUnavailable(tt.err))
+		})
+	}
+}
+
+func TestIsTimeout(t *testing.T) {
+	assert.True(t, IsTimeout(fmt.Errorf("query: %w", context.DeadlineExceeded)))
+	assert.True(t, IsTimeout(&pq.Error{Code: "57014"}))
+	assert.False(t, IsTimeout(context.Canceled))
+	assert.False(t, IsTimeout(&pq.Error{Code: "08006"}))
+	assert.False(t, IsTimeout(nil))
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// IsUnavailable reports whether err means the database could not be reached
+// or refused to serve the query, as opposed to the query itself failing.
+func IsUnavailable(err error) bool {
+	// Context errors also satisfy net.Error; they mean the caller gave up,
+	// not that the database is down.
+	if err == nil || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "08", // connection_exception
+			"53": // insufficient_resources, e.g. too_many_connections
+			return true
+		}
+		// admin_shutdown, crash_shutdown and cannot_connect_now
+		return strings.HasPrefix(string(pqErr.Code), "57P")
+	}
+
+	return false
+}
+
+// IsTimeout reports whether err means a query was stopped because it ran
+// past its deadline, either by the context or by Postgres' own
+// statement_timeout.
+func IsTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "57014" // query_canceled
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rsomcio/restapi/config"
+)
+
+// listenPingInterval is how often an idle listening connection is checked,
+// so that a connection lost without notice is noticed and replaced.
+const listenPingInterval = 30 * time.Second
+
+// Listener receives the notifications sent on a channel with NOTIFY, on a
+// connection of its own outside the pool. A lost connection is
+// re-established with the backoff of the connection settings.
+type Listener struct {
+	listener *pq.Listener
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// Listen listens on channel with the connection settings of cfg. Until
+// Close, notify is called with the payload of every notification, in the
+// order the notifying transactions committed, and connected is called once
+// listening starts and again after every reconnection, since notifications
+// sent while disconnected are lost. Both are called from one goroutine.
+func Listen(cfg config.Database, channel string, notify func(payload string), connected func()) (*Listener, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("database URL is required")
+	}
+	l := &Listener{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	l.listener = pq.NewListener(cfg.URL, cfg.ConnectBackoff, cfg.ConnectBackoffMax, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected:
+			logger.Warn("Lost database listener connection, reconnecting", "channel", channel, "error", err)
+		case pq.ListenerEventConnectionAttemptFailed:
+			logger.Warn("Failed to reconnect database listener", "channel", channel, "error", err)
+		case pq.ListenerEventReconnected:
+			logger.Info("Reconnected database listener", "channel", channel)
+		}
+	})
+	if err := l.listener.Listen(channel); err != nil {
+		l.listener.Close()
+		return nil, fmt.Errorf("failed to listen on %s: %w", channel, err)
+	}
+
+	go func() {
+		defer close(l.done)
+		connected()
+		ticker := time.NewTicker(listenPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case n := <-l.listener.Notify:
+				// A nil notification follows a reconnection.
+				if n == nil {
+					connected()
+				} else {
+					notify(n.Extra)
+				}
+			case <-ticker.C:
+				// Ping fails on a dead connection, which makes the
+				// listener reconnect.
+				go l.listener.Ping()
+			case <-l.stop:
+				return
+			}
+		}
+	}()
+	return l, nil
+}
+
+// Close stops listening and waits until the notification being handled, if
+// any, has been handled or ctx is done.
+func (l *Listener) Close(ctx context.Context) error {
+	close(l.stop)
+	select {
+	case <-l.done:
+	case <-ctx.Done():
+		return fmt.Errorf("database listener did not stop: %w", ctx.Err())
+	}
+	return l.listener.Close()
+}
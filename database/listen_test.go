@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rsomcio/restapi/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenWithoutDatabaseURL(t *testing.T) {
+	_, err := Listen(config.Database{}, "changes", func(string) {}, func() {})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "database URL is required")
+}
+
+func TestListenIntegration(t *testing.T) {
+	cfg := testConfig()
+	if cfg.URL == "" {
+		t.Skip("DATABASE_URL not set, skipping integration test")
+	}
+
+	ctx := context.Background()
+	require.NoError(t, Connect(ctx, cfg))
+	defer Close()
+
+	payloads := make(chan string, 10)
+	connected := make(chan struct{}, 10)
+	l, err := Listen(cfg, "listen_test", func(payload string) { payloads <- payload }, func() { connected <- struct{}{} })
+	require.NoError(t, err)
+	defer l.Close(ctx)
+
+	select {
+	case <-connected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener never reported connecting")
+	}
+
+	tx, err := DB.BeginTxx(ctx, nil)
+	require.NoError(t, err)
+	_, err = tx.Exec("SELECT pg_notify('listen_test', 'first'), pg_notify('listen_test', 'second')")
+	require.NoError(t, err)
+	select {
+	case payload := <-payloads:
+		t.Fatalf("notification %q delivered before commit", payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+	require.NoError(t, tx.Commit())
+
+	for _, want := range []string{"first", "second"} {
+		select {
+		case payload := <-payloads:
+			assert.Equal(t, want, payload)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("notification %q not delivered", want)
+		}
+	}
+}
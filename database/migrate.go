@@ -0,0 +1,245 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID identifies the advisory lock held while migrating, so that
+// instances starting together apply each migration once.
+const migrationLockID = 7325140293
+
+// Migration is a schema change. Up applies it and Down reverts it.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState is a migration and when it was applied, if it was.
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migrations returns the migrations built into the binary in version order.
+func Migrations() ([]Migration, error) {
+	return loadMigrations(migrationFiles, "migrations")
+}
+
+// loadMigrations reads dir, whose files are named like 0001_name.up.sql and
+// 0001_name.down.sql. Versions must run from 1 without gaps and each needs
+// both files.
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		m := migrationFile.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("migration %s: name must look like 0001_name.up.sql", entry.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		sql, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(sql)
+		} else {
+			mig.Down = string(sql)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, mig := range migrations {
+		if mig.Version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %d (%s) needs both an up and a down file", mig.Version, mig.Name)
+		}
+	}
+	return migrations, nil
+}
+
+// MigrateUp applies the migrations that have not been applied yet, in order
+// and each in its own transaction, and returns them.
+func MigrateUp(ctx context.Context) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	err = withMigrationLock(ctx, func(conn *sqlx.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := runMigration(ctx, conn, mig.Up,
+				"INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", mig.Version, mig.Name); err != nil {
+				return fmt.Errorf("failed to apply migration %d (%s): %w", mig.Version, mig.Name, err)
+			}
+			logger.Info("Applied migration", "version", mig.Version, "name", mig.Name)
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// MigrateDown reverts the steps most recently applied migrations, newest
+// first, and returns them.
+func MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	err = withMigrationLock(ctx, func(conn *sqlx.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		versions := make([]int, 0, len(applied))
+		for version := range applied {
+			versions = append(versions, version)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+		for _, version := range versions[:min(steps, len(versions))] {
+			if version > len(migrations) {
+				return fmt.Errorf("migration %d was applied by a newer version of this program, which must revert it", version)
+			}
+			mig := migrations[version-1]
+			if err := runMigration(ctx, conn, mig.Down,
+				"DELETE FROM schema_migrations WHERE version = $1", mig.Version); err != nil {
+				return fmt.Errorf("failed to revert migration %d (%s): %w", mig.Version, mig.Name, err)
+			}
+			logger.Info("Reverted migration", "version", mig.Version, "name", mig.Name)
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// MigrationStatus returns every migration built into the binary with when
+// it was applied.
+func MigrationStatus(ctx context.Context) ([]MigrationState, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, len(migrations))
+	err = withMigrationLock(ctx, func(conn *sqlx.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i, mig := range migrations {
+			states[i].Migration = mig
+			if at, ok := applied[mig.Version]; ok {
+				states[i].AppliedAt = &at
+			}
+		}
+		return nil
+	})
+	return states, err
+}
+
+// withMigrationLock runs fn on a connection holding the migration lock,
+// creating the schema_migrations table first if needed.
+func withMigrationLock(ctx context.Context, fn func(conn *sqlx.Conn) error) error {
+	conn, err := DB.Connx(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect for migrations: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("failed to take the migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+
+	_, err = conn.ExecContext(ctx, `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+func appliedMigrations(ctx context.Context, conn *sqlx.Conn) (map[int]time.Time, error) {
+	var rows []struct {
+		Version   int       `db:"version"`
+		AppliedAt time.Time `db:"applied_at"`
+	}
+	if err := conn.SelectContext(ctx, &rows, "SELECT version, applied_at FROM schema_migrations"); err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	applied := make(map[int]time.Time, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row.AppliedAt
+	}
+	return applied, nil
+}
+
+// runMigration runs sql and the bookkeeping statement record in one
+// transaction.
+func runMigration(ctx context.Context, conn *sqlx.Conn, sql, record string, args ...interface{}) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, sql); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
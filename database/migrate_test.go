@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationsAreComplete(t *testing.T) {
+	migrations, err := Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	assert.Equal(t, "create_events", migrations[0].Name)
+	for i, mig := range migrations {
+		assert.Equal(t, i+1, mig.Version)
+	}
+}
+
+func TestLoadMigrationsRejectsBadSets(t *testing.T) {
+	file := func(sql string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(sql)} }
+
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		err   string
+	}{
+		{"bad name", fstest.MapFS{"m/create.sql": file("")}, "migration create.sql: name must look like 0001_name.up.sql"},
+		{"missing down", fstest.MapFS{"m/0001_a.up.sql": file("SELECT 1")}, "migration 1 (a) needs both an up and a down file"},
+		{"gap", fstest.MapFS{"m/0002_b.up.sql": file("SELECT 1"), "m/0002_b.down.sql": file("SELECT 1")}, "migration 1 is missing"},
+		{"renamed", fstest.MapFS{"m/0001_a.up.sql": file("SELECT 1"), "m/0001_b.down.sql": file("SELECT 1")}, "migration 1 is named both a and b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadMigrations(tt.files, "m")
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+
+	migrations, err := loadMigrations(fstest.MapFS{
+		"m/0002_b.up.sql":   file("UP B"),
+		"m/0002_b.down.sql": file("DOWN B"),
+		"m/0001_a.down.sql": file("DOWN A"),
+		"m/0001_a.up.sql":   file("UP A"),
+	}, "m")
+	require.NoError(t, err)
+	assert.Equal(t, []Migration{
+		{Version: 1, Name: "a", Up: "UP A", Down: "DOWN A"},
+		{Version: 2, Name: "b", Up: "UP B", Down: "DOWN B"},
+	}, migrations)
+}
+
+func TestMigrateIntegration(t *testing.T) {
+	// Skip this test if no DATABASE_URL is set in environment
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("DATABASE_URL not set, skipping integration test")
+	}
+
+	if DB == nil {
+		require.NoError(t, Connect(context.Background(), testConfig()))
+	}
+	ctx := context.Background()
+	migrations, err := Migrations()
+	require.NoError(t, err)
+	latest := migrations[len(migrations)-1]
+
+	_, err = MigrateUp(ctx)
+	require.NoError(t, err)
+	ready, err := SchemaReady(ctx)
+	require.NoError(t, err)
+	assert.True(t, ready)
+
+	reverted, err := MigrateDown(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []Migration{latest}, reverted)
+	ready, err = SchemaReady(ctx)
+	require.NoError(t, err)
+	assert.False(t, ready)
+
+	states, err := MigrationStatus(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, states[len(states)-1].AppliedAt)
+	assert.NotNil(t, states[0].AppliedAt)
+
+	applied, err := MigrateUp(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []Migration{latest}, applied)
+}
@@ -0,0 +1,15 @@
+-- IF NOT EXISTS adopts databases created before migrations were tracked.
+CREATE TABLE IF NOT EXISTS events (
+	id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	description TEXT,
+	venue_name VARCHAR(255) NOT NULL,
+	address TEXT NOT NULL,
+	date DATE NOT NULL,
+	time TIME NOT NULL,
+	contact_mobile VARCHAR(20),
+	contact_email VARCHAR(255),
+	contact_instagram VARCHAR(100),
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,8 @@
+CREATE TABLE api_keys (
+	id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	prefix VARCHAR(16) NOT NULL,
+	key_hash BYTEA NOT NULL UNIQUE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP WITH TIME ZONE
+);
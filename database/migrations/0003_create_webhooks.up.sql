@@ -0,0 +1,26 @@
+CREATE TABLE webhooks (
+	id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+	url TEXT NOT NULL,
+	event_types TEXT[] NOT NULL DEFAULT '{}',
+	secret VARCHAR(255) NOT NULL,
+	enabled BOOLEAN NOT NULL DEFAULT TRUE,
+	consecutive_failures INTEGER NOT NULL DEFAULT 0,
+	disabled_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE webhook_deliveries (
+	id BIGSERIAL PRIMARY KEY,
+	webhook_id UUID NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+	message_id UUID NOT NULL,
+	event_type VARCHAR(50) NOT NULL,
+	attempt INTEGER NOT NULL,
+	status_code INTEGER,
+	error TEXT,
+	duration_ms INTEGER NOT NULL,
+	delivered BOOLEAN NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id, id);
@@ -0,0 +1,15 @@
+CREATE TABLE outbox (
+	seq BIGSERIAL PRIMARY KEY,
+	id UUID NOT NULL DEFAULT gen_random_uuid(),
+	type VARCHAR(50) NOT NULL,
+	event_id UUID NOT NULL,
+	payload JSONB NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_error TEXT,
+	published_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX outbox_pending ON outbox (event_id, seq) WHERE published_at IS NULL;
+CREATE INDEX outbox_published ON outbox (published_at) WHERE published_at IS NOT NULL;
@@ -0,0 +1 @@
+CREATE INDEX webhook_deliveries_created_at ON webhook_deliveries (created_at);
@@ -0,0 +1 @@
+CREATE INDEX webhook_deliveries_message_id ON webhook_deliveries (message_id);
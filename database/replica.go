@@ -0,0 +1,251 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rsomcio/restapi/config"
+)
+
+// replica is one read-only pool and whether its last health check passed.
+type replica struct {
+	name    string
+	db      *sqlx.DB
+	healthy atomic.Bool
+}
+
+// replicaSet spreads reads over healthy replicas and remembers which
+// clients wrote recently so that they keep reading from the primary until
+// replication has caught up.
+type replicaSet struct {
+	replicas []*replica
+	next     atomic.Uint64
+	window   time.Duration
+
+	mu     sync.Mutex
+	writes map[string]time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// replicas is nil when no read replicas are configured, in which case every
+// query goes to DB.
+var replicas *replicaSet
+
+// ConnectReplicas opens a pool for every replica in cfg.ReplicaURLs and
+// starts checking their health every cfg.ReplicaCheckInterval. A replica
+// that is down at startup is not an error; it receives reads once a check
+// succeeds.
+func ConnectReplicas(ctx context.Context, cfg config.Database) error {
+	if len(cfg.ReplicaURLs) == 0 {
+		return nil
+	}
+
+	set := &replicaSet{
+		window: cfg.ReadYourWritesWindow,
+		writes: make(map[string]time.Time),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	names := replicaNames(cfg.ReplicaURLs)
+	for i, u := range cfg.ReplicaURLs {
+		db, err := open(u, cfg)
+		if err != nil {
+			set.close()
+			return fmt.Errorf("failed to open replica %d: %w", i, err)
+		}
+		set.replicas = append(set.replicas, &replica{name: names[i], db: db})
+	}
+
+	set.check(ctx, cfg.ReplicaCheckInterval)
+	go set.run(cfg.ReplicaCheckInterval)
+
+	replicas = set
+	logger.Info("Configured read replicas", "count", len(set.replicas), "read_your_writes_window", cfg.ReadYourWritesWindow.String())
+	return nil
+}
+
+// replicaName identifies a replica in logs and metrics without leaking
+// credentials.
+func replicaName(i int, dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Host != "" {
+		if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+			return u.Host + "/" + db
+		}
+		return u.Host
+	}
+	return fmt.Sprintf("replica-%d", i)
+}
+
+// replicaNames names every replica in dsns, adding the index to names that
+// are shared so that each replica is reported, and its pool registered with
+// metrics, separately.
+func replicaNames(dsns []string) []string {
+	names := make([]string, len(dsns))
+	counts := make(map[string]int)
+	for i, dsn := range dsns {
+		names[i] = replicaName(i, dsn)
+		counts[names[i]]++
+	}
+	for i, name := range names {
+		if counts[name] > 1 {
+			names[i] = fmt.Sprintf("%s#%d", name, i)
+		}
+	}
+	return names
+}
+
+// Reader returns the pool that read-only queries for client should use: the
+// next healthy replica in round-robin order, or the primary when there are
+// no healthy replicas or client wrote within the read-your-writes window.
+func Reader(client string) *sqlx.DB {
+	if replicas == nil {
+		return DB
+	}
+	if db := replicas.reader(client, time.Now()); db != nil {
+		return db
+	}
+	return DB
+}
+
+// RecordWrite notes that client has just modified data, pinning its reads
+// to the primary for the read-your-writes window.
+func RecordWrite(client string) {
+	if replicas != nil {
+		replicas.recordWrite(client, time.Now())
+	}
+}
+
+// ReplicaStatus reports the health of each replica by name.
+func ReplicaStatus() map[string]bool {
+	status := make(map[string]bool)
+	if replicas == nil {
+		return status
+	}
+	for _, r := range replicas.replicas {
+		status[r.name] = r.healthy.Load()
+	}
+	return status
+}
+
+// ReplicaPools returns each replica's pool by name, for metrics.
+func ReplicaPools() map[string]*sqlx.DB {
+	pools := make(map[string]*sqlx.DB)
+	if replicas == nil {
+		return pools
+	}
+	for _, r := range replicas.replicas {
+		pools[r.name] = r.db
+	}
+	return pools
+}
+
+func (s *replicaSet) reader(client string, now time.Time) *sqlx.DB {
+	if s.wroteRecently(client, now) {
+		return nil
+	}
+
+	healthy := make([]*sqlx.DB, 0, len(s.replicas))
+	for _, r := range s.replicas {
+		if r.healthy.Load() {
+			healthy = append(healthy, r.db)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+	return healthy[s.next.Add(1)%uint64(len(healthy))]
+}
+
+func (s *replicaSet) recordWrite(client string, now time.Time) {
+	if s.window <= 0 || client == "" {
+		return
+	}
+	s.mu.Lock()
+	s.writes[client] = now
+	s.mu.Unlock()
+}
+
+func (s *replicaSet) wroteRecently(client string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	at, ok := s.writes[client]
+	return ok && now.Sub(at) < s.window
+}
+
+// forgetWrites drops clients whose window has passed so the map stays
+// bounded by the number of recent writers.
+func (s *replicaSet) forgetWrites(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for client, at := range s.writes {
+		if now.Sub(at) >= s.window {
+			delete(s.writes, client)
+		}
+	}
+}
+
+// check pings every replica, ejecting those that fail and restoring those
+// that recover.
+func (s *replicaSet) check(ctx context.Context, timeout time.Duration) {
+	for _, r := range s.replicas {
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := r.db.PingContext(pingCtx)
+		cancel()
+
+		healthy := err == nil
+		if was := r.healthy.Swap(healthy); was != healthy {
+			if healthy {
+				logger.Info("Replica healthy, routing reads to it", "replica", r.name)
+			} else {
+				logger.Warn("Replica unhealthy, ejecting it", "replica", r.name, "error", err)
+			}
+		}
+	}
+}
+
+func (s *replicaSet) run(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-s.stop
+		cancel()
+	}()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.check(ctx, interval)
+			s.forgetWrites(time.Now())
+		}
+	}
+}
+
+func (s *replicaSet) close() {
+	for _, r := range s.replicas {
+		r.db.Close()
+	}
+}
+
+func closeReplicas() {
+	if replicas == nil {
+		return
+	}
+	close(replicas.stop)
+	<-replicas.done
+	replicas.close()
+	replicas = nil
+}
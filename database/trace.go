@@ -0,0 +1,161 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/rsomcio/restapi/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	literalPattern    = regexp.MustCompile(`\$\d+|'(?:[^']|'')*'|\b\d+(?:\.\d+)?\b`)
+	whitespacePattern = regexp.MustCompile(`\s+`)
+)
+
+// sanitizeStatement collapses whitespace and replaces string and numeric
+// literals with ? so that span attributes never carry user data. Bind
+// parameters such as $1 are kept.
+func sanitizeStatement(query string) string {
+	query = literalPattern.ReplaceAllStringFunc(query, func(m string) string {
+		if strings.HasPrefix(m, "$") {
+			return m
+		}
+		return "?"
+	})
+	return strings.TrimSpace(whitespacePattern.ReplaceAllString(query, " "))
+}
+
+// tracedConnector wraps a driver.Connector so that every connection it
+// opens records a client span per query and exec.
+type tracedConnector struct {
+	driver.Connector
+}
+
+func (tc tracedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := tc.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{Conn: conn}, nil
+}
+
+type tracedConn struct {
+	driver.Conn
+}
+
+func startQuerySpan(ctx context.Context, name, query string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBQueryText(sanitizeStatement(query)),
+		),
+	)
+}
+
+func endSpanWithError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	span.End()
+}
+
+func (tc *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := tc.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, span := startQuerySpan(ctx, "db.query", query)
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err != nil {
+		endSpanWithError(span, err)
+		return nil, err
+	}
+	return &tracedRows{Rows: rows, span: span}, nil
+}
+
+func (tc *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := tc.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, span := startQuerySpan(ctx, "db.exec", query)
+	result, err := execer.ExecContext(ctx, query, args)
+	if err != nil {
+		endSpanWithError(span, err)
+		return nil, err
+	}
+	if n, err := result.RowsAffected(); err == nil {
+		span.SetAttributes(attribute.Int64("db.rows_affected", n))
+	}
+	span.End()
+	return result, nil
+}
+
+func (tc *tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := tc.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return tc.Conn.Prepare(query)
+}
+
+func (tc *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := tc.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return tc.Conn.Begin()
+}
+
+func (tc *tracedConn) Ping(ctx context.Context) error {
+	if pinger, ok := tc.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (tc *tracedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := tc.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (tc *tracedConn) IsValid() bool {
+	if validator, ok := tc.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+// tracedRows ends the query span once the rows are closed, recording how
+// many were read.
+type tracedRows struct {
+	driver.Rows
+	span  trace.Span
+	count int64
+}
+
+func (tr *tracedRows) Next(dest []driver.Value) error {
+	err := tr.Rows.Next(dest)
+	if err == nil {
+		tr.count++
+	} else if err != io.EOF {
+		tr.span.RecordError(err)
+		tr.span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+func (tr *tracedRows) Close() error {
+	tr.span.SetAttributes(attribute.Int64("db.rows_returned", tr.count))
+	tr.span.End()
+	return tr.Rows.Close()
+}
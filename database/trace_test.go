@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/rsomcio/restapi/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// fakeConnector serves canned results so that tracing can be tested without
+// a Postgres server.
+type fakeConnector struct{}
+
+func (fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn{}, nil }
+func (fakeConnector) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (fakeConn) Close() error                        { return nil }
+func (fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	if query == "SELECT broken" {
+		return nil, errors.New("syntax error")
+	}
+	return &fakeRows{remaining: 3}, nil
+}
+
+func (fakeConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(2), nil
+}
+
+type fakeRows struct {
+	remaining int
+}
+
+func (r *fakeRows) Columns() []string { return []string{"id"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.remaining == 0 {
+		return io.EOF
+	}
+	r.remaining--
+	dest[0] = int64(r.remaining)
+	return nil
+}
+
+func TestSanitizeStatement(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"SELECT id FROM events WHERE id = $1", "SELECT id FROM events WHERE id = $1"},
+		{"SELECT *\n\t\tFROM events   WHERE name = 'Jazz Night' LIMIT 10", "SELECT * FROM events WHERE name = ? LIMIT ?"},
+		{"UPDATE events SET name = 'it''s' WHERE id = $2", "UPDATE events SET name = ? WHERE id = $2"},
+		{"SELECT 1.5 FROM events_2024", "SELECT ? FROM events_2024"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			assert.Equal(t, tt.expected, sanitizeStatement(tt.query))
+		})
+	}
+}
+
+func TestTracedQueriesRecordSpans(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp)))
+
+	db := sql.OpenDB(tracedConnector{fakeConnector{}})
+	defer db.Close()
+
+	ctx, parent := tracing.Tracer().Start(context.Background(), "parent")
+
+	rows, err := db.QueryContext(ctx, "SELECT id FROM events WHERE name = 'secret'")
+	require.NoError(t, err)
+	for rows.Next() {
+	}
+	require.NoError(t, rows.Close())
+
+	_, err = db.ExecContext(ctx, "DELETE FROM events WHERE id = $1", "abc")
+	require.NoError(t, err)
+
+	_, err = db.QueryContext(ctx, "SELECT broken")
+	require.Error(t, err)
+
+	parent.End()
+
+	spans := exp.GetSpans()
+	require.Len(t, spans, 4)
+
+	query, exec, failed := spans[0], spans[1], spans[2]
+
+	assert.Equal(t, "db.query", query.Name)
+	assert.Equal(t, parent.SpanContext().SpanID(), query.Parent.SpanID())
+	assert.Contains(t, query.Attributes, semconv.DBSystemPostgreSQL)
+	assert.Contains(t, query.Attributes, semconv.DBQueryText("SELECT id FROM events WHERE name = ?"))
+	assert.Contains(t, query.Attributes, attribute.Int64("db.rows_returned", 3))
+
+	assert.Equal(t, "db.exec", exec.Name)
+	assert.Contains(t, exec.Attributes, attribute.Int64("db.rows_affected", 2))
+
+	assert.Equal(t, codes.Error, failed.Status.Code)
+}
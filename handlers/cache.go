@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/rsomcio/restapi/cache"
+	"github.com/rsomcio/restapi/database"
+	"github.com/rsomcio/restapi/logging"
+	"github.com/rsomcio/restapi/models"
+)
+
+// CacheHeader reports whether a read was served from the cache (HIT) or
+// stored in it (MISS).
+const CacheHeader = "X-Cache"
+
+// generationKey holds a counter that every mutation increments. Cached reads
+// are stored under the generation current when their query started, so a
+// write makes all earlier entries unreachable at once, including ones that
+// slower readers store after the write.
+const generationKey = "events:generation"
+
+var (
+	responseCache cache.Cache
+	cacheTTL      time.Duration
+)
+
+// SetCache caches event reads in c for ttl. A nil c disables caching.
+func SetCache(c cache.Cache, ttl time.Duration) {
+	responseCache = c
+	cacheTTL = ttl
+}
+
+type cachedResponse struct {
+	Body         json.RawMessage `json:"body"`
+	LastModified time.Time       `json:"last_modified"`
+}
+
+// listCacheKey identifies a list request by its query parameters, sorted so
+// that equivalent query strings share an entry.
+func listCacheKey(c *fiber.Ctx) string {
+	query := string(c.Request().URI().QueryString())
+	if values, err := url.ParseQuery(query); err == nil {
+		for _, v := range values {
+			sort.Strings(v)
+		}
+		query = values.Encode()
+	}
+	return cacheKey(c, "list:"+query)
+}
+
+func eventCacheKey(c *fiber.Ctx, id string) string {
+	return cacheKey(c, "event:"+id)
+}
+
+// cacheKey prefixes name with the current generation. It returns "" when
+// caching is off or the generation cannot be read, which skips the cache.
+func cacheKey(c *fiber.Ctx, name string) string {
+	if responseCache == nil {
+		return ""
+	}
+	generation, ok, err := responseCache.Get(c.UserContext(), generationKey)
+	if err != nil {
+		logging.Ctx(c, logger).Warn("Cache unavailable", "error", err)
+		return ""
+	}
+	if !ok {
+		generation = []byte("0")
+	}
+	return "events:" + string(generation) + ":" + name
+}
+
+// primaryOnly returns key if db is the primary and "" otherwise, which skips
+// storing the response. A replica may not have the latest write yet, and
+// its answer, once cached, would be served to everyone, the writer
+// included, until it expired.
+func primaryOnly(db *sqlx.DB, key string) string {
+	if db != database.DB {
+		return ""
+	}
+	return key
+}
+
+// serveCached writes the response stored under key, if there is one, and
+// reports whether it did.
+func serveCached(c *fiber.Ctx, key string) bool {
+	if key == "" {
+		return false
+	}
+
+	data, ok, err := responseCache.Get(c.UserContext(), key)
+	if err != nil {
+		logging.Ctx(c, logger).Warn("Cache unavailable", "error", err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+
+	var cached cachedResponse
+	if err := json.Unmarshal(data, &cached); err != nil {
+		logging.Ctx(c, logger).Warn("Discarding malformed cache entry", "key", key, "error", err)
+		return false
+	}
+
+	setCacheHeaders(c, cached.LastModified)
+	c.Set(CacheHeader, "HIT")
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(cached.Body) == nil
+}
+
+// sendCacheable renders v as the JSON response and stores it under key. Cache
+// failures are logged and otherwise ignored.
+func sendCacheable(c *fiber.Ctx, key string, v interface{}, lastModified time.Time) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	setCacheHeaders(c, lastModified)
+	if key != "" {
+		data, err := json.Marshal(cachedResponse{Body: body, LastModified: lastModified})
+		if err == nil {
+			err = responseCache.Set(c.UserContext(), key, data, cacheTTL)
+		}
+		if err != nil {
+			logging.Ctx(c, logger).Warn("Failed to cache response", "key", key, "error", err)
+		}
+		c.Set(CacheHeader, "MISS")
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(body)
+}
+
+// setCacheHeaders lets clients reuse a read for as long as the server would.
+// Reads made with an API key may only be reused by the client, not by shared
+// caches that would hand them to callers without one.
+func setCacheHeaders(c *fiber.Ctx, lastModified time.Time) {
+	if responseCache != nil {
+		scope := "public"
+		if c.Locals(logging.PrincipalKey) != nil {
+			scope = "private"
+		}
+		c.Set(fiber.HeaderCacheControl, scope+", max-age="+strconv.Itoa(int(cacheTTL.Seconds())))
+	} else {
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+	}
+	if !lastModified.IsZero() {
+		c.Set(fiber.HeaderLastModified, lastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// invalidateEvents makes every cached event read stale after a mutation, so
+// that the writer reads its own write.
+func invalidateEvents(c *fiber.Ctx) {
+	if err := incrGeneration(c.UserContext()); err != nil {
+		logging.Ctx(c, logger).Error("Failed to invalidate cached events", "error", err)
+	}
+}
+
+// InvalidateEvents makes every cached event read stale. It is called for
+// each change passed on by the outbox feed, so that instances with a cache
+// of their own drop reads made stale by the changes of other instances.
+func InvalidateEvents(ctx context.Context) {
+	if err := incrGeneration(ctx); err != nil {
+		logger.Error("Failed to invalidate cached events", "error", err)
+	}
+}
+
+func incrGeneration(ctx context.Context) error {
+	if responseCache == nil {
+		return nil
+	}
+	_, err := responseCache.Incr(ctx, generationKey)
+	return err
+}
+
+// lastModified returns the latest updated_at of events.
+func lastModified(events []models.Event) time.Time {
+	var latest time.Time
+	for _, event := range events {
+		if event.UpdatedAt.After(latest) {
+			latest = event.UpdatedAt
+		}
+	}
+	return latest
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/rsomcio/restapi/cache"
+	"github.com/rsomcio/restapi/database"
+	"github.com/rsomcio/restapi/logging"
+	"github.com/rsomcio/restapi/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func useCache(t *testing.T, ttl time.Duration) {
+	t.Helper()
+	SetCache(cache.NewMemory(100), ttl)
+	t.Cleanup(func() { SetCache(nil, 0) })
+}
+
+func TestListCacheKeyNormalizesQuery(t *testing.T) {
+	useCache(t, time.Minute)
+
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(listCacheKey(c))
+	})
+
+	key := func(query string) string {
+		resp, err := app.Test(httptest.NewRequest("GET", "/"+query, nil))
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	assert.Equal(t, key("?venue=Hall&from=2024-01-01"), key("?from=2024-01-01&venue=Hall"))
+	assert.Equal(t, key("?tag=b&tag=a"), key("?tag=a&tag=b"))
+	assert.NotEqual(t, key("?venue=Hall"), key("?venue=Arena"))
+	assert.Equal(t, "events:0:list:", key(""))
+}
+
+func TestCachedEventReads(t *testing.T) {
+	useCache(t, time.Minute)
+
+	updated := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+	events := []models.Event{
+		{ID: "1", Name: "Older", UpdatedAt: updated.Add(-time.Hour)},
+		{ID: "2", Name: "Newer", UpdatedAt: updated},
+	}
+
+	// Reads reaching the database would panic on the nil pool, so every
+	// request to /api/events below must be served from the cache.
+	app := setupTestApp()
+	app.Get("/seed", func(c *fiber.Ctx) error {
+		return sendCacheable(c, listCacheKey(c), events, lastModified(events))
+	})
+	app.Post("/invalidate", func(c *fiber.Ctx) error {
+		invalidateEvents(c)
+		return c.SendStatus(204)
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/seed", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "MISS", resp.Header.Get(CacheHeader))
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/api/events", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "HIT", resp.Header.Get(CacheHeader))
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "public, max-age=60", resp.Header.Get("Cache-Control"))
+	assert.Equal(t, updated.Format(http.TimeFormat), resp.Header.Get("Last-Modified"))
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), `"name":"Newer"`)
+
+	_, err = app.Test(httptest.NewRequest("POST", "/invalidate", nil))
+	require.NoError(t, err)
+
+	events = events[:1]
+	_, err = app.Test(httptest.NewRequest("GET", "/seed", nil))
+	require.NoError(t, err)
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/api/events", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "HIT", resp.Header.Get(CacheHeader))
+	assert.Equal(t, updated.Add(-time.Hour).Format(http.TimeFormat), resp.Header.Get("Last-Modified"))
+	body, _ = io.ReadAll(resp.Body)
+	assert.NotContains(t, string(body), `"name":"Newer"`)
+}
+
+func TestCacheFillsOnlyFromPrimary(t *testing.T) {
+	assert.Equal(t, "events:0:list:", primaryOnly(database.DB, "events:0:list:"))
+	assert.Empty(t, primaryOnly(&sqlx.DB{}, "events:0:list:"), "replicas may lag behind the write that invalidated the cache")
+}
+
+func TestCachedReadsWithAPIKeyArePrivate(t *testing.T) {
+	useCache(t, time.Minute)
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals(logging.PrincipalKey, "key-1")
+		return c.Next()
+	})
+	app.Get("/", func(c *fiber.Ctx) error {
+		return sendCacheable(c, listCacheKey(c), []models.Event{}, time.Time{})
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "private, max-age=60", resp.Header.Get("Cache-Control"))
+}
+
+func TestInvalidateEventsFromFeed(t *testing.T) {
+	useCache(t, time.Minute)
+
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(listCacheKey(c))
+	})
+	key := func() string {
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	before := key()
+	InvalidateEvents(context.Background())
+	assert.NotEqual(t, before, key())
+}
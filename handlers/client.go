@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rsomcio/restapi/logging"
+)
+
+// APIKeyHeader carries the caller's API key, when it has one.
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyProtocolPrefix marks the WebSocket subprotocol that carries the
+// caller's API key, for browsers, which cannot add headers to a WebSocket
+// handshake. The key follows the prefix.
+const APIKeyProtocolPrefix = "apikey."
+
+// APIKey returns the API key the caller sent in APIKeyHeader or as a
+// subprotocol of a WebSocket handshake, or "" if it sent none.
+func APIKey(c *fiber.Ctx) string {
+	if key := c.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	for _, header := range c.Request().Header.PeekAll(fiber.HeaderSecWebSocketProtocol) {
+		for _, protocol := range strings.Split(string(header), ",") {
+			if key, ok := strings.CutPrefix(strings.TrimSpace(protocol), APIKeyProtocolPrefix); ok {
+				return key
+			}
+		}
+	}
+	return ""
+}
+
+var trustedProxies []*net.IPNet
+
+// SetTrustedProxies sets the addresses or CIDR ranges of the proxies whose
+// X-Forwarded-For header is believed when identifying clients.
+func SetTrustedProxies(proxies []string) error {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		n, err := parseProxy(proxy)
+		if err != nil {
+			return err
+		}
+		nets = append(nets, n)
+	}
+	trustedProxies = nets
+	return nil
+}
+
+func parseProxy(proxy string) (*net.IPNet, error) {
+	if strings.Contains(proxy, "/") {
+		_, n, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		return n, nil
+	}
+	ip := net.ParseIP(proxy)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+	}
+	bits := 8 * len(ip)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+func trusted(ip net.IP) bool {
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientKey identifies the caller for per-client state such as rate limits
+// and read-your-writes routing: the ID of its API key once the key has been
+// verified, otherwise its IP. Unverified keys are ignored, since a client
+// could send a new one with each request to get fresh state.
+func ClientKey(c *fiber.Ctx) string {
+	if principal, ok := c.Locals(logging.PrincipalKey).(string); ok && principal != "" {
+		return "key:" + principal
+	}
+	return "ip:" + ClientIP(c)
+}
+
+// ClientIPKey identifies the caller by its IP alone, for limits applied
+// before its API key is verified.
+func ClientIPKey(c *fiber.Ctx) string {
+	return "ip:" + ClientIP(c)
+}
+
+// ClientIP returns the address of the caller. When the request arrives from
+// a trusted proxy, X-Forwarded-For is walked from the right, skipping
+// trusted proxies, and the first other address is the client; entries to
+// its left were supplied by the client and cannot be believed.
+func ClientIP(c *fiber.Ctx) string {
+	remote := c.Context().RemoteIP()
+	if !trusted(remote) {
+		return remote.String()
+	}
+
+	var hops []string
+	for _, header := range c.Request().Header.PeekAll(fiber.HeaderXForwardedFor) {
+		hops = append(hops, strings.Split(string(header), ",")...)
+	}
+
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		client = ip
+		if !trusted(ip) {
+			break
+		}
+	}
+	return client.String()
+}
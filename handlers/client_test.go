@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rsomcio/restapi/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientKey(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		if principal := c.Get("X-Principal"); principal != "" {
+			c.Locals(logging.PrincipalKey, principal)
+		}
+		return c.SendString(ClientKey(c))
+	})
+
+	key := func(trusted []string, headers map[string]string) string {
+		require.NoError(t, SetTrustedProxies(trusted))
+		t.Cleanup(func() { SetTrustedProxies(nil) })
+
+		req := httptest.NewRequest("GET", "/", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	// app.Test connects from 0.0.0.0.
+	assert.Equal(t, "key:key-1", key(nil, map[string]string{"X-Principal": "key-1", APIKeyHeader: "secret"}))
+	assert.Equal(t, "ip:0.0.0.0", key(nil, map[string]string{APIKeyHeader: "secret"}),
+		"unverified keys do not identify the client")
+	assert.Equal(t, "ip:0.0.0.0", key(nil, map[string]string{"X-Forwarded-For": "203.0.113.7"}),
+		"X-Forwarded-For from an untrusted peer is ignored")
+	assert.Equal(t, "ip:203.0.113.7", key([]string{"0.0.0.0"}, map[string]string{"X-Forwarded-For": "203.0.113.7"}))
+	assert.Equal(t, "ip:203.0.113.7", key([]string{"0.0.0.0", "10.0.0.0/8"}, map[string]string{"X-Forwarded-For": "198.51.100.1, 203.0.113.7, 10.1.2.3"}),
+		"addresses left of the first untrusted hop were supplied by the client")
+	assert.Equal(t, "ip:0.0.0.0", key([]string{"0.0.0.0"}, map[string]string{"X-Forwarded-For": "garbage"}))
+
+	assert.Error(t, SetTrustedProxies([]string{"proxy.internal"}))
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/rsomcio/restapi/apierror"
+	"github.com/rsomcio/restapi/database"
+)
+
+// databaseError maps a failed query to an API error. A missing row is a 404,
+// constraint and input violations reported by Postgres are the client's
+// fault, a query cut off by its time limit is a 504 and losing the database
+// is a 503. Anything else is reported as detail with a 500.
+func databaseError(detail string, err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return apierror.NotFound("Event not found")
+	}
+
+	if database.IsTimeout(err) {
+		return apierror.Timeout("Database query timed out", err)
+	}
+	if errors.Is(err, context.Canceled) {
+		return apierror.Unavailable("Request cancelled", err)
+	}
+
+	if database.IsUnavailable(err) {
+		return apierror.Unavailable("Database unavailable", err)
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "22": // data_exception, e.g. value too long or malformed input
+			e := apierror.BadRequest(pqErr.Message)
+			e.Cause = err
+			return e
+		case "23": // integrity_constraint_violation
+			e := apierror.Conflict(pqErr.Message)
+			e.Cause = err
+			return e
+		}
+	}
+	return apierror.Internal(detail, err)
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+	"github.com/rsomcio/restapi/apierror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatabaseError(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+	}{
+		{"no rows", fmt.Errorf("get: %w", sql.ErrNoRows), 404},
+		{"connection refused", &pq.Error{Code: "08006"}, 503},
+		{"connection closed", sql.ErrConnDone, 503},
+		{"deadline exceeded", fmt.Errorf("query: %w", context.DeadlineExceeded), 504},
+		{"statement timeout", &pq.Error{Code: "57014"}, 504},
+		{"request cancelled", context.Canceled, 503},
+		{"value too long", &pq.Error{Code: "22001", Message: "value too long for type character varying(20)"}, 400},
+		{"unique violation", &pq.Error{Code: "23505", Message: "duplicate key value"}, 409},
+		{"syntax error", &pq.Error{Code: "42601"}, 500},
+		{"unknown error", errors.New("boom"), 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := databaseError("Failed to fetch event", tt.err)
+
+			var apiErr *apierror.Error
+			assert.True(t, errors.As(err, &apiErr))
+			assert.Equal(t, tt.expectedStatus, apiErr.Status)
+		})
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	app := fiber.New(fiber.Config{
+		ErrorHandler: apierror.Handler(apierror.Options{}),
+	})
+	app.Get("/slow", QueryTimeout(10*time.Millisecond), func(c *fiber.Ctx) error {
+		<-c.UserContext().Done()
+		return databaseError("Failed to fetch events", c.UserContext().Err())
+	})
+	app.Get("/unbounded", QueryTimeout(0), func(c *fiber.Ctx) error {
+		_, ok := c.UserContext().Deadline()
+		assert.False(t, ok)
+		return c.SendStatus(204)
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/slow", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 504, resp.StatusCode)
+
+	var problem apierror.Problem
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&problem))
+	assert.Equal(t, apierror.TypeBaseURI+"timeout", problem.Type)
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/unbounded", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 204, resp.StatusCode)
+}
@@ -1,80 +1,88 @@
 package handlers
 
 import (
-	"log"
-	"regexp"
-	"runtime"
+	"context"
+	"log/slog"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/rsomcio/restapi/apierror"
 	"github.com/rsomcio/restapi/database"
+	"github.com/rsomcio/restapi/logging"
+	"github.com/rsomcio/restapi/metrics"
 	"github.com/rsomcio/restapi/models"
-	"gopkg.in/go-playground/validator.v9"
+	"github.com/rsomcio/restapi/outbox"
 )
 
-var validate *validator.Validate
+var logger = slog.Default()
 
-func init() {
-	validate = validator.New()
+// SetLogger replaces the logger used by the handlers. Request-scoped fields
+// are added to it for every line.
+func SetLogger(l *slog.Logger) {
+	logger = l
 }
 
-func logError(msg string, args ...interface{}) {
-	_, file, line, ok := runtime.Caller(1)
-	if ok {
-		log.Printf("[%s:%d] "+msg, append([]interface{}{file, line}, args...)...)
-	} else {
-		log.Printf(msg, args...)
-	}
-}
+var relay *outbox.Relay
 
-func logInfo(msg string, args ...interface{}) {
-	_, file, line, ok := runtime.Caller(1)
-	if ok {
-		log.Printf("[%s:%d] "+msg, append([]interface{}{file, line}, args...)...)
-	} else {
-		log.Printf(msg, args...)
-	}
+// SetRelay sets the outbox relay woken after each change to an event, so
+// that the change is published without waiting for its next poll. A nil r
+// leaves the change to be found by polling.
+func SetRelay(r *outbox.Relay) {
+	relay = r
 }
 
-func validateEmail(email string) bool {
-	if email == "" {
-		return true
+// writeEvent runs write, which changes an event, in a transaction that also
+// records the change in the outbox as eventType. The change reaches the
+// streams of every instance, this one included, through the outbox feed.
+func writeEvent(c *fiber.Ctx, eventType string, write func(tx *sqlx.Tx) (models.Event, error)) (models.Event, error) {
+	ctx := c.UserContext()
+	tx, err := database.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return models.Event{}, err
 	}
-	emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-	return emailRegex.MatchString(email)
-}
+	defer tx.Rollback()
 
-func validateDateFormat(date string) bool {
-	_, err := time.Parse("2006-01-02", date)
-	return err == nil
+	event, err := write(tx)
+	if err != nil {
+		return models.Event{}, err
+	}
+	if err := outbox.Write(ctx, tx, eventType, event); err != nil {
+		return models.Event{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.Event{}, err
+	}
+	if relay != nil {
+		relay.Wake()
+	}
+	return event, nil
 }
 
-func validateTimeFormat(timeStr string) bool {
-	_, err := time.Parse("15:04:05", timeStr)
-	return err == nil
+// QueryTimeout bounds the queries issued while handling a request to d,
+// after which they are cancelled and the request fails with 504. A zero d
+// leaves them unbounded.
+func QueryTimeout(d time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if d <= 0 {
+			return c.Next()
+		}
+		ctx, cancel := context.WithTimeout(c.UserContext(), d)
+		defer cancel()
+		c.SetUserContext(ctx)
+		return c.Next()
+	}
 }
 
 func CreateEvent(c *fiber.Ctx) error {
 	var req models.CreateEventRequest
 	if err := c.BodyParser(&req); err != nil {
-		logError("Error parsing request body: %v", err)
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+		logging.Ctx(c, logger).Warn("Error parsing request body", "error", err)
+		return apierror.BadRequest("Invalid request body")
 	}
 
-	if req.Name == "" || req.VenueName == "" || req.Address == "" || req.Date == "" || req.Time == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "Name, venue_name, address, date, and time are required"})
-	}
-
-	if !validateDateFormat(req.Date) {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid date format. Use YYYY-MM-DD format"})
-	}
-
-	if !validateTimeFormat(req.Time) {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid time format. Use HH:MM:SS format"})
-	}
-
-	if req.ContactEmail != nil && !validateEmail(*req.ContactEmail) {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid email format"})
+	if fields := validateStruct(req); fields != nil {
+		return apierror.Validation(fields)
 	}
 
 	query := `
@@ -82,86 +90,90 @@ func CreateEvent(c *fiber.Ctx) error {
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		RETURNING id, name, description, venue_name, address, date, time, contact_mobile, contact_email, contact_instagram, created_at, updated_at`
 
-	var event models.Event
-	err := database.DB.QueryRow(query, req.Name, req.Description, req.VenueName, req.Address, req.Date, req.Time, req.ContactMobile, req.ContactEmail, req.ContactInstagram).Scan(
-		&event.ID, &event.Name, &event.Description, &event.VenueName, &event.Address, &event.Date, &event.Time, &event.ContactMobile, &event.ContactEmail, &event.ContactInstagram, &event.CreatedAt, &event.UpdatedAt)
+	event, err := writeEvent(c, models.EventCreated, func(tx *sqlx.Tx) (event models.Event, err error) {
+		err = tx.QueryRowContext(c.UserContext(), query, req.Name, req.Description, req.VenueName, req.Address, req.Date, req.Time, req.ContactMobile, req.ContactEmail, req.ContactInstagram).Scan(
+			&event.ID, &event.Name, &event.Description, &event.VenueName, &event.Address, &event.Date, &event.Time, &event.ContactMobile, &event.ContactEmail, &event.ContactInstagram, &event.CreatedAt, &event.UpdatedAt)
+		return event, err
+	})
 
 	if err != nil {
-		logError("Error creating event: %v", err)
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to create event"})
+		return databaseError("Failed to create event", err)
 	}
 
-	logInfo("Created event with ID: %s", event.ID)
+	database.RecordWrite(ClientKey(c))
+	invalidateEvents(c)
+	metrics.EventsCreated.Inc()
+	logging.Ctx(c, logger).Info("Created event", "event_id", event.ID)
 	return c.Status(201).JSON(event)
 }
 
 func GetAllEvents(c *fiber.Ctx) error {
+	limit, offset, err := page(c)
+	if err != nil {
+		return err
+	}
+
+	key := listCacheKey(c)
+	if serveCached(c, key) {
+		return nil
+	}
+
+	// id breaks ties so that pages neither repeat nor skip events.
 	var events []models.Event
-	query := "SELECT id, name, description, venue_name, address, date, time, contact_mobile, contact_email, contact_instagram, created_at, updated_at FROM events ORDER BY date, time"
+	query := "SELECT id, name, description, venue_name, address, date, time, contact_mobile, contact_email, contact_instagram, created_at, updated_at FROM events ORDER BY date, time, id LIMIT $1 OFFSET $2"
 
-	err := database.DB.Select(&events, query)
+	var limitArg interface{}
+	if limit > 0 {
+		limitArg = limit
+	}
+	db := database.Reader(ClientKey(c))
+	err = db.SelectContext(c.UserContext(), &events, query, limitArg, offset)
 	if err != nil {
-		logError("Error fetching events: %v", err)
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch events"})
+		return databaseError("Failed to fetch events", err)
 	}
 
-	logInfo("Fetched %d events", len(events))
-	return c.JSON(events)
+	logging.Ctx(c, logger).Debug("Fetched events", "count", len(events))
+	return sendCacheable(c, primaryOnly(db, key), events, lastModified(events))
 }
 
 func GetEventByID(c *fiber.Ctx) error {
-	id := c.Params("id")
-	if id == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "Event ID is required"})
+	id, err := eventID(c)
+	if err != nil {
+		return err
+	}
+
+	key := eventCacheKey(c, id)
+	if serveCached(c, key) {
+		return nil
 	}
 
 	var event models.Event
 	query := "SELECT id, name, description, venue_name, address, date, time, contact_mobile, contact_email, contact_instagram, created_at, updated_at FROM events WHERE id = $1"
 
-	err := database.DB.Get(&event, query, id)
+	db := database.Reader(ClientKey(c))
+	err = db.GetContext(c.UserContext(), &event, query, id)
 	if err != nil {
-		logError("Error fetching event %s: %v", id, err)
-		return c.Status(404).JSON(fiber.Map{"error": "Event not found"})
+		return databaseError("Failed to fetch event", err)
 	}
 
-	logInfo("Fetched event with ID: %s", id)
-	return c.JSON(event)
+	logging.Ctx(c, logger).Debug("Fetched event", "event_id", id)
+	return sendCacheable(c, primaryOnly(db, key), event, event.UpdatedAt)
 }
 
 func UpdateEvent(c *fiber.Ctx) error {
-	id := c.Params("id")
-	if id == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "Event ID is required"})
+	id, err := eventID(c)
+	if err != nil {
+		return err
 	}
 
 	var req models.UpdateEventRequest
 	if err := c.BodyParser(&req); err != nil {
-		logError("Error parsing request body: %v", err)
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
-	}
-
-	if req.Name == "" || req.VenueName == "" || req.Address == "" || req.Date == "" || req.Time == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "Name, venue_name, address, date, and time are required"})
-	}
-
-	if !validateDateFormat(req.Date) {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid date format. Use YYYY-MM-DD format"})
+		logging.Ctx(c, logger).Warn("Error parsing request body", "error", err)
+		return apierror.BadRequest("Invalid request body")
 	}
 
-	if !validateTimeFormat(req.Time) {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid time format. Use HH:MM:SS format"})
-	}
-
-	if req.ContactEmail != nil && !validateEmail(*req.ContactEmail) {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid email format"})
-	}
-
-	var existingEvent models.Event
-	checkQuery := "SELECT id FROM events WHERE id = $1"
-	err := database.DB.Get(&existingEvent, checkQuery, id)
-	if err != nil {
-		logError("Event %s not found: %v", id, err)
-		return c.Status(404).JSON(fiber.Map{"error": "Event not found"})
+	if fields := validateStruct(req); fields != nil {
+		return apierror.Validation(fields)
 	}
 
 	query := `
@@ -171,45 +183,43 @@ func UpdateEvent(c *fiber.Ctx) error {
 		WHERE id = $10
 		RETURNING id, name, description, venue_name, address, date, time, contact_mobile, contact_email, contact_instagram, created_at, updated_at`
 
-	var event models.Event
-	err = database.DB.QueryRow(query, req.Name, req.Description, req.VenueName, req.Address, req.Date, req.Time, req.ContactMobile, req.ContactEmail, req.ContactInstagram, id).Scan(
-		&event.ID, &event.Name, &event.Description, &event.VenueName, &event.Address, &event.Date, &event.Time, &event.ContactMobile, &event.ContactEmail, &event.ContactInstagram, &event.CreatedAt, &event.UpdatedAt)
+	event, err := writeEvent(c, models.EventUpdated, func(tx *sqlx.Tx) (event models.Event, err error) {
+		err = tx.QueryRowContext(c.UserContext(), query, req.Name, req.Description, req.VenueName, req.Address, req.Date, req.Time, req.ContactMobile, req.ContactEmail, req.ContactInstagram, id).Scan(
+			&event.ID, &event.Name, &event.Description, &event.VenueName, &event.Address, &event.Date, &event.Time, &event.ContactMobile, &event.ContactEmail, &event.ContactInstagram, &event.CreatedAt, &event.UpdatedAt)
+		return event, err
+	})
 
 	if err != nil {
-		logError("Error updating event %s: %v", id, err)
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to update event"})
+		return databaseError("Failed to update event", err)
 	}
 
-	logInfo("Updated event with ID: %s", id)
+	database.RecordWrite(ClientKey(c))
+	invalidateEvents(c)
+	metrics.EventsUpdated.Inc()
+	logging.Ctx(c, logger).Info("Updated event", "event_id", id)
 	return c.JSON(event)
 }
 
 func DeleteEvent(c *fiber.Ctx) error {
-	id := c.Params("id")
-	if id == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "Event ID is required"})
-	}
-
-	var existingEvent models.Event
-	checkQuery := "SELECT id FROM events WHERE id = $1"
-	err := database.DB.Get(&existingEvent, checkQuery, id)
+	id, err := eventID(c)
 	if err != nil {
-		logError("Event %s not found: %v", id, err)
-		return c.Status(404).JSON(fiber.Map{"error": "Event not found"})
+		return err
 	}
 
-	query := "DELETE FROM events WHERE id = $1"
-	result, err := database.DB.Exec(query, id)
+	// The deleted row is written to the outbox for those notified of the
+	// deletion.
+	query := "DELETE FROM events WHERE id = $1 RETURNING id, name, description, venue_name, address, date, time, contact_mobile, contact_email, contact_instagram, created_at, updated_at"
+	_, err = writeEvent(c, models.EventDeleted, func(tx *sqlx.Tx) (event models.Event, err error) {
+		err = tx.GetContext(c.UserContext(), &event, query, id)
+		return event, err
+	})
 	if err != nil {
-		logError("Error deleting event %s: %v", id, err)
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete event"})
-	}
-
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		return c.Status(404).JSON(fiber.Map{"error": "Event not found"})
+		return databaseError("Failed to delete event", err)
 	}
 
-	logInfo("Deleted event with ID: %s", id)
+	database.RecordWrite(ClientKey(c))
+	invalidateEvents(c)
+	metrics.EventsDeleted.Inc()
+	logging.Ctx(c, logger).Info("Deleted event", "event_id", id)
 	return c.SendStatus(204)
 }
\ No newline at end of file
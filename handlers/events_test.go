@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/rsomcio/restapi/apierror"
 	"github.com/rsomcio/restapi/models"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -14,15 +16,7 @@ import (
 
 func setupTestApp() *fiber.App {
 	app := fiber.New(fiber.Config{
-		ErrorHandler: func(c *fiber.Ctx, err error) error {
-			code := fiber.StatusInternalServerError
-			if e, ok := err.(*fiber.Error); ok {
-				code = e.Code
-			}
-			return c.Status(code).JSON(fiber.Map{
-				"error": err.Error(),
-			})
-		},
+		ErrorHandler: apierror.Handler(apierror.Options{}),
 	})
 
 	api := app.Group("/api")
@@ -45,6 +39,7 @@ func TestCreateEventValidation(t *testing.T) {
 		payload        interface{}
 		expectedStatus int
 		expectedError  string
+		expectedFields []apierror.FieldError
 	}{
 		{
 			name: "invalid JSON",
@@ -65,7 +60,13 @@ func TestCreateEventValidation(t *testing.T) {
 				Name: "Test Event",
 			},
 			expectedStatus: 400,
-			expectedError:  "Name, venue_name, address, date, and time are required",
+			expectedError:  "Validation failed",
+			expectedFields: []apierror.FieldError{
+				{Field: "venue_name", Code: "required", Message: "venue_name is required"},
+				{Field: "address", Code: "required", Message: "address is required"},
+				{Field: "date", Code: "required", Message: "date is required"},
+				{Field: "time", Code: "required", Message: "time is required"},
+			},
 		},
 		{
 			name: "invalid date format",
@@ -77,7 +78,10 @@ func TestCreateEventValidation(t *testing.T) {
 				Time:      "14:30:00",
 			},
 			expectedStatus: 400,
-			expectedError:  "Invalid date format. Use YYYY-MM-DD format",
+			expectedError:  "Validation failed",
+			expectedFields: []apierror.FieldError{
+				{Field: "date", Code: "dateformat", Message: "Invalid date format. Use YYYY-MM-DD format"},
+			},
 		},
 		{
 			name: "invalid time format",
@@ -89,7 +93,10 @@ func TestCreateEventValidation(t *testing.T) {
 				Time:      "14:30",
 			},
 			expectedStatus: 400,
-			expectedError:  "Invalid time format. Use HH:MM:SS format",
+			expectedError:  "Validation failed",
+			expectedFields: []apierror.FieldError{
+				{Field: "time", Code: "timeformat", Message: "Invalid time format. Use HH:MM:SS format"},
+			},
 		},
 		{
 			name: "invalid email format",
@@ -102,7 +109,29 @@ func TestCreateEventValidation(t *testing.T) {
 				ContactEmail: stringPtr("invalid-email"),
 			},
 			expectedStatus: 400,
-			expectedError:  "Invalid email format",
+			expectedError:  "Validation failed",
+			expectedFields: []apierror.FieldError{
+				{Field: "contact_email", Code: "emailformat", Message: "Invalid email format"},
+			},
+		},
+		{
+			name: "fields exceeding max length",
+			payload: models.CreateEventRequest{
+				Name:             strings.Repeat("n", 256),
+				VenueName:        "Test Venue",
+				Address:          "123 Test Street",
+				Date:             "2024-03-15",
+				Time:             "14:30:00",
+				ContactMobile:    stringPtr(strings.Repeat("1", 21)),
+				ContactInstagram: stringPtr(strings.Repeat("i", 101)),
+			},
+			expectedStatus: 400,
+			expectedError:  "Validation failed",
+			expectedFields: []apierror.FieldError{
+				{Field: "name", Code: "max", Message: "name must be at most 255 characters"},
+				{Field: "contact_mobile", Code: "max", Message: "contact_mobile must be at most 20 characters"},
+				{Field: "contact_instagram", Code: "max", Message: "contact_instagram must be at most 100 characters"},
+			},
 		},
 	}
 
@@ -127,10 +156,14 @@ func TestCreateEventValidation(t *testing.T) {
 			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
 
 			if tt.expectedError != "" {
-				var response map[string]string
-				err = json.NewDecoder(resp.Body).Decode(&response)
+				assert.Equal(t, apierror.ProblemContentType, resp.Header.Get("Content-Type"))
+
+				var problem apierror.Problem
+				err = json.NewDecoder(resp.Body).Decode(&problem)
 				require.NoError(t, err)
-				assert.Contains(t, response["error"], tt.expectedError)
+				assert.Equal(t, tt.expectedStatus, problem.Status)
+				assert.Contains(t, problem.Detail, tt.expectedError)
+				assert.Equal(t, tt.expectedFields, problem.Fields)
 			}
 		})
 	}
@@ -145,6 +178,7 @@ func TestUpdateEventValidation(t *testing.T) {
 		payload        models.UpdateEventRequest
 		expectedStatus int
 		expectedError  string
+		expectedFields []apierror.FieldError
 	}{
 		{
 			name:    "missing required fields",
@@ -153,7 +187,13 @@ func TestUpdateEventValidation(t *testing.T) {
 				Name: "Updated Event",
 			},
 			expectedStatus: 400,
-			expectedError:  "Name, venue_name, address, date, and time are required",
+			expectedError:  "Validation failed",
+			expectedFields: []apierror.FieldError{
+				{Field: "venue_name", Code: "required", Message: "venue_name is required"},
+				{Field: "address", Code: "required", Message: "address is required"},
+				{Field: "date", Code: "required", Message: "date is required"},
+				{Field: "time", Code: "required", Message: "time is required"},
+			},
 		},
 		{
 			name:    "invalid date format",
@@ -166,7 +206,10 @@ func TestUpdateEventValidation(t *testing.T) {
 				Time:      "15:30:00",
 			},
 			expectedStatus: 400,
-			expectedError:  "Invalid date format. Use YYYY-MM-DD format",
+			expectedError:  "Validation failed",
+			expectedFields: []apierror.FieldError{
+				{Field: "date", Code: "dateformat", Message: "Invalid date format. Use YYYY-MM-DD format"},
+			},
 		},
 	}
 
@@ -185,15 +228,77 @@ func TestUpdateEventValidation(t *testing.T) {
 			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
 
 			if tt.expectedError != "" {
-				var response map[string]string
-				err = json.NewDecoder(resp.Body).Decode(&response)
+				assert.Equal(t, apierror.ProblemContentType, resp.Header.Get("Content-Type"))
+
+				var problem apierror.Problem
+				err = json.NewDecoder(resp.Body).Decode(&problem)
 				require.NoError(t, err)
-				assert.Contains(t, response["error"], tt.expectedError)
+				assert.Equal(t, tt.expectedStatus, problem.Status)
+				assert.Contains(t, problem.Detail, tt.expectedError)
+				assert.Equal(t, tt.expectedFields, problem.Fields)
 			}
 		})
 	}
 }
 
+func TestInvalidEventID(t *testing.T) {
+	app := setupTestApp()
+
+	body, err := json.Marshal(models.UpdateEventRequest{
+		Name:      "Updated Event",
+		VenueName: "Updated Venue",
+		Address:   "456 Updated Street",
+		Date:      "2024-03-15",
+		Time:      "15:30:00",
+	})
+	require.NoError(t, err)
+
+	for _, method := range []string{"GET", "PUT", "DELETE"} {
+		t.Run(method, func(t *testing.T) {
+			req := httptest.NewRequest(method, "/api/events/abc", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, 400, resp.StatusCode)
+
+			var problem apierror.Problem
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&problem))
+			assert.Equal(t, []apierror.FieldError{
+				{Field: "id", Code: "uuid", Message: "id must be a valid UUID"},
+			}, problem.Fields)
+		})
+	}
+}
+
+func TestInvalidPage(t *testing.T) {
+	app := setupTestApp()
+
+	tests := []struct {
+		query  string
+		fields []apierror.FieldError
+	}{
+		{"limit=0", []apierror.FieldError{{Field: "limit", Code: "min", Message: "limit must be at least 1"}}},
+		{"limit=101", []apierror.FieldError{{Field: "limit", Code: "max", Message: "limit must be at most 100"}}},
+		{"limit=ten&offset=-1", []apierror.FieldError{
+			{Field: "limit", Code: "type", Message: "limit must be an integer"},
+			{Field: "offset", Code: "min", Message: "offset must be at least 0"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest("GET", "/api/events?"+tt.query, nil))
+			require.NoError(t, err)
+			assert.Equal(t, 400, resp.StatusCode)
+
+			var problem apierror.Problem
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&problem))
+			assert.Equal(t, tt.fields, problem.Fields)
+		})
+	}
+}
+
 // Test that invalid route returns 404
 func TestInvalidRoute(t *testing.T) {
 	app := setupTestApp()
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rsomcio/restapi/apierror"
+	"github.com/rsomcio/restapi/cache"
+	"github.com/rsomcio/restapi/logging"
+)
+
+const (
+	// IdempotencyKeyHeader carries a key the client picks for a write, so
+	// that retrying the write with the same key does not apply it twice.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// ReplayedHeader is set on responses replayed for a repeated key.
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+const (
+	// idempotencyClaimTTL bounds how long a key stays claimed by a write
+	// that never finishes, such as one whose instance crashed. It exceeds
+	// any write's run time, so a claim never expires under a running write.
+	idempotencyClaimTTL = 5 * time.Minute
+	// idempotencyWait bounds how long a request waits for another with its
+	// key to finish, and idempotencyPoll how often it checks.
+	idempotencyWait = 30 * time.Second
+	idempotencyPoll = 50 * time.Millisecond
+	// maxLocalIdempotencyKeys bounds the keys held without a shared store.
+	maxLocalIdempotencyKeys = 10000
+)
+
+// idempotentHeaders are the response headers kept for replays.
+var idempotentHeaders = []string{fiber.HeaderContentType, fiber.HeaderLastModified, fiber.HeaderLocation}
+
+var idempotencyStore cache.Cache
+
+// SetIdempotencyStore keeps the responses to writes with an Idempotency-Key
+// in c, which every instance should share so that a retry reaching another
+// instance is replayed too. A nil c keeps them in this process.
+func SetIdempotencyStore(c cache.Cache) {
+	idempotencyStore = c
+}
+
+// idempotentRecord is what is stored for a key: the hash of the request
+// body, and once the write has succeeded its response. A record without a
+// Status marks a write still running.
+type idempotentRecord struct {
+	BodyHash string            `json:"body_hash"`
+	Status   int               `json:"status,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Body     []byte            `json:"body,omitempty"`
+}
+
+// Idempotent replays the response to a write carrying an Idempotency-Key that
+// the same client already sent to the same route within ttl, instead of
+// running the write again. A request reusing a key with a different body is
+// refused with 422. Concurrent requests with the same key wait for the first
+// one to finish. Only successful responses are kept, so a write that failed
+// can be retried with its key.
+func Idempotent(ttl time.Duration) fiber.Handler {
+	local := cache.NewMemory(maxLocalIdempotencyKeys)
+
+	return func(c *fiber.Ctx) error {
+		if fiber.IsMethodSafe(c.Method()) {
+			return c.Next()
+		}
+		key := c.Get(IdempotencyKeyHeader)
+		if key == "" {
+			return c.Next()
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return apierror.BadRequest(fmt.Sprintf("%s must be at most %d characters", IdempotencyKeyHeader, maxIdempotencyKeyLength))
+		}
+
+		store := idempotencyStore
+		if store == nil {
+			store = local
+		}
+		// Keys are scoped to the client and route, so that clients cannot
+		// replay each other's responses or reuse a key across routes.
+		scoped := sha256.Sum256([]byte(ClientKey(c) + " " + c.Method() + " " + c.Path() + " " + key))
+		storeKey := "idempotency:" + hex.EncodeToString(scoped[:])
+		body := sha256.Sum256(c.Body())
+		bodyHash := hex.EncodeToString(body[:])
+
+		replayed, err := claimIdempotencyKey(c, store, storeKey, bodyHash)
+		if err != nil || replayed {
+			return err
+		}
+
+		// The claim is dropped unless a response is kept for it, so that the
+		// write can be retried: after an error, which is rendered once this
+		// returns and so fails the write, and after a panic, which is
+		// recovered outside this middleware.
+		stored := false
+		defer func() {
+			if stored {
+				return
+			}
+			if err := store.Delete(context.Background(), storeKey); err != nil {
+				logging.Ctx(c, logger).Error("Failed to release idempotency key", "error", err)
+			}
+		}()
+
+		err = c.Next()
+		status := c.Response().StatusCode()
+		if err != nil || status < 200 || status >= 300 {
+			return err
+		}
+
+		record := idempotentRecord{BodyHash: bodyHash, Status: status, Headers: map[string]string{}, Body: c.Response().Body()}
+		for _, header := range idempotentHeaders {
+			if v := c.GetRespHeader(header); v != "" {
+				record.Headers[header] = v
+			}
+		}
+		data, err := json.Marshal(record)
+		if err == nil {
+			err = store.Set(context.Background(), storeKey, data, ttl)
+		}
+		if err != nil {
+			logging.Ctx(c, logger).Error("Failed to keep idempotent response", "error", err)
+		}
+		stored = err == nil
+		return nil
+	}
+}
+
+// claimIdempotencyKey claims storeKey for this request, waiting while
+// another request holds it. It reports whether it replayed that request's
+// response instead.
+func claimIdempotencyKey(c *fiber.Ctx, store cache.Cache, storeKey, bodyHash string) (bool, error) {
+	ctx := c.UserContext()
+	claim, _ := json.Marshal(idempotentRecord{BodyHash: bodyHash})
+	deadline := time.Now().Add(idempotencyWait)
+	for {
+		claimed, err := store.Add(ctx, storeKey, claim, idempotencyClaimTTL)
+		if err != nil {
+			return false, apierror.Unavailable("Idempotency store unavailable", err)
+		}
+		if claimed {
+			return false, nil
+		}
+
+		data, ok, err := store.Get(ctx, storeKey)
+		if err != nil {
+			return false, apierror.Unavailable("Idempotency store unavailable", err)
+		}
+		if !ok {
+			continue // released since the claim failed
+		}
+		var record idempotentRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return false, apierror.Internal("Failed to read idempotent response", err)
+		}
+		if record.BodyHash != bodyHash {
+			return false, apierror.New(http.StatusUnprocessableEntity, IdempotencyKeyHeader+" was already used with a different request body")
+		}
+		if record.Status != 0 {
+			for header, v := range record.Headers {
+				c.Set(header, v)
+			}
+			c.Set(ReplayedHeader, "true")
+			return true, c.Status(record.Status).Send(record.Body)
+		}
+
+		if time.Now().After(deadline) {
+			c.Set(fiber.HeaderRetryAfter, "1")
+			return false, apierror.Conflict("A request with this " + IdempotencyKeyHeader + " is still in progress")
+		}
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(idempotencyPoll):
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/rsomcio/restapi/apierror"
+	"github.com/rsomcio/restapi/cache"
+	"github.com/rsomcio/restapi/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotent(t *testing.T) {
+	calls := 0
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.Handler(apierror.Options{})})
+	// Stands in for the API key middleware.
+	app.Use(func(c *fiber.Ctx) error {
+		if principal := c.Get("X-Principal"); principal != "" {
+			c.Locals(logging.PrincipalKey, principal)
+		}
+		return c.Next()
+	})
+	app.Use(Idempotent(time.Minute))
+	app.Post("/things", func(c *fiber.Ctx) error {
+		calls++
+		if c.Query("fail") != "" {
+			return apierror.BadRequest("Invalid request body")
+		}
+		return c.Status(201).SendString(strconv.Itoa(calls))
+	})
+	app.Get("/things", func(c *fiber.Ctx) error {
+		calls++
+		return c.SendString(strconv.Itoa(calls))
+	})
+
+	type response struct {
+		status   int
+		body     string
+		replayed string
+	}
+	send := func(method, target string, headers map[string]string) response {
+		req := httptest.NewRequest(method, target, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		return response{status: resp.StatusCode, body: string(body), replayed: resp.Header.Get(ReplayedHeader)}
+	}
+
+	first := send("POST", "/things", map[string]string{IdempotencyKeyHeader: "k1"})
+	assert.Equal(t, response{status: 201, body: "1"}, first)
+
+	again := send("POST", "/things", map[string]string{IdempotencyKeyHeader: "k1"})
+	assert.Equal(t, response{status: 201, body: "1", replayed: "true"}, again)
+
+	other := send("POST", "/things", map[string]string{IdempotencyKeyHeader: "k1", "X-Principal": "someone-else"})
+	assert.Equal(t, "2", other.body, "keys are scoped to the client")
+
+	unkeyed := send("POST", "/things", nil)
+	assert.Equal(t, "3", unkeyed.body)
+
+	read := send("GET", "/things", map[string]string{IdempotencyKeyHeader: "k1"})
+	assert.Equal(t, "4", read.body, "safe methods are not replayed")
+
+	for i := 0; i < 2; i++ {
+		failed := send("POST", "/things?fail=1", map[string]string{IdempotencyKeyHeader: "k2"})
+		assert.Equal(t, 400, failed.status)
+	}
+	assert.Equal(t, 6, calls, "failed writes are not stored")
+
+	long := send("POST", "/things", map[string]string{IdempotencyKeyHeader: strings.Repeat("k", 256)})
+	assert.Equal(t, 400, long.status)
+	assert.Equal(t, 6, calls)
+}
+
+func TestIdempotentRejectsDifferentBody(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.Handler(apierror.Options{})})
+	app.Use(Idempotent(time.Minute))
+	app.Post("/things", func(c *fiber.Ctx) error {
+		return c.Status(201).Send(c.Body())
+	})
+
+	send := func(body string) *http.Response {
+		req := httptest.NewRequest("POST", "/things", strings.NewReader(body))
+		req.Header.Set(IdempotencyKeyHeader, "k1")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	assert.Equal(t, 201, send(`{"name":"a"}`).StatusCode)
+	assert.Equal(t, "true", send(`{"name":"a"}`).Header.Get(ReplayedHeader))
+	assert.Equal(t, 422, send(`{"name":"b"}`).StatusCode)
+}
+
+func TestIdempotentSharedAcrossInstances(t *testing.T) {
+	SetIdempotencyStore(cache.NewMemory(100))
+	t.Cleanup(func() { SetIdempotencyStore(nil) })
+
+	calls := 0
+	instance := func() *fiber.App {
+		app := fiber.New()
+		app.Use(Idempotent(time.Minute))
+		app.Post("/things", func(c *fiber.Ctx) error {
+			calls++
+			c.Set(fiber.HeaderLocation, "/things/"+strconv.Itoa(calls))
+			return c.Status(201).SendString(strconv.Itoa(calls))
+		})
+		return app
+	}
+	send := func(app *fiber.App) *http.Response {
+		req := httptest.NewRequest("POST", "/things", nil)
+		req.Header.Set(IdempotencyKeyHeader, "k1")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	send(instance())
+	resp := send(instance())
+	assert.Equal(t, 201, resp.StatusCode)
+	assert.Equal(t, "true", resp.Header.Get(ReplayedHeader))
+	assert.Equal(t, "/things/1", resp.Header.Get(fiber.HeaderLocation))
+	assert.Equal(t, 1, calls, "a retry reaching another instance is replayed")
+}
+
+func TestIdempotentWaitsForRunningWrite(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int32
+	app := fiber.New()
+	app.Use(Idempotent(time.Minute))
+	app.Post("/things", func(c *fiber.Ctx) error {
+		n := calls.Add(1)
+		<-release
+		return c.Status(201).SendString(strconv.Itoa(int(n)))
+	})
+
+	send := func() string {
+		req := httptest.NewRequest("POST", "/things", nil)
+		req.Header.Set(IdempotencyKeyHeader, "k1")
+		resp, err := app.Test(req, -1)
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	first := make(chan string)
+	go func() { first <- send() }()
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+
+	second := make(chan string)
+	go func() { second <- send() }()
+	time.Sleep(2 * idempotencyPoll)
+	close(release)
+
+	assert.Equal(t, "1", <-first)
+	assert.Equal(t, "1", <-second)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestIdempotentReleasesKeyAfterPanic(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.Handler(apierror.Options{})})
+	app.Use(recover.New())
+	app.Use(Idempotent(time.Minute))
+	var calls atomic.Int32
+	app.Post("/things", func(c *fiber.Ctx) error {
+		if calls.Add(1) == 1 {
+			panic("boom")
+		}
+		return c.Status(201).SendString("created")
+	})
+
+	send := func() *http.Response {
+		req := httptest.NewRequest("POST", "/things", strings.NewReader(`{}`))
+		req.Header.Set(IdempotencyKeyHeader, "k1")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	assert.Equal(t, 500, send().StatusCode)
+	assert.Equal(t, 201, send().StatusCode)
+	assert.Equal(t, int32(2), calls.Load())
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rsomcio/restapi/apierror"
+	"github.com/rsomcio/restapi/changes"
+	"github.com/rsomcio/restapi/logging"
+	"github.com/rsomcio/restapi/models"
+)
+
+var changeBus *changes.Bus
+
+// SetChanges sets the bus that committed changes to events are streamed
+// from. A nil b refuses streams.
+func SetChanges(b *changes.Bus) {
+	changeBus = b
+}
+
+// streamWriteTimeout bounds each write to an event stream. A client that
+// takes longer to accept one is disconnected.
+const streamWriteTimeout = 10 * time.Second
+
+// streamFilter selects the changes sent to a stream by the event as it is
+// after the change.
+type streamFilter struct {
+	Venue string `json:"venue" validate:"max=255"`
+	From  string `json:"from" validate:"omitempty,dateformat"`
+	To    string `json:"to" validate:"omitempty,dateformat"`
+}
+
+func (f streamFilter) validate() []apierror.FieldError {
+	if fields := validateStruct(f); fields != nil {
+		return fields
+	}
+	if f.From != "" && f.To != "" && f.From > f.To {
+		return []apierror.FieldError{{Field: "to", Code: "range", Message: "to must not be before from"}}
+	}
+	return nil
+}
+
+func (f streamFilter) match(event models.Event) bool {
+	date := eventDay(event.Date)
+	return (f.Venue == "" || strings.EqualFold(f.Venue, event.VenueName)) &&
+		(f.From == "" || date >= f.From) &&
+		(f.To == "" || date <= f.To)
+}
+
+// eventDay trims the midnight time that DATE columns come back with, as in
+// 2024-03-15T00:00:00Z, so that dates compare as YYYY-MM-DD.
+func eventDay(date string) string {
+	if d, _, ok := strings.Cut(date, "T"); ok && len(d) == len("2006-01-02") {
+		return d
+	}
+	return date
+}
+
+// StreamEvents streams changes to events as server-sent events, named by the
+// change type with the event as data, and sends a comment every heartbeat to
+// keep idle connections open. A client reconnecting with Last-Event-ID is
+// first sent the changes it missed, or a reset event when they are no longer
+// kept. A client more than buffer changes behind is disconnected rather than
+// holding up writes, and resumes on reconnecting.
+func StreamEvents(heartbeat time.Duration, buffer int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		filter := streamFilter{Venue: c.Query("venue"), From: c.Query("from"), To: c.Query("to")}
+		if fields := filter.validate(); fields != nil {
+			return apierror.Validation(fields)
+		}
+		if changeBus == nil {
+			return apierror.Unavailable("Event stream unavailable", nil)
+		}
+
+		sub, missed, resumed := changeBus.SubscribeAfter(c.Get(fiber.HeaderLastEventID), buffer)
+		c.Set(fiber.HeaderContentType, "text/event-stream")
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+		c.Set("X-Accel-Buffering", "no")
+
+		// c is reused once the handler returns, so the writer only keeps
+		// what it needs.
+		conn := c.Context().Conn()
+		logger := logging.Ctx(c, logger)
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			defer sub.Close()
+			flush := func() bool {
+				if conn != nil {
+					conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+				}
+				return w.Flush() == nil
+			}
+			send := func(change changes.Change) bool {
+				if !filter.match(change.Event) {
+					// An id alone moves the client's Last-Event-ID on
+					// without dispatching anything.
+					fmt.Fprintf(w, "id: %s\n\n", change.ID)
+					return flush()
+				}
+				data, err := json.Marshal(change.Event)
+				if err != nil {
+					logger.Error("Failed to encode event change", "event_id", change.Event.ID, "error", err)
+					return false
+				}
+				fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", change.ID, change.Type, data)
+				return flush()
+			}
+
+			w.WriteString(": connected\n\n")
+			if !resumed {
+				w.WriteString("event: reset\ndata: {}\n\n")
+			}
+			if !flush() {
+				return
+			}
+			for _, change := range missed {
+				if !send(change) {
+					return
+				}
+			}
+
+			ticker := time.NewTicker(heartbeat)
+			defer ticker.Stop()
+			for {
+				select {
+				case change, ok := <-sub.Changes():
+					if !ok {
+						if errors.Is(sub.Err(), changes.ErrOverflow) {
+							logger.Warn("Disconnected event stream that fell behind", "buffer", buffer)
+						}
+						return
+					}
+					if !send(change) {
+						return
+					}
+				case <-ticker.C:
+					w.WriteString(": heartbeat\n\n")
+					if !flush() {
+						return
+					}
+				}
+			}
+		})
+		return nil
+	}
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rsomcio/restapi/apierror"
+	"github.com/rsomcio/restapi/changes"
+	"github.com/rsomcio/restapi/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveChanges serves handler at path on a local port, streaming from bus,
+// since app.Test waits for the whole response. It returns the address.
+func serveChanges(t *testing.T, bus *changes.Bus, path string, handler fiber.Handler) string {
+	t.Helper()
+	SetChanges(bus)
+	t.Cleanup(func() { SetChanges(nil) })
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.Handler(apierror.Options{}), DisableStartupMessage: true})
+	app.Get(path, handler)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go app.Listener(ln)
+	t.Cleanup(func() {
+		bus.Close()
+		app.Shutdown()
+	})
+	return ln.Addr().String()
+}
+
+// sseReader reads the messages of an event stream.
+type sseReader struct {
+	r *bufio.Reader
+}
+
+func openStream(t *testing.T, url, lastEventID string) (*http.Response, sseReader) {
+	t.Helper()
+	req, err := http.NewRequest("GET", url, nil)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set(fiber.HeaderLastEventID, lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp, sseReader{bufio.NewReader(resp.Body)}
+}
+
+// next returns the fields of the next message, skipping heartbeats.
+func (s sseReader) next(t *testing.T) map[string]string {
+	t.Helper()
+	for {
+		fields := map[string]string{}
+		for {
+			line, err := s.r.ReadString('\n')
+			require.NoError(t, err)
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				break
+			}
+			name, value, _ := strings.Cut(line, ": ")
+			fields[name] = value
+		}
+		if _, comment := fields[""]; !comment || len(fields) > 1 {
+			return fields
+		}
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	bus := changes.NewBus(10)
+	url := "http://" + serveChanges(t, bus, "/api/events/stream", StreamEvents(50*time.Millisecond, 4)) + "/api/events/stream"
+
+	resp, stream := openStream(t, url+"?venue=main+hall&from=2030-01-01&to=2030-05-01", "")
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// Dates come back from Postgres with a midnight time.
+	bus.Publish(1, models.EventCreated, models.Event{ID: "e1", VenueName: "Main Hall", Date: "2030-05-01T00:00:00Z"})
+	skipped := bus.Publish(2, models.EventCreated, models.Event{ID: "e2", VenueName: "Annex", Date: "2030-05-01"})
+	bus.Publish(3, models.EventCreated, models.Event{ID: "e3", VenueName: "Main Hall", Date: "2029-12-31"})
+	deleted := bus.Publish(4, models.EventDeleted, models.Event{ID: "e1", VenueName: "Main Hall", Date: "2030-05-01"})
+
+	msg := stream.next(t)
+	assert.Equal(t, models.EventCreated, msg["event"])
+	var event models.Event
+	require.NoError(t, json.Unmarshal([]byte(msg["data"]), &event))
+	assert.Equal(t, "e1", event.ID)
+
+	assert.Equal(t, map[string]string{"id": skipped.ID}, stream.next(t), "filtered changes only move the ID on")
+	stream.next(t)
+	msg = stream.next(t)
+	assert.Equal(t, deleted.ID, msg["id"])
+	assert.Equal(t, models.EventDeleted, msg["event"])
+
+	t.Run("resume", func(t *testing.T) {
+		_, stream := openStream(t, url, skipped.ID)
+		assert.Equal(t, models.EventCreated, stream.next(t)["event"], "e3 was missed")
+		assert.Equal(t, deleted.ID, stream.next(t)["id"])
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		_, stream := openStream(t, url, "99")
+		assert.Equal(t, map[string]string{"event": "reset", "data": "{}"}, stream.next(t))
+	})
+}
+
+func TestStreamEventsValidation(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.Handler(apierror.Options{})})
+	app.Get("/api/events/stream", StreamEvents(time.Second, 4))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/events/stream?from=tomorrow", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+	var problem apierror.Problem
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&problem))
+	assert.Equal(t, []apierror.FieldError{{Field: "from", Code: "dateformat", Message: "Invalid date format. Use YYYY-MM-DD format"}}, problem.Fields)
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/api/events/stream?from=2030-05-02&to=2030-05-01", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&problem))
+	assert.Equal(t, []apierror.FieldError{{Field: "to", Code: "range", Message: "to must not be before from"}}, problem.Fields)
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/api/events/stream", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 503, resp.StatusCode, "no bus, no stream")
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/rsomcio/restapi/apierror"
+	"github.com/rsomcio/restapi/models"
+	"github.com/rsomcio/restapi/webhook"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+var validate *validator.Validate
+
+var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+
+func init() {
+	validate = validator.New()
+
+	// Report fields by their JSON name so clients can map errors to inputs.
+	validate.RegisterTagNameFunc(func(fld reflect.StructField) string {
+		name := strings.SplitN(fld.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	validate.RegisterValidation("dateformat", func(fl validator.FieldLevel) bool {
+		return validateDateFormat(fl.Field().String())
+	})
+	validate.RegisterValidation("timeformat", func(fl validator.FieldLevel) bool {
+		return validateTimeFormat(fl.Field().String())
+	})
+	validate.RegisterValidation("emailformat", func(fl validator.FieldLevel) bool {
+		return validateEmail(fl.Field().String())
+	})
+	validate.RegisterValidation("webhookurl", func(fl validator.FieldLevel) bool {
+		return validateWebhookURL(fl.Field().String())
+	})
+}
+
+func validateEmail(email string) bool {
+	if email == "" {
+		return true
+	}
+	return emailRegex.MatchString(email)
+}
+
+// validateWebhookURL accepts absolute http and https URLs of hosts that may
+// be public. Names are checked again for the addresses they resolve to when
+// messages are delivered.
+func validateWebhookURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false
+	}
+	return allowInternalWebhooks || webhook.PublicHost(u.Hostname())
+}
+
+func validateDateFormat(date string) bool {
+	_, err := time.Parse("2006-01-02", date)
+	return err == nil
+}
+
+func validateTimeFormat(timeStr string) bool {
+	_, err := time.Parse("15:04:05", timeStr)
+	return err == nil
+}
+
+// validateStruct runs the struct tag rules on req and returns every failure,
+// or nil when req is valid.
+func validateStruct(req interface{}) []apierror.FieldError {
+	err := validate.Struct(req)
+	if err == nil {
+		return nil
+	}
+
+	validationErrors, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return []apierror.FieldError{{Code: "invalid", Message: err.Error()}}
+	}
+
+	fields := make([]apierror.FieldError, 0, len(validationErrors))
+	for _, fe := range validationErrors {
+		fields = append(fields, apierror.FieldError{
+			Field:   fe.Field(),
+			Code:    fe.Tag(),
+			Message: fieldErrorMessage(fe),
+		})
+	}
+	return fields
+}
+
+// ValidateEvent checks req by the rules CreateEvent applies, for events that
+// are loaded without going through the API.
+func ValidateEvent(req models.CreateEventRequest) []apierror.FieldError {
+	return validateStruct(req)
+}
+
+func fieldErrorMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", fe.Field())
+	case "min":
+		return fmt.Sprintf("%s must be at least %s characters", fe.Field(), fe.Param())
+	case "max":
+		return fmt.Sprintf("%s must be at most %s characters", fe.Field(), fe.Param())
+	case "dateformat":
+		return "Invalid date format. Use YYYY-MM-DD format"
+	case "timeformat":
+		return "Invalid time format. Use HH:MM:SS format"
+	case "emailformat":
+		return "Invalid email format"
+	case "webhookurl":
+		return fmt.Sprintf("%s must be an absolute http or https URL of a public host", fe.Field())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of %s", fe.Field(), strings.Join(strings.Fields(fe.Param()), ", "))
+	default:
+		return fmt.Sprintf("%s failed the %s rule", fe.Field(), fe.Tag())
+	}
+}
+
+// eventID returns the :id route parameter, rejecting anything that is not a
+// UUID before it reaches Postgres.
+func eventID(c *fiber.Ctx) (string, error) {
+	return idParam(c, "Event")
+}
+
+// webhookID is eventID for the webhook routes.
+func webhookID(c *fiber.Ctx) (string, error) {
+	return idParam(c, "Webhook")
+}
+
+func idParam(c *fiber.Ctx, resource string) (string, error) {
+	id := c.Params("id")
+	if id == "" {
+		return "", apierror.BadRequest(resource + " ID is required")
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return "", apierror.Validation([]apierror.FieldError{{
+			Field:   "id",
+			Code:    "uuid",
+			Message: "id must be a valid UUID",
+		}})
+	}
+	return id, nil
+}
+
+// MaxPageSize is the largest limit a list request may ask for.
+const MaxPageSize = 100
+
+// page returns the limit and offset query parameters of a list request. A
+// zero limit means the request is not paginated.
+func page(c *fiber.Ctx) (limit, offset int, err error) {
+	var fields []apierror.FieldError
+	param := func(name string, min, max int) int {
+		raw := c.Query(name)
+		if raw == "" {
+			return 0
+		}
+		n, err := strconv.Atoi(raw)
+		switch {
+		case err != nil:
+			fields = append(fields, apierror.FieldError{Field: name, Code: "type", Message: name + " must be an integer"})
+		case n < min:
+			fields = append(fields, apierror.FieldError{Field: name, Code: "min", Message: fmt.Sprintf("%s must be at least %d", name, min)})
+		case max > 0 && n > max:
+			fields = append(fields, apierror.FieldError{Field: name, Code: "max", Message: fmt.Sprintf("%s must be at most %d", name, max)})
+		}
+		return n
+	}
+
+	limit = param("limit", 1, MaxPageSize)
+	offset = param("offset", 0, 0)
+	if fields != nil {
+		return 0, 0, apierror.Validation(fields)
+	}
+	return limit, offset, nil
+}
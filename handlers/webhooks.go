@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+	"github.com/rsomcio/restapi/apierror"
+	"github.com/rsomcio/restapi/database"
+	"github.com/rsomcio/restapi/logging"
+	"github.com/rsomcio/restapi/models"
+)
+
+var allowInternalWebhooks bool
+
+// SetAllowInternalWebhooks lets webhooks be registered for localhost and
+// for loopback, private and link-local addresses, which are otherwise
+// refused.
+func SetAllowInternalWebhooks(allow bool) {
+	allowInternalWebhooks = allow
+}
+
+// webhookColumns are returned for webhooks; the secret is only returned when
+// a webhook is created.
+const webhookColumns = "id, url, event_types, enabled, consecutive_failures, disabled_at, created_at, updated_at"
+
+// webhookError is databaseError for queries on webhooks.
+func webhookError(detail string, err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return apierror.NotFound("Webhook not found")
+	}
+	return databaseError(detail, err)
+}
+
+// eventTypes returns types as stored, where an empty list subscribes to
+// every type.
+func eventTypes(types []string) pq.StringArray {
+	if types == nil {
+		return pq.StringArray{}
+	}
+	return types
+}
+
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func CreateWebhook(c *fiber.Ctx) error {
+	var req models.CreateWebhookRequest
+	if err := c.BodyParser(&req); err != nil {
+		logging.Ctx(c, logger).Warn("Error parsing request body", "error", err)
+		return apierror.BadRequest("Invalid request body")
+	}
+
+	if fields := validateStruct(req); fields != nil {
+		return apierror.Validation(fields)
+	}
+
+	var secret string
+	if req.Secret != nil {
+		secret = *req.Secret
+	} else {
+		var err error
+		if secret, err = generateWebhookSecret(); err != nil {
+			return apierror.Internal("Failed to create webhook", err)
+		}
+	}
+
+	query := "INSERT INTO webhooks (url, event_types, secret) VALUES ($1, $2, $3) RETURNING " + webhookColumns + ", secret"
+
+	var webhook models.Webhook
+	err := database.DB.GetContext(c.UserContext(), &webhook, query, req.URL, eventTypes(req.EventTypes), secret)
+	if err != nil {
+		return webhookError("Failed to create webhook", err)
+	}
+
+	logging.Ctx(c, logger).Info("Created webhook", "webhook_id", webhook.ID)
+	return c.Status(201).JSON(webhook)
+}
+
+func GetAllWebhooks(c *fiber.Ctx) error {
+	limit, offset, err := page(c)
+	if err != nil {
+		return err
+	}
+
+	var limitArg interface{}
+	if limit > 0 {
+		limitArg = limit
+	}
+	webhooks := []models.Webhook{}
+	query := "SELECT " + webhookColumns + " FROM webhooks ORDER BY created_at, id LIMIT $1 OFFSET $2"
+	err = database.DB.SelectContext(c.UserContext(), &webhooks, query, limitArg, offset)
+	if err != nil {
+		return webhookError("Failed to fetch webhooks", err)
+	}
+	return c.JSON(webhooks)
+}
+
+func GetWebhookByID(c *fiber.Ctx) error {
+	id, err := webhookID(c)
+	if err != nil {
+		return err
+	}
+
+	var webhook models.Webhook
+	query := "SELECT " + webhookColumns + " FROM webhooks WHERE id = $1"
+	err = database.DB.GetContext(c.UserContext(), &webhook, query, id)
+	if err != nil {
+		return webhookError("Failed to fetch webhook", err)
+	}
+	return c.JSON(webhook)
+}
+
+func UpdateWebhook(c *fiber.Ctx) error {
+	id, err := webhookID(c)
+	if err != nil {
+		return err
+	}
+
+	var req models.UpdateWebhookRequest
+	if err := c.BodyParser(&req); err != nil {
+		logging.Ctx(c, logger).Warn("Error parsing request body", "error", err)
+		return apierror.BadRequest("Invalid request body")
+	}
+
+	if fields := validateStruct(req); fields != nil {
+		return apierror.Validation(fields)
+	}
+
+	// Enabling a webhook clears the failures that disabled it.
+	query := `
+		UPDATE webhooks
+		SET url = $1, event_types = $2, enabled = $3,
+		    consecutive_failures = CASE WHEN $3 THEN 0 ELSE consecutive_failures END,
+		    disabled_at = CASE WHEN $3 THEN NULL ELSE disabled_at END,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+		RETURNING ` + webhookColumns
+
+	var webhook models.Webhook
+	err = database.DB.GetContext(c.UserContext(), &webhook, query, req.URL, eventTypes(req.EventTypes), req.Enabled, id)
+	if err != nil {
+		return webhookError("Failed to update webhook", err)
+	}
+
+	logging.Ctx(c, logger).Info("Updated webhook", "webhook_id", id, "enabled", webhook.Enabled)
+	return c.JSON(webhook)
+}
+
+func DeleteWebhook(c *fiber.Ctx) error {
+	id, err := webhookID(c)
+	if err != nil {
+		return err
+	}
+
+	result, err := database.DB.ExecContext(c.UserContext(), "DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		return webhookError("Failed to delete webhook", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return webhookError("Failed to delete webhook", err)
+	}
+	if rowsAffected == 0 {
+		return apierror.NotFound("Webhook not found")
+	}
+
+	logging.Ctx(c, logger).Info("Deleted webhook", "webhook_id", id)
+	return c.SendStatus(204)
+}
+
+// GetWebhookDeliveries lists the delivery attempts of a webhook, newest
+// first.
+func GetWebhookDeliveries(c *fiber.Ctx) error {
+	id, err := webhookID(c)
+	if err != nil {
+		return err
+	}
+	limit, offset, err := page(c)
+	if err != nil {
+		return err
+	}
+
+	var exists bool
+	err = database.DB.GetContext(c.UserContext(), &exists, "SELECT EXISTS (SELECT 1 FROM webhooks WHERE id = $1)", id)
+	if err != nil {
+		return webhookError("Failed to fetch webhook deliveries", err)
+	}
+	if !exists {
+		return apierror.NotFound("Webhook not found")
+	}
+
+	var limitArg interface{}
+	if limit > 0 {
+		limitArg = limit
+	}
+	deliveries := []models.WebhookDelivery{}
+	query := `
+		SELECT id, webhook_id, message_id, event_type, attempt, status_code, error, duration_ms, delivered, created_at
+		FROM webhook_deliveries WHERE webhook_id = $1
+		ORDER BY id DESC LIMIT $2 OFFSET $3`
+	err = database.DB.SelectContext(c.UserContext(), &deliveries, query, id, limitArg, offset)
+	if err != nil {
+		return webhookError("Failed to fetch webhook deliveries", err)
+	}
+	return c.JSON(deliveries)
+}
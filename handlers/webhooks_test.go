@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rsomcio/restapi/apierror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupWebhookApp() *fiber.App {
+	app := fiber.New(fiber.Config{
+		ErrorHandler: apierror.Handler(apierror.Options{}),
+	})
+	app.Post("/api/webhooks", CreateWebhook)
+	app.Put("/api/webhooks/:id", UpdateWebhook)
+	app.Get("/api/webhooks/:id/deliveries", GetWebhookDeliveries)
+	return app
+}
+
+func TestWebhookValidation(t *testing.T) {
+	app := setupWebhookApp()
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		fields []apierror.FieldError
+	}{
+		{
+			name: "missing url", method: "POST", target: "/api/webhooks",
+			body:   `{}`,
+			fields: []apierror.FieldError{{Field: "url", Code: "required", Message: "url is required"}},
+		},
+		{
+			name: "not an http url", method: "POST", target: "/api/webhooks",
+			body: `{"url": "ftp://example.com/hook", "secret": "short"}`,
+			fields: []apierror.FieldError{
+				{Field: "url", Code: "webhookurl", Message: "url must be an absolute http or https URL of a public host"},
+				{Field: "secret", Code: "min", Message: "secret must be at least 16 characters"},
+			},
+		},
+		{
+			name: "internal address", method: "POST", target: "/api/webhooks",
+			body:   `{"url": "http://169.254.169.254/latest/meta-data"}`,
+			fields: []apierror.FieldError{{Field: "url", Code: "webhookurl", Message: "url must be an absolute http or https URL of a public host"}},
+		},
+		{
+			name: "localhost", method: "PUT", target: "/api/webhooks/123e4567-e89b-12d3-a456-426614174000",
+			body:   `{"url": "http://localhost:8080/hook", "enabled": true}`,
+			fields: []apierror.FieldError{{Field: "url", Code: "webhookurl", Message: "url must be an absolute http or https URL of a public host"}},
+		},
+		{
+			name: "unknown event type", method: "PUT", target: "/api/webhooks/123e4567-e89b-12d3-a456-426614174000",
+			body:   `{"url": "https://example.com/hook", "event_types": ["event.created", "event.viewed"], "enabled": true}`,
+			fields: []apierror.FieldError{{Field: "event_types[1]", Code: "oneof", Message: "event_types[1] must be one of event.created, event.updated, event.deleted"}},
+		},
+		{
+			name: "invalid id", method: "GET", target: "/api/webhooks/abc/deliveries",
+			fields: []apierror.FieldError{{Field: "id", Code: "uuid", Message: "id must be a valid UUID"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, 400, resp.StatusCode)
+
+			var problem apierror.Problem
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&problem))
+			assert.Equal(t, tt.fields, problem.Fields)
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/rsomcio/restapi/apierror"
+	"github.com/rsomcio/restapi/changes"
+	"github.com/rsomcio/restapi/logging"
+	"github.com/rsomcio/restapi/models"
+)
+
+// WebSocketProtocol is the subprotocol of the event WebSocket. Clients that
+// pass their API key as a subprotocol offer it too, since browsers fail the
+// handshake unless the server picks one of the subprotocols offered:
+//
+//	new WebSocket(url, ["events.v1", "apikey." + key])
+const WebSocketProtocol = "events.v1"
+
+// Topics a WebSocket client may subscribe to: every event, the events at a
+// venue, or one event.
+const (
+	topicAll         = "all"
+	topicVenuePrefix = "venue:"
+	topicEventPrefix = "event:"
+)
+
+const (
+	// maxTopics bounds the topics one connection may subscribe to.
+	maxTopics = 100
+	// wsReadLimit bounds the messages clients send, which are small.
+	wsReadLimit = 4096
+	// wsLoggerKey passes the request's logger on to the connection.
+	wsLoggerKey = "handlers.wsLogger"
+)
+
+// wsRequest is a message from a WebSocket client.
+type wsRequest struct {
+	Action string `json:"action"`
+	Topic  string `json:"topic"`
+}
+
+// wsMessage is a message to a WebSocket client: a change, named by its type,
+// or the reply to a request.
+type wsMessage struct {
+	Type  string        `json:"type"`
+	ID    string        `json:"id,omitempty"`
+	Event *models.Event `json:"event,omitempty"`
+	Topic string        `json:"topic,omitempty"`
+	Error string        `json:"error,omitempty"`
+}
+
+// EventsWebSocket upgrades to a WebSocket on which clients subscribe to
+// changes to events by topic and are sent those changes. Connections from
+// browsers are only accepted from the server's own origin and from origins,
+// which may hold * for any. The connection is pinged every heartbeat and
+// closed if it stops answering, or if it falls buffer changes behind.
+func EventsWebSocket(origins []string, heartbeat time.Duration, buffer int) fiber.Handler {
+	// Origins are checked below, where the server's own is known.
+	upgrade := websocket.New(func(conn *websocket.Conn) {
+		logger, _ := conn.Locals(wsLoggerKey).(*slog.Logger)
+		serveWebSocket(conn, logger, heartbeat, buffer)
+	}, websocket.Config{Origins: []string{"*"}, Subprotocols: []string{WebSocketProtocol}})
+
+	return func(c *fiber.Ctx) error {
+		if changeBus == nil {
+			return apierror.Unavailable("Event stream unavailable", nil)
+		}
+		if !websocket.IsWebSocketUpgrade(c) {
+			return fiber.ErrUpgradeRequired
+		}
+		if !allowedOrigin(c, origins) {
+			return apierror.Forbidden("Origin not allowed")
+		}
+		c.Locals(wsLoggerKey, logging.Ctx(c, logger))
+		return upgrade(c)
+	}
+}
+
+// allowedOrigin reports whether the page that opened the connection, named
+// by the Origin header browsers send, may use it. Clients other than
+// browsers send no Origin and are always allowed.
+func allowedOrigin(c *fiber.Ctx, origins []string) bool {
+	origin := c.Get(fiber.HeaderOrigin)
+	if origin == "" || slices.Contains(origins, "*") || slices.Contains(origins, origin) {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, string(c.Request().Host()))
+}
+
+// wsSession is one WebSocket connection and its topics.
+type wsSession struct {
+	conn   *websocket.Conn
+	logger *slog.Logger
+
+	// writeMu serializes writes, which come from both the read loop and
+	// the change pump.
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	topics  map[string]bool
+}
+
+func serveWebSocket(conn *websocket.Conn, logger *slog.Logger, heartbeat time.Duration, buffer int) {
+	s := &wsSession{conn: conn, logger: logger, topics: make(map[string]bool)}
+	sub := changeBus.Subscribe(buffer)
+	defer sub.Close()
+
+	// A client that answers no ping for two heartbeats is gone.
+	alive := func() { conn.SetReadDeadline(time.Now().Add(2 * heartbeat)) }
+	alive()
+	conn.SetReadLimit(wsReadLimit)
+	conn.SetPongHandler(func(string) error {
+		alive()
+		return nil
+	})
+
+	stop := make(chan struct{})
+	pumped := make(chan struct{})
+	go func() {
+		defer close(pumped)
+		s.pump(sub, heartbeat, stop)
+	}()
+	defer func() {
+		close(stop)
+		<-pumped
+	}()
+
+	for {
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		alive()
+		if kind != websocket.TextMessage {
+			continue
+		}
+		var req wsRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			err = s.write(wsMessage{Type: "error", Error: "Messages must be JSON objects with an action and a topic"})
+		} else {
+			err = s.write(s.handle(req))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handle applies a subscribe or unsubscribe request and returns the reply.
+func (s *wsSession) handle(req wsRequest) wsMessage {
+	key, err := topicKey(req.Topic)
+	if err != nil {
+		return wsMessage{Type: "error", Topic: req.Topic, Error: err.Error()}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch req.Action {
+	case "subscribe":
+		if !s.topics[key] && len(s.topics) >= maxTopics {
+			return wsMessage{Type: "error", Topic: req.Topic, Error: "Too many topics"}
+		}
+		s.topics[key] = true
+		return wsMessage{Type: "subscribed", Topic: req.Topic}
+	case "unsubscribe":
+		delete(s.topics, key)
+		return wsMessage{Type: "unsubscribed", Topic: req.Topic}
+	default:
+		return wsMessage{Type: "error", Topic: req.Topic, Error: "action must be subscribe or unsubscribe"}
+	}
+}
+
+// topicKey returns the form of topic that changes are matched against.
+func topicKey(topic string) (string, error) {
+	switch {
+	case topic == topicAll:
+		return topic, nil
+	case strings.HasPrefix(topic, topicVenuePrefix) && len(topic) > len(topicVenuePrefix):
+		return strings.ToLower(topic), nil
+	case strings.HasPrefix(topic, topicEventPrefix):
+		id, err := uuid.Parse(strings.TrimPrefix(topic, topicEventPrefix))
+		if err != nil {
+			return "", errors.New("event topics need a valid UUID")
+		}
+		return topicEventPrefix + id.String(), nil
+	default:
+		return "", errors.New("topic must be all, venue:NAME or event:ID")
+	}
+}
+
+// subscribed reports whether a change to event matches one of the topics.
+func (s *wsSession) subscribed(event models.Event) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.topics[topicAll] ||
+		s.topics[topicVenuePrefix+strings.ToLower(event.VenueName)] ||
+		s.topics[topicEventPrefix+strings.ToLower(event.ID)]
+}
+
+// pump sends the subscribed changes and the pings until stop is closed or
+// the subscription ends, which closes the connection.
+func (s *wsSession) pump(sub *changes.Subscription, heartbeat time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case change, ok := <-sub.Changes():
+			if !ok {
+				code, reason := websocket.CloseGoingAway, "Server shutting down"
+				if errors.Is(sub.Err(), changes.ErrOverflow) {
+					code, reason = websocket.CloseTryAgainLater, "Too far behind"
+					s.logger.Warn("Disconnected WebSocket that fell behind")
+				}
+				s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(streamWriteTimeout))
+				s.conn.Close()
+				return
+			}
+			if !s.subscribed(change.Event) {
+				continue
+			}
+			if err := s.write(wsMessage{Type: change.Type, ID: change.ID, Event: &change.Event}); err != nil {
+				s.conn.Close()
+				return
+			}
+		case <-ticker.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout)); err != nil {
+				s.conn.Close()
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (s *wsSession) write(msg wsMessage) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	return s.conn.WriteJSON(msg)
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	wsclient "github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rsomcio/restapi/changes"
+	"github.com/rsomcio/restapi/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dialEvents(t *testing.T, bus *changes.Bus, heartbeat time.Duration) *wsclient.Conn {
+	t.Helper()
+	addr := serveChanges(t, bus, "/api/events/ws", EventsWebSocket([]string{"*"}, heartbeat, 4))
+	conn, _, err := wsclient.DefaultDialer.Dial("ws://"+addr+"/api/events/ws", nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+// request sends a request and returns the reply.
+func request(t *testing.T, conn *wsclient.Conn, action, topic string) wsMessage {
+	t.Helper()
+	require.NoError(t, conn.WriteJSON(wsRequest{Action: action, Topic: topic}))
+	var reply wsMessage
+	require.NoError(t, conn.ReadJSON(&reply))
+	return reply
+}
+
+func TestEventsWebSocket(t *testing.T) {
+	bus := changes.NewBus(10)
+	conn := dialEvents(t, bus, time.Minute)
+	const id = "123e4567-e89b-12d3-a456-426614174000"
+
+	assert.Equal(t, wsMessage{Type: "subscribed", Topic: "venue:Main Hall"}, request(t, conn, "subscribe", "venue:Main Hall"))
+	assert.Equal(t, wsMessage{Type: "subscribed", Topic: "event:" + id}, request(t, conn, "subscribe", "event:"+id))
+
+	bus.Publish(1, models.EventCreated, models.Event{ID: "e1", VenueName: "Annex"})
+	atVenue := bus.Publish(2, models.EventCreated, models.Event{ID: "e2", VenueName: "main hall"})
+	byID := bus.Publish(3, models.EventUpdated, models.Event{ID: id, VenueName: "Annex"})
+
+	var msg wsMessage
+	require.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, atVenue.ID, msg.ID)
+	assert.Equal(t, models.EventCreated, msg.Type)
+	assert.Equal(t, "e2", msg.Event.ID)
+	require.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, byID.ID, msg.ID, "changes to other venues and events are not sent")
+
+	assert.Equal(t, wsMessage{Type: "unsubscribed", Topic: "venue:main hall"}, request(t, conn, "unsubscribe", "venue:main hall"))
+	bus.Publish(4, models.EventDeleted, models.Event{ID: "e2", VenueName: "Main Hall"})
+	assert.Equal(t, wsMessage{Type: "subscribed", Topic: "all"}, request(t, conn, "subscribe", "all"), "the deletion was not sent")
+
+	t.Run("invalid requests", func(t *testing.T) {
+		assert.Equal(t, "topic must be all, venue:NAME or event:ID", request(t, conn, "subscribe", "everything").Error)
+		assert.Equal(t, "event topics need a valid UUID", request(t, conn, "subscribe", "event:42").Error)
+		assert.Equal(t, "action must be subscribe or unsubscribe", request(t, conn, "list", "all").Error)
+
+		require.NoError(t, conn.WriteMessage(wsclient.TextMessage, []byte("hello")))
+		var reply wsMessage
+		require.NoError(t, conn.ReadJSON(&reply))
+		assert.Equal(t, "error", reply.Type)
+	})
+
+	t.Run("shutdown", func(t *testing.T) {
+		bus.Close()
+		_, _, err := conn.ReadMessage()
+		assert.True(t, wsclient.IsCloseError(err, wsclient.CloseGoingAway), err)
+	})
+}
+
+func TestEventsWebSocketDropsSilentClients(t *testing.T) {
+	conn := dialEvents(t, changes.NewBus(10), 20*time.Millisecond)
+
+	// Pongs are only sent while reading, so a client that stops reading
+	// stops answering pings.
+	time.Sleep(100 * time.Millisecond)
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			assert.False(t, wsclient.IsCloseError(err, wsclient.CloseGoingAway), "the connection is dropped, not closed for shutdown")
+			return
+		}
+	}
+}
+
+func TestEventsWebSocketRequiresUpgrade(t *testing.T) {
+	SetChanges(changes.NewBus(10))
+	defer SetChanges(nil)
+	app := fiber.New()
+	app.Get("/api/events/ws", EventsWebSocket([]string{"*"}, time.Minute, 4))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/events/ws", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 426, resp.StatusCode)
+}
+
+func TestEventsWebSocketChecksOrigin(t *testing.T) {
+	addr := serveChanges(t, changes.NewBus(10), "/api/events/ws", EventsWebSocket([]string{"https://app.example.com"}, time.Minute, 4))
+
+	dial := func(origin string) int {
+		header := http.Header{}
+		if origin != "" {
+			header.Set("Origin", origin)
+		}
+		conn, resp, err := wsclient.DefaultDialer.Dial("ws://"+addr+"/api/events/ws", header)
+		if err == nil {
+			conn.Close()
+		}
+		require.NotNil(t, resp)
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, 101, dial(""), "clients other than browsers send no origin")
+	assert.Equal(t, 101, dial("https://app.example.com"))
+	assert.Equal(t, 101, dial("http://"+addr), "the server's own origin is allowed")
+	assert.Equal(t, 403, dial("https://evil.example.com"))
+}
+
+func TestEventsWebSocketProtocol(t *testing.T) {
+	addr := serveChanges(t, changes.NewBus(10), "/api/events/ws", EventsWebSocket(nil, time.Minute, 4))
+
+	dialer := *wsclient.DefaultDialer
+	dialer.Subprotocols = []string{WebSocketProtocol, APIKeyProtocolPrefix + "rk_secret"}
+	conn, resp, err := dialer.Dial("ws://"+addr+"/api/events/ws", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, WebSocketProtocol, resp.Header.Get("Sec-WebSocket-Protocol"), "the key is not echoed back")
+}
@@ -0,0 +1,156 @@
+// Package health serves the liveness and readiness probes used by the
+// orchestrator.
+package health
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rsomcio/restapi/database"
+)
+
+// PingTimeout bounds how long readiness waits for the database to answer.
+var PingTimeout = 2 * time.Second
+
+var draining atomic.Bool
+
+// SetDraining marks the service as shutting down. Readiness fails from then
+// on so that load balancers stop routing new requests here, while liveness
+// keeps passing until the process exits.
+func SetDraining(d bool) {
+	draining.Store(d)
+}
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Check is the result of probing a single dependency.
+type Check struct {
+	Status    string                 `json:"status"`
+	LatencyMS float64                `json:"latency_ms,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// Report is the body returned by the readiness probe.
+type Report struct {
+	Status   string           `json:"status"`
+	Draining bool             `json:"draining"`
+	Checks   map[string]Check `json:"checks"`
+}
+
+// Liveness reports that the process is up and able to serve HTTP. It never
+// touches dependencies so that a database outage does not get the process
+// restarted.
+func Liveness(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": StatusOK})
+}
+
+// Readiness reports whether this instance should receive traffic, with a
+// breakdown per dependency. It returns 503 if any check fails or the
+// service is draining.
+func Readiness(c *fiber.Ctx) error {
+	report := Report{
+		Status:   StatusOK,
+		Draining: draining.Load(),
+		Checks:   map[string]Check{},
+	}
+
+	if database.DB == nil {
+		report.Checks["database"] = Check{Status: StatusFail, Error: "not connected"}
+	} else {
+		ctx, cancel := context.WithTimeout(c.UserContext(), PingTimeout)
+		defer cancel()
+
+		report.Checks["database"] = checkDatabase(ctx)
+		report.Checks["migrations"] = checkMigrations(ctx)
+		report.Checks["pool"] = checkPool()
+		if status := database.ReplicaStatus(); len(status) > 0 {
+			report.Checks["replicas"] = checkReplicas(status)
+		}
+	}
+
+	for _, check := range report.Checks {
+		if check.Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	if report.Draining {
+		report.Status = StatusFail
+	}
+
+	if report.Status != StatusOK {
+		c.Status(fiber.StatusServiceUnavailable)
+	}
+	return c.JSON(report)
+}
+
+func checkDatabase(ctx context.Context) Check {
+	start := time.Now()
+	err := database.DB.PingContext(ctx)
+	check := Check{
+		Status:    StatusOK,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		check.Status = StatusFail
+		check.Error = err.Error()
+	}
+	return check
+}
+
+func checkMigrations(ctx context.Context) Check {
+	ready, err := database.SchemaReady(ctx)
+	switch {
+	case err != nil:
+		return Check{Status: StatusFail, Error: err.Error()}
+	case !ready:
+		return Check{Status: StatusFail, Error: "schema migrations are pending"}
+	default:
+		return Check{Status: StatusOK}
+	}
+}
+
+// checkPool fails once every allowed connection is in use, since new
+// requests would queue behind the ones already running.
+func checkPool() Check {
+	stats := database.DB.Stats()
+	check := Check{
+		Status: StatusOK,
+		Details: map[string]interface{}{
+			"open":          stats.OpenConnections,
+			"in_use":        stats.InUse,
+			"idle":          stats.Idle,
+			"max_open":      stats.MaxOpenConnections,
+			"wait_count":    stats.WaitCount,
+			"wait_duration": stats.WaitDuration.String(),
+		},
+	}
+	if stats.MaxOpenConnections > 0 {
+		saturation := float64(stats.InUse) / float64(stats.MaxOpenConnections)
+		check.Details["saturation"] = saturation
+		if saturation >= 1 {
+			check.Status = StatusFail
+			check.Error = "connection pool saturated"
+		}
+	}
+	return check
+}
+
+// checkReplicas reports which replicas receive reads. It never fails
+// readiness because reads fall back to the primary.
+func checkReplicas(status map[string]bool) Check {
+	details := make(map[string]interface{}, len(status))
+	for name, healthy := range status {
+		if healthy {
+			details[name] = StatusOK
+		} else {
+			details[name] = StatusFail
+		}
+	}
+	return Check{Status: StatusOK, Details: details}
+}
@@ -0,0 +1,105 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/rsomcio/restapi/config"
+	"github.com/rsomcio/restapi/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/lib/pq"
+)
+
+func setupTestApp() *fiber.App {
+	app := fiber.New()
+	app.Get("/healthz", Liveness)
+	app.Get("/readyz", Readiness)
+	return app
+}
+
+func getReport(t *testing.T, app *fiber.App) (int, Report) {
+	t.Helper()
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/readyz", nil))
+	require.NoError(t, err)
+
+	var report Report
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	return resp.StatusCode, report
+}
+
+func TestLiveness(t *testing.T) {
+	originalDB := database.DB
+	defer func() { database.DB = originalDB }()
+	database.DB = nil
+
+	resp, err := setupTestApp().Test(httptest.NewRequest("GET", "/healthz", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+}
+
+func TestReadinessWithoutDatabase(t *testing.T) {
+	originalDB := database.DB
+	defer func() { database.DB = originalDB }()
+	database.DB = nil
+
+	status, report := getReport(t, setupTestApp())
+	assert.Equal(t, 503, status)
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, StatusFail, report.Checks["database"].Status)
+	assert.False(t, report.Draining)
+
+	SetDraining(true)
+	defer SetDraining(false)
+
+	_, report = getReport(t, setupTestApp())
+	assert.True(t, report.Draining)
+}
+
+func TestReadinessWithUnreachableDatabase(t *testing.T) {
+	originalDB := database.DB
+	defer func() { database.DB = originalDB }()
+
+	db, err := sqlx.Open("postgres", "postgres://user@127.0.0.1:1/events?sslmode=disable")
+	require.NoError(t, err)
+	defer db.Close()
+	database.DB = db
+
+	status, report := getReport(t, setupTestApp())
+	assert.Equal(t, 503, status)
+	assert.Equal(t, StatusFail, report.Checks["database"].Status)
+	assert.NotEmpty(t, report.Checks["database"].Error)
+	assert.Equal(t, StatusOK, report.Checks["pool"].Status)
+}
+
+func TestReadinessFailsWhileDraining(t *testing.T) {
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("DATABASE_URL not set, skipping integration test")
+	}
+
+	require.NoError(t, database.Connect(context.Background(), config.Database{URL: databaseURL}))
+	defer database.Close()
+	require.NoError(t, database.CreateTables())
+
+	app := setupTestApp()
+
+	status, report := getReport(t, app)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, StatusOK, report.Status)
+
+	SetDraining(true)
+	defer SetDraining(false)
+
+	status, report = getReport(t, app)
+	assert.Equal(t, 503, status)
+	assert.True(t, report.Draining)
+	assert.Equal(t, StatusOK, report.Checks["database"].Status)
+}
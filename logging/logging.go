@@ -0,0 +1,95 @@
+// Package logging builds the service's structured JSON logger and the fiber
+// middleware that correlates log lines with the request that produced them.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PrincipalKey is the fiber.Ctx locals key under which authentication
+// middleware stores the caller's identity for logging.
+const PrincipalKey = "principal"
+
+// RequestIDKey is the fiber.Ctx locals key used by the requestid middleware.
+const RequestIDKey = "requestid"
+
+// New returns a logger that writes JSON lines at or above level to w.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}))
+}
+
+// ParseLevel converts a level name such as "debug" or "WARN" to a slog.Level.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return slog.LevelInfo, fmt.Errorf("invalid log level %q", s)
+	}
+	return level, nil
+}
+
+// Ctx returns logger annotated with the request ID, method, path, principal
+// and trace ID of c, so that every line logged while serving a request can be
+// correlated. A nil logger falls back to slog.Default().
+func Ctx(c *fiber.Ctx, logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return logger.With(requestAttrs(c)...)
+}
+
+func requestAttrs(c *fiber.Ctx) []any {
+	attrs := []any{
+		slog.String("method", c.Method()),
+		slog.String("path", c.Path()),
+	}
+	if id, ok := c.Locals(RequestIDKey).(string); ok && id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	if principal, ok := c.Locals(PrincipalKey).(string); ok && principal != "" {
+		attrs = append(attrs, slog.String("principal", principal))
+	}
+	if sc := trace.SpanContextFromContext(c.UserContext()); sc.IsValid() {
+		attrs = append(attrs, slog.String("trace_id", sc.TraceID().String()))
+	}
+	return attrs
+}
+
+// Middleware logs one line per request with its status and latency. It must
+// be registered after the requestid middleware. Errors returned further down
+// the chain are rendered by the app's ErrorHandler first so that the logged
+// status matches what the client receives.
+func Middleware(logger *slog.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		if err := c.Next(); err != nil {
+			if err := c.App().ErrorHandler(c, err); err != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		status := c.Response().StatusCode()
+		level := slog.LevelInfo
+		switch {
+		case status >= fiber.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= fiber.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		Ctx(c, logger).LogAttrs(c.UserContext(), level, "request",
+			slog.String("route", c.Route().Path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("ip", c.IP()),
+		)
+		return nil
+	}
+}
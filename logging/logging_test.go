@@ -0,0 +1,103 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected slog.Level
+		valid    bool
+	}{
+		{"debug", slog.LevelDebug, true},
+		{"INFO", slog.LevelInfo, true},
+		{" warn ", slog.LevelWarn, true},
+		{"error", slog.LevelError, true},
+		{"verbose", slog.LevelInfo, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			level, err := ParseLevel(tt.input)
+			if tt.valid {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expected, level)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestMiddlewareLogsCorrelatedJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelDebug)
+
+	app := fiber.New(fiber.Config{
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			return c.Status(fiber.StatusTeapot).SendString(err.Error())
+		},
+	})
+	app.Use(requestid.New())
+	app.Use(Middleware(logger))
+	app.Get("/events/:id", func(c *fiber.Ctx) error {
+		c.Locals(PrincipalKey, "key-123")
+		Ctx(c, logger).Info("handler line")
+		return errors.New("short and stout")
+	})
+
+	req := httptest.NewRequest("GET", "/events/42", nil)
+	req.Header.Set(fiber.HeaderXRequestID, "req-abc")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusTeapot, resp.StatusCode)
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+
+	var handlerLine, accessLine map[string]interface{}
+	require.NoError(t, json.Unmarshal(lines[0], &handlerLine))
+	require.NoError(t, json.Unmarshal(lines[1], &accessLine))
+
+	assert.Equal(t, "handler line", handlerLine["msg"])
+	assert.Equal(t, "req-abc", handlerLine["request_id"])
+	assert.Equal(t, "key-123", handlerLine["principal"])
+
+	assert.Equal(t, "request", accessLine["msg"])
+	assert.Equal(t, "WARN", accessLine["level"])
+	assert.Equal(t, "req-abc", accessLine["request_id"])
+	assert.Equal(t, "GET", accessLine["method"])
+	assert.Equal(t, "/events/42", accessLine["path"])
+	assert.Equal(t, "/events/:id", accessLine["route"])
+	assert.Equal(t, float64(fiber.StatusTeapot), accessLine["status"])
+	assert.Equal(t, "key-123", accessLine["principal"])
+	assert.Contains(t, accessLine, "latency_ms")
+}
+
+func TestMiddlewareRespectsLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelWarn)
+
+	app := fiber.New()
+	app.Use(requestid.New())
+	app.Use(Middleware(logger))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Empty(t, buf.String())
+}
@@ -1,79 +1,233 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
 	"os"
-	"runtime"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/logger"
-	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/rsomcio/restapi/cache"
+	"github.com/rsomcio/restapi/changes"
+	"github.com/rsomcio/restapi/cli"
+	"github.com/rsomcio/restapi/config"
 	"github.com/rsomcio/restapi/database"
 	"github.com/rsomcio/restapi/handlers"
+	"github.com/rsomcio/restapi/health"
+	"github.com/rsomcio/restapi/logging"
+	"github.com/rsomcio/restapi/metrics"
+	"github.com/rsomcio/restapi/outbox"
+	"github.com/rsomcio/restapi/server"
+	"github.com/rsomcio/restapi/tracing"
+	"github.com/rsomcio/restapi/webhook"
+	"github.com/spf13/cobra"
 )
 
-func logError(msg string, args ...interface{}) {
-	_, file, line, ok := runtime.Caller(1)
-	if ok {
-		log.Printf("[%s:%d] "+msg, append([]interface{}{file, line}, args...)...)
-	} else {
-		log.Printf(msg, args...)
+func main() {
+	if err := rootCommand().Execute(); err != nil {
+		os.Exit(1)
 	}
 }
 
-func logInfo(msg string, args ...interface{}) {
-	_, file, line, ok := runtime.Caller(1)
-	if ok {
-		log.Printf("[%s:%d] "+msg, append([]interface{}{file, line}, args...)...)
-	} else {
-		log.Printf(msg, args...)
+// rootCommand serves the API when no subcommand is given, taking the flags
+// of config.Load, and holds the subcommands. Commands that use the database
+// take the same flags, followed by their own arguments.
+func rootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:                "restapi [-config FILE] [flags]",
+		Short:              "Events REST API server",
+		Long:               "Serves the events API. Run `restapi -help` for the server flags, which\nthe serve, migrate, seed, apikey and check-config commands also take.",
+		Args:               cobra.ArbitraryArgs,
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE:               serveE,
 	}
+	root.AddCommand(serveCommand(), migrateCommand(), seedCommand(), apikeyCommand(), checkConfigCommand(), cli.EventsCommand())
+	return root
 }
 
-func main() {
-	if err := database.Connect(); err != nil {
-		log.Fatal("Failed to connect to database:", err)
+func run(args []string) error {
+	cfg, err := config.Load(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	level, err := logging.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		return err
+	}
+
+	logger := logging.New(os.Stdout, level)
+	slog.SetDefault(logger)
+	database.SetLogger(logger)
+	handlers.SetLogger(logger)
+
+	logger.Info("Effective configuration", "config", cfg.Redacted())
+
+	// Background workers are stopped after in-flight requests have drained
+	// and before the database pool is closed.
+	var workers []func(context.Context) error
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing.Exporter)
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	workers = append(workers, shutdownTracing)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := database.Connect(ctx, cfg.Database); err != nil {
+		return err
 	}
 	defer database.Close()
 
+	if err := database.ConnectReplicas(ctx, cfg.Database); err != nil {
+		return err
+	}
+
+	if err := metrics.RegisterDB(database.DB.DB, "events"); err != nil {
+		return fmt.Errorf("failed to register database metrics: %w", err)
+	}
+	for name, db := range database.ReplicaPools() {
+		if err := metrics.RegisterDB(db.DB, "events-replica-"+name); err != nil {
+			return fmt.Errorf("failed to register replica metrics: %w", err)
+		}
+	}
+
 	if err := database.CreateTables(); err != nil {
-		log.Fatal("Failed to create database tables:", err)
-	}
-
-	app := fiber.New(fiber.Config{
-		ErrorHandler: func(c *fiber.Ctx, err error) error {
-			code := fiber.StatusInternalServerError
-			if e, ok := err.(*fiber.Error); ok {
-				code = e.Code
-			}
-			logError("Error: %v", err)
-			return c.Status(code).JSON(fiber.Map{
-				"error": err.Error(),
-			})
-		},
+		return err
+	}
+
+	dispatcher := webhook.New(webhook.Config{
+		Store:         webhook.DatabaseStore{},
+		Timeout:       cfg.Webhooks.Timeout,
+		MaxAttempts:   cfg.Webhooks.MaxAttempts,
+		Backoff:       cfg.Webhooks.Backoff,
+		BackoffMax:    cfg.Webhooks.BackoffMax,
+		DisableAfter:  cfg.Webhooks.DisableAfter,
+		Concurrency:   cfg.Webhooks.Concurrency,
+		Retention:     cfg.Webhooks.Retention,
+		AllowInternal: cfg.Webhooks.AllowInternal,
+		Logger:        logger,
 	})
+	dispatcher.Start()
+	handlers.SetAllowInternalWebhooks(cfg.Webhooks.AllowInternal)
 
-	app.Use(logger.New(logger.Config{
-		Format: "[${time}] ${status} - ${method} ${path} (${latency})\n",
-	}))
-	app.Use(recover.New())
-	app.Use(cors.New())
+	var sinks []outbox.Sink
+	for _, name := range cfg.Outbox.Sinks {
+		switch name {
+		case "webhooks":
+			sinks = append(sinks, dispatcher)
+		case "log":
+			sinks = append(sinks, outbox.LogSink{Logger: logger})
+		}
+	}
+
+	switch cfg.Cache.Backend {
+	case cache.BackendMemory:
+		handlers.SetCache(cache.NewMemory(cfg.Cache.MaxEntries), cfg.Cache.TTL)
+	case cache.BackendRedis:
+		redis := cache.NewRedis(cfg.Cache.RedisAddr, cfg.Cache.RedisPassword, cfg.Cache.RedisDB, cfg.Cache.RedisTimeout)
+		defer redis.Close()
+		handlers.SetCache(redis, cfg.Cache.TTL)
+		handlers.SetIdempotencyStore(redis)
+	}
+
+	// Every instance streams the changes made by all of them, as they are
+	// committed to the outbox, and drops the cached reads they make stale.
+	bus := changes.NewBus(cfg.Stream.ReplaySize)
+	handlers.SetChanges(bus)
+	feed := outbox.NewFeed(func(msg outbox.Message) {
+		handlers.InvalidateEvents(context.Background())
+		bus.Publish(msg.Seq, msg.Type, msg.Event)
+	}, logger)
+	if err := feed.Start(ctx, cfg.Database); err != nil {
+		return fmt.Errorf("failed to follow the outbox: %w", err)
+	}
+
+	relay := outbox.New(outbox.Config{
+		Sinks:           sinks,
+		PollInterval:    cfg.Outbox.PollInterval,
+		BatchSize:       cfg.Outbox.BatchSize,
+		RetryBackoff:    cfg.Outbox.RetryBackoff,
+		RetryBackoffMax: cfg.Outbox.RetryBackoffMax,
+		Lease:           cfg.Outbox.Lease,
+		Retention:       cfg.Outbox.Retention,
+		Logger:          logger,
+	})
+	relay.Start()
+	handlers.SetRelay(relay)
+	// The relay stops handing messages to the dispatcher before the
+	// dispatcher stops.
+	workers = append(workers, relay.Close, dispatcher.Close, feed.Close)
+
+	if err := handlers.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return err
+	}
+
+	app := server.New(cfg, logger)
 
-	api := app.Group("/api")
-	events := api.Group("/events")
+	addr := fmt.Sprintf(":%d", cfg.Server.Port)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	// Streams never finish on their own, so they are ended for the server
+	// to drain.
+	go func() {
+		<-ctx.Done()
+		bus.Close()
+	}()
+
+	logger.Info("Server starting", "port", cfg.Server.Port)
+	serveErr := serve(ctx, app, ln, cfg.Server.ShutdownTimeout)
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	for _, stopWorker := range workers {
+		if err := stopWorker(stopCtx); err != nil {
+			logger.Error("Failed to stop background worker", "error", err)
+		}
+	}
 
-	events.Post("/", handlers.CreateEvent)
-	events.Get("/", handlers.GetAllEvents)
-	events.Get("/:id", handlers.GetEventByID)
-	events.Put("/:id", handlers.UpdateEvent)
-	events.Delete("/:id", handlers.DeleteEvent)
+	logger.Info("Server stopped")
+	return serveErr
+}
+
+// serve runs app on ln until ctx is cancelled. It then marks the service as
+// draining, stops accepting connections and waits up to timeout for
+// in-flight requests to finish.
+func serve(ctx context.Context, app *fiber.App, ln net.Listener, timeout time.Duration) error {
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- app.Listener(ln)
+	}()
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "3000"
+	select {
+	case err := <-listenErr:
+		return err
+	case <-ctx.Done():
 	}
 
-	logInfo("Server starting on port %s", port)
-	log.Fatal(app.Listen(":" + port))
-}
\ No newline at end of file
+	health.SetDraining(true)
+	slog.Info("Shutting down, draining in-flight requests", "timeout", timeout)
+
+	if err := app.ShutdownWithTimeout(timeout); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("in-flight requests did not finish within %s", timeout)
+		}
+		return fmt.Errorf("failed to shut down server: %w", err)
+	}
+	return <-listenErr
+}
@@ -0,0 +1,109 @@
+// Package metrics exposes request, database pool and domain metrics in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rsomcio/restapi/apierror"
+)
+
+const namespace = "restapi"
+
+// Registry holds every metric exposed by the service. A dedicated registry
+// keeps tests independent of anything registered on the global default.
+var Registry = prometheus.NewRegistry()
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests processed, by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency, by method, route template and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	EventsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_created_total",
+		Help:      "Events created through the API.",
+	})
+
+	EventsUpdated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_updated_total",
+		Help:      "Events updated through the API.",
+	})
+
+	EventsDeleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_deleted_total",
+		Help:      "Events deleted through the API.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requestsTotal,
+		requestDuration,
+		EventsCreated,
+		EventsUpdated,
+		EventsDeleted,
+	)
+}
+
+// RegisterDB exposes the connection pool statistics of db, such as open and
+// in-use connections and time spent waiting for one, labelled with name.
+func RegisterDB(db *sql.DB, name string) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Middleware records the count and latency of every request. Requests that
+// matched no route are labelled "unmatched" to keep label cardinality
+// bounded.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		route := c.Route().Path
+		if err != nil {
+			status = apierror.From(err).Status
+			var fiberErr *fiber.Error
+			if errors.As(err, &fiberErr) && fiberErr.Code == fiber.StatusNotFound {
+				route = "unmatched"
+			}
+		}
+
+		labels := prometheus.Labels{
+			"method": c.Method(),
+			"route":  route,
+			"status": strconv.Itoa(status),
+		}
+		requestsTotal.With(labels).Inc()
+		requestDuration.With(labels).Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
+
+// Handler serves the contents of Registry for Prometheus to scrape.
+func Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"database/sql"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/lib/pq"
+)
+
+func setupTestApp() *fiber.App {
+	app := fiber.New()
+	app.Use(Middleware())
+	app.Get("/metrics", Handler())
+	app.Get("/api/events/:id", func(c *fiber.Ctx) error {
+		EventsCreated.Inc()
+		return c.SendString("ok")
+	})
+	return app
+}
+
+func TestMiddlewareRecordsRouteTemplate(t *testing.T) {
+	app := setupTestApp()
+
+	before := testutil.ToFloat64(requestsTotal.WithLabelValues("GET", "/api/events/:id", "200"))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/events/123", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	after := testutil.ToFloat64(requestsTotal.WithLabelValues("GET", "/api/events/:id", "200"))
+	assert.Equal(t, before+1, after)
+}
+
+func TestMiddlewareLabelsUnmatchedRoutes(t *testing.T) {
+	app := setupTestApp()
+
+	before := testutil.ToFloat64(requestsTotal.WithLabelValues("GET", "unmatched", "404"))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/nope/123", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+
+	after := testutil.ToFloat64(requestsTotal.WithLabelValues("GET", "unmatched", "404"))
+	assert.Equal(t, before+1, after)
+}
+
+func TestHandlerExposesTextFormat(t *testing.T) {
+	db, err := sql.Open("postgres", "postgres://localhost/none")
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, RegisterDB(db, "test"))
+
+	app := setupTestApp()
+
+	_, err = app.Test(httptest.NewRequest("GET", "/api/events/123", nil))
+	require.NoError(t, err)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/metrics", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/plain")
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	for _, name := range []string{
+		"restapi_http_requests_total",
+		"restapi_http_request_duration_seconds_bucket",
+		"restapi_events_created_total",
+		"restapi_events_updated_total",
+		"restapi_events_deleted_total",
+		`go_sql_open_connections{db_name="test"}`,
+		`go_sql_in_use_connections{db_name="test"}`,
+		`go_sql_wait_count_total{db_name="test"}`,
+		`go_sql_wait_duration_seconds_total{db_name="test"}`,
+	} {
+		assert.Contains(t, string(body), name)
+	}
+}
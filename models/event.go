@@ -19,26 +19,30 @@ type Event struct {
 	UpdatedAt        time.Time  `json:"updated_at" db:"updated_at"`
 }
 
+// Validation tags mirror the column limits of the events table in spec.md.
+// The dateformat, timeformat and emailformat tags are registered by the
+// handlers package.
+
 type CreateEventRequest struct {
-	Name             string  `json:"name"`
+	Name             string  `json:"name" validate:"required,max=255"`
 	Description      *string `json:"description"`
-	VenueName        string  `json:"venue_name"`
-	Address          string  `json:"address"`
-	Date             string  `json:"date"`
-	Time             string  `json:"time"`
-	ContactMobile    *string `json:"contact_mobile"`
-	ContactEmail     *string `json:"contact_email"`
-	ContactInstagram *string `json:"contact_instagram"`
+	VenueName        string  `json:"venue_name" validate:"required,max=255"`
+	Address          string  `json:"address" validate:"required"`
+	Date             string  `json:"date" validate:"required,dateformat"`
+	Time             string  `json:"time" validate:"required,timeformat"`
+	ContactMobile    *string `json:"contact_mobile" validate:"omitempty,max=20"`
+	ContactEmail     *string `json:"contact_email" validate:"omitempty,max=255,emailformat"`
+	ContactInstagram *string `json:"contact_instagram" validate:"omitempty,max=100"`
 }
 
 type UpdateEventRequest struct {
-	Name             string  `json:"name"`
+	Name             string  `json:"name" validate:"required,max=255"`
 	Description      *string `json:"description"`
-	VenueName        string  `json:"venue_name"`
-	Address          string  `json:"address"`
-	Date             string  `json:"date"`
-	Time             string  `json:"time"`
-	ContactMobile    *string `json:"contact_mobile"`
-	ContactEmail     *string `json:"contact_email"`
-	ContactInstagram *string `json:"contact_instagram"`
-}
\ No newline at end of file
+	VenueName        string  `json:"venue_name" validate:"required,max=255"`
+	Address          string  `json:"address" validate:"required"`
+	Date             string  `json:"date" validate:"required,dateformat"`
+	Time             string  `json:"time" validate:"required,timeformat"`
+	ContactMobile    *string `json:"contact_mobile" validate:"omitempty,max=20"`
+	ContactEmail     *string `json:"contact_email" validate:"omitempty,max=255,emailformat"`
+	ContactInstagram *string `json:"contact_instagram" validate:"omitempty,max=100"`
+}
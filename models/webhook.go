@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Event change types, as sent to webhooks.
+const (
+	EventCreated = "event.created"
+	EventUpdated = "event.updated"
+	EventDeleted = "event.deleted"
+)
+
+// Webhook is an endpoint that is sent the event types it subscribes to, or
+// every type when EventTypes is empty. The secret signing its deliveries is
+// only returned when the webhook is created.
+type Webhook struct {
+	ID                  string         `json:"id" db:"id"`
+	URL                 string         `json:"url" db:"url"`
+	EventTypes          pq.StringArray `json:"event_types" db:"event_types"`
+	Secret              string         `json:"secret,omitempty" db:"secret"`
+	Enabled             bool           `json:"enabled" db:"enabled"`
+	ConsecutiveFailures int            `json:"consecutive_failures" db:"consecutive_failures"`
+	DisabledAt          *time.Time     `json:"disabled_at" db:"disabled_at"`
+	CreatedAt           time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt           time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// The webhookurl tag is registered by the handlers package and accepts
+// absolute http and https URLs.
+
+type CreateWebhookRequest struct {
+	URL        string   `json:"url" validate:"required,max=2048,webhookurl"`
+	EventTypes []string `json:"event_types" validate:"dive,oneof=event.created event.updated event.deleted"`
+	// Secret is generated when it is not given.
+	Secret *string `json:"secret" validate:"omitempty,min=16,max=255"`
+}
+
+type UpdateWebhookRequest struct {
+	URL        string   `json:"url" validate:"required,max=2048,webhookurl"`
+	EventTypes []string `json:"event_types" validate:"dive,oneof=event.created event.updated event.deleted"`
+	// Enabled re-enables a webhook that was disabled after failing, and
+	// clears its failures.
+	Enabled bool `json:"enabled"`
+}
+
+// WebhookDelivery records one attempt to deliver a message to a webhook.
+type WebhookDelivery struct {
+	ID         int64     `json:"id" db:"id"`
+	WebhookID  string    `json:"webhook_id" db:"webhook_id"`
+	MessageID  string    `json:"message_id" db:"message_id"`
+	EventType  string    `json:"event_type" db:"event_type"`
+	Attempt    int       `json:"attempt" db:"attempt"`
+	StatusCode *int      `json:"status_code" db:"status_code"`
+	Error      *string   `json:"error" db:"error"`
+	DurationMS int       `json:"duration_ms" db:"duration_ms"`
+	Delivered  bool      `json:"delivered" db:"delivered"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
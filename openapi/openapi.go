@@ -0,0 +1,249 @@
+// Package openapi generates the OpenAPI 3.1 description of the API from the
+// route table and the Go types of request and response bodies, and serves
+// it together with a documentation page.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"html"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rsomcio/restapi/apierror"
+)
+
+// Version is the OpenAPI version of generated documents.
+const Version = "3.1.0"
+
+// Operation documents one route.
+type Operation struct {
+	Method string
+	// Path uses fiber syntax, e.g. /api/events/:id.
+	Path    string
+	ID      string
+	Summary string
+	Tags    []string
+	Params  []Parameter
+	// Request is a value of the request body type, or nil.
+	Request interface{}
+	// Responses lists the successful responses and any other response
+	// that is not a problem document.
+	Responses []Response
+	// Errors lists the statuses answered with a problem document.
+	Errors []int
+}
+
+// Parameter documents a path or query parameter. Path parameters that are
+// not listed are documented as plain strings.
+type Parameter struct {
+	Name        string
+	In          string
+	Description string
+	Required    bool
+	Schema      Schema
+}
+
+// Response documents one response. A nil Body means an empty body.
+type Response struct {
+	Status      int
+	Description string
+	// ContentType defaults to application/json.
+	ContentType string
+	Body        interface{}
+}
+
+var pathParam = regexp.MustCompile(`:(\w+)`)
+
+// Document is a generated OpenAPI document. It encodes to JSON and can
+// validate requests and responses against itself.
+type Document struct {
+	raw        map[string]interface{}
+	components schemas
+	ops        map[string]*compiled
+}
+
+// compiled holds the schemas of one operation, for validation.
+type compiled struct {
+	params    []Parameter
+	request   Schema
+	responses map[int]compiledResponse
+}
+
+type compiledResponse struct {
+	contentType string
+	schema      Schema
+}
+
+// Generate builds the document for ops.
+func Generate(title, version string, ops []Operation) *Document {
+	d := &Document{components: schemas{}, ops: map[string]*compiled{}}
+	paths := map[string]map[string]interface{}{}
+
+	for _, op := range ops {
+		path := pathParam.ReplaceAllString(op.Path, "{$1}")
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+		raw, c := d.operation(op)
+		paths[path][strings.ToLower(op.Method)] = raw
+		d.ops[op.Method+" "+op.Path] = c
+	}
+
+	d.raw = map[string]interface{}{
+		"openapi": Version,
+		"info":    map[string]interface{}{"title": title, "version": version},
+		"paths":   paths,
+	}
+	if len(d.components) > 0 {
+		d.raw["components"] = map[string]interface{}{"schemas": d.components}
+	}
+	return d
+}
+
+func (d *Document) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.raw)
+}
+
+func (d *Document) operation(op Operation) (map[string]interface{}, *compiled) {
+	c := &compiled{responses: map[int]compiledResponse{}}
+	out := map[string]interface{}{
+		"operationId": op.ID,
+		"summary":     op.Summary,
+	}
+	if len(op.Tags) > 0 {
+		out["tags"] = op.Tags
+	}
+
+	documented := map[string]bool{}
+	for _, p := range op.Params {
+		documented[p.Name] = true
+		c.params = append(c.params, p)
+	}
+	for _, m := range pathParam.FindAllStringSubmatch(op.Path, -1) {
+		if !documented[m[1]] {
+			c.params = append(c.params, Parameter{Name: m[1], In: "path", Schema: Schema{"type": "string"}})
+		}
+	}
+	if c.params != nil {
+		params := make([]interface{}, len(c.params))
+		for i, p := range c.params {
+			params[i] = parameter(p)
+		}
+		out["parameters"] = params
+	}
+
+	if op.Request != nil {
+		c.request = d.components.of(reflect.TypeOf(op.Request))
+		out["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				fiber.MIMEApplicationJSON: map[string]interface{}{"schema": c.request},
+			},
+		}
+	}
+
+	responses := map[string]interface{}{}
+	for _, r := range op.Responses {
+		response := map[string]interface{}{"description": r.Description}
+		if response["description"] == "" {
+			response["description"] = http.StatusText(r.Status)
+		}
+		var cr compiledResponse
+		if r.Body != nil {
+			cr.contentType = r.ContentType
+			if cr.contentType == "" {
+				cr.contentType = fiber.MIMEApplicationJSON
+			}
+			cr.schema = d.components.of(reflect.TypeOf(r.Body))
+			response["content"] = map[string]interface{}{
+				cr.contentType: map[string]interface{}{"schema": cr.schema},
+			}
+		}
+		c.responses[r.Status] = cr
+		responses[strconv.Itoa(r.Status)] = response
+	}
+
+	errors := append([]int(nil), op.Errors...)
+	sort.Ints(errors)
+	for _, status := range errors {
+		cr := compiledResponse{
+			contentType: apierror.ProblemContentType,
+			schema:      d.components.of(reflect.TypeOf(apierror.Problem{})),
+		}
+		c.responses[status] = cr
+		responses[strconv.Itoa(status)] = map[string]interface{}{
+			"description": http.StatusText(status),
+			"content": map[string]interface{}{
+				cr.contentType: map[string]interface{}{"schema": cr.schema},
+			},
+		}
+	}
+	out["responses"] = responses
+	return out, c
+}
+
+func parameter(p Parameter) map[string]interface{} {
+	out := map[string]interface{}{
+		"name":     p.Name,
+		"in":       p.In,
+		"required": p.Required || p.In == "path",
+		"schema":   p.Schema,
+	}
+	if p.Description != "" {
+		out["description"] = p.Description
+	}
+	return out
+}
+
+// Handler serves doc as JSON.
+func Handler(doc *Document) fiber.Handler {
+	body, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		panic("openapi: document cannot be encoded: " + err.Error())
+	}
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.Send(body)
+	}
+}
+
+//go:embed docs.html
+var docsPage string
+
+// DocsScript is the Redoc bundle the documentation page loads. Integrity is
+// its Subresource Integrity hash, such as "sha384-...", which browsers check
+// before running it, so that a changed bundle is refused.
+type DocsScript struct {
+	URL       string
+	Integrity string
+}
+
+// docsContentSecurityPolicy allows the documentation page to load script
+// and the resources it renders the document with.
+func docsContentSecurityPolicy(script DocsScript) string {
+	return "default-src 'self'; script-src 'self' " + script.URL + "; " +
+		"style-src 'self' 'unsafe-inline' https://fonts.googleapis.com; font-src https://fonts.gstatic.com; " +
+		"img-src 'self' data: https://cdn.redoc.ly; worker-src blob:; frame-ancestors 'none'"
+}
+
+// DocsHandler serves a page rendering the document found at specURL with
+// script.
+func DocsHandler(specURL string, script DocsScript) fiber.Handler {
+	page := strings.NewReplacer(
+		"{{SPEC_URL}}", html.EscapeString(specURL),
+		"{{SCRIPT_URL}}", html.EscapeString(script.URL),
+		"{{SCRIPT_INTEGRITY}}", html.EscapeString(script.Integrity),
+	).Replace(docsPage)
+	csp := docsContentSecurityPolicy(script)
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentSecurityPolicy, csp)
+		c.Type("html", "utf-8")
+		return c.SendString(page)
+	}
+}
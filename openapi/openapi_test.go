@@ -0,0 +1,94 @@
+package openapi
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type venue struct {
+	Name string `json:"name"`
+}
+
+type testRequest struct {
+	Title   string    `json:"title" validate:"required,max=10"`
+	Note    *string   `json:"note" validate:"omitempty,max=5"`
+	Day     string    `json:"day" validate:"required,dateformat"`
+	Count   int       `json:"count" validate:"min=1"`
+	Venue   *venue    `json:"venue"`
+	When    time.Time `json:"when"`
+	Tags    []string  `json:"tags" validate:"dive,oneof=red blue"`
+	Ignored string    `json:"-"`
+}
+
+// roundTrip returns doc as it appears to clients.
+func roundTrip(t *testing.T, doc *Document) map[string]interface{} {
+	t.Helper()
+	data, err := json.Marshal(doc)
+	require.NoError(t, err)
+	var out map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &out))
+	return out
+}
+
+func TestSchemaFromStructTags(t *testing.T) {
+	doc := roundTrip(t, Generate("Test", "1", []Operation{{
+		Method: "POST", Path: "/things", ID: "createThing",
+		Request:   testRequest{},
+		Responses: []Response{{Status: 201, Body: []venue{}}},
+	}}))
+
+	var want map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"schemas": {
+			"testRequest": {
+				"type": "object",
+				"required": ["title", "day"],
+				"properties": {
+					"title": {"type": "string", "minLength": 1, "maxLength": 10},
+					"note": {"type": ["string", "null"], "maxLength": 5},
+					"day": {"type": "string", "minLength": 1, "format": "date", "pattern": "^\\d{4}-\\d{2}-\\d{2}$"},
+					"count": {"type": "integer", "minimum": 1},
+					"venue": {"anyOf": [{"$ref": "#/components/schemas/venue"}, {"type": "null"}]},
+					"when": {"type": "string", "format": "date-time"},
+					"tags": {"type": "array", "items": {"type": "string", "enum": ["red", "blue"]}}
+				}
+			},
+			"venue": {
+				"type": "object",
+				"required": ["name"],
+				"properties": {"name": {"type": "string"}}
+			}
+		}
+	}`), &want))
+	assert.Equal(t, want, doc["components"])
+
+	post := doc["paths"].(map[string]interface{})["/things"].(map[string]interface{})["post"].(map[string]interface{})
+	schema := post["responses"].(map[string]interface{})["201"].(map[string]interface{})["content"].(map[string]interface{})["application/json"].(map[string]interface{})["schema"]
+	assert.Equal(t, map[string]interface{}{"type": "array", "items": map[string]interface{}{"$ref": "#/components/schemas/venue"}}, schema)
+}
+
+func TestPathParametersAndProblems(t *testing.T) {
+	doc := roundTrip(t, Generate("Test", "1", []Operation{{
+		Method: "DELETE", Path: "/things/:id/parts/:part", ID: "deletePart",
+		Params:    []Parameter{{Name: "id", In: "path", Schema: Schema{"type": "string", "format": "uuid"}}},
+		Responses: []Response{{Status: 204}},
+		Errors:    []int{404, 400},
+	}}))
+
+	op := doc["paths"].(map[string]interface{})["/things/{id}/parts/{part}"].(map[string]interface{})["delete"].(map[string]interface{})
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "id", "in": "path", "required": true, "schema": map[string]interface{}{"type": "string", "format": "uuid"}},
+		map[string]interface{}{"name": "part", "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"}},
+	}, op["parameters"])
+
+	responses := op["responses"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"description": "No Content"}, responses["204"])
+	assert.Contains(t, responses, "400")
+	notFound := responses["404"].(map[string]interface{})
+	assert.Contains(t, notFound["content"], "application/problem+json")
+	assert.Contains(t, doc["components"].(map[string]interface{})["schemas"], "Problem")
+}
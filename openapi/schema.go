@@ -0,0 +1,212 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Patterns for the custom validation rules registered by the handlers
+// package, so that the document describes what the API accepts.
+const (
+	datePattern = `^\d{4}-\d{2}-\d{2}$`
+	timePattern = `^([01]\d|2[0-3]):[0-5]\d:[0-5]\d$`
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemas collects the named component schemas referenced while describing
+// types.
+type schemas map[string]Schema
+
+// Schema is a JSON Schema object as used by OpenAPI 3.1.
+type Schema = map[string]interface{}
+
+// of returns the schema for t, registering named struct types as components
+// and referring to them.
+func (s schemas) of(t reflect.Type) Schema {
+	switch {
+	case t == timeType:
+		return Schema{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Pointer:
+		return nullable(s.of(t.Elem()))
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return Schema{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		if _, ok := s[t.Name()]; !ok {
+			s[t.Name()] = nil // guards against recursive types
+			s[t.Name()] = s.object(t)
+		}
+		return Schema{"$ref": "#/components/schemas/" + t.Name()}
+	default:
+		return Schema{}
+	}
+}
+
+// properties are the properties of an object schema, kept in struct field
+// order so that documents and validation errors list fields in the order
+// they are declared.
+type properties struct {
+	names   []string
+	schemas map[string]Schema
+}
+
+func (p *properties) add(name string, s Schema) {
+	p.names = append(p.names, name)
+	p.schemas[name] = s
+}
+
+func (p *properties) MarshalJSON() ([]byte, error) {
+	buf := []byte{'{'}
+	for i, name := range p.names {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(p.schemas[name])
+		if err != nil {
+			return nil, err
+		}
+		buf = append(append(append(buf, key...), ':'), value...)
+	}
+	return append(buf, '}'), nil
+}
+
+// object describes the JSON encoding of struct type t. Structs with validate
+// tags are request bodies, whose fields are required if validation says so;
+// in other structs a field is required if it is always present in the
+// output, i.e. not omitempty.
+func (s schemas) object(t reflect.Type) Schema {
+	props := &properties{schemas: map[string]Schema{}}
+	var required []string
+
+	input := false
+	for i := 0; i < t.NumField(); i++ {
+		if _, ok := t.Field(i).Tag.Lookup("validate"); ok {
+			input = true
+		}
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop := s.of(field.Type)
+		rules := field.Tag.Get("validate")
+		applyRules(prop, rules)
+		props.add(name, prop)
+
+		if input && hasRule(rules, "required") || !input && !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	schema := Schema{"type": "object", "properties": props}
+	if required != nil {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// applyRules adds the constraints of validate tag rules to prop. For a
+// nullable string they constrain the string, and rules after dive constrain
+// the items of an array.
+func applyRules(prop Schema, rules string) {
+	list := strings.Split(rules, ",")
+	for i, rule := range list {
+		name, arg, _ := strings.Cut(rule, "=")
+		switch name {
+		case "dive":
+			if items, ok := prop["items"].(Schema); ok {
+				applyRules(items, strings.Join(list[i+1:], ","))
+			}
+			return
+		case "oneof":
+			prop["enum"] = strings.Fields(arg)
+		case "webhookurl":
+			prop["format"] = "uri"
+		case "required":
+			if isString(prop) {
+				prop["minLength"] = 1
+			}
+		case "max", "min":
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				continue
+			}
+			key := map[string]string{"max": "maxLength", "min": "minLength"}[name]
+			if !isString(prop) {
+				key = map[string]string{"max": "maximum", "min": "minimum"}[name]
+			}
+			prop[key] = n
+		case "dateformat":
+			prop["format"] = "date"
+			prop["pattern"] = datePattern
+		case "timeformat":
+			prop["pattern"] = timePattern
+		case "emailformat", "email":
+			prop["format"] = "email"
+		case "uuid":
+			prop["format"] = "uuid"
+		}
+	}
+}
+
+func hasRule(rules, rule string) bool {
+	for _, r := range strings.Split(rules, ",") {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func isString(s Schema) bool {
+	switch t := s["type"].(type) {
+	case string:
+		return t == "string"
+	case []string:
+		return len(t) > 0 && t[0] == "string"
+	}
+	return false
+}
+
+// nullable allows null in addition to s.
+func nullable(s Schema) Schema {
+	if t, ok := s["type"].(string); ok {
+		s["type"] = []string{t, "null"}
+		return s
+	}
+	return Schema{"anyOf": []Schema{s, {"type": "null"}}}
+}
@@ -0,0 +1,432 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/rsomcio/restapi/apierror"
+)
+
+// emailRegex matches the rule the handlers apply to emailformat fields.
+var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+
+// patterns caches compiled schema patterns.
+var patterns sync.Map
+
+func compile(pattern string) *regexp.Regexp {
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+	re := regexp.MustCompile(pattern)
+	patterns.Store(pattern, re)
+	return re
+}
+
+// patternCodes names the error codes of the patterns generated for custom
+// validation rules, so that both layers of validation report them alike.
+var patternCodes = map[string]string{
+	datePattern: "dateformat",
+	timePattern: "timeformat",
+}
+
+// ValidateOptions configures Validator.
+type ValidateOptions struct {
+	// Responses also checks every response against the document and turns
+	// a mismatch into a 500 listing the differences. It is meant for tests.
+	Responses bool
+}
+
+// Validator checks the path parameters, query parameters and JSON body of
+// requests to the route registered as method and path against the document
+// before the handlers run, and rejects invalid requests with field-level
+// errors.
+func (d *Document) Validator(method, path string, opts ValidateOptions) fiber.Handler {
+	op, ok := d.ops[method+" "+path]
+	if !ok {
+		panic("openapi: no operation documented for " + method + " " + path)
+	}
+
+	return func(c *fiber.Ctx) error {
+		if err := d.validateRequest(c, op); err != nil {
+			return err
+		}
+		if !opts.Responses || c.Method() == fiber.MethodHead {
+			return c.Next()
+		}
+
+		if err := c.Next(); err != nil {
+			if err := c.App().ErrorHandler(c, err); err != nil {
+				return err
+			}
+		}
+		if fields := d.validateResponse(c, op); fields != nil {
+			e := apierror.Internal("Response does not match the OpenAPI document",
+				fmt.Errorf("%s %s answered %d with a body not matching the document", method, path, c.Response().StatusCode()))
+			e.Fields = fields
+			return e
+		}
+		return nil
+	}
+}
+
+func (d *Document) validateRequest(c *fiber.Ctx, op *compiled) error {
+	v := validator{components: d.components}
+	for _, p := range op.params {
+		var raw string
+		switch p.In {
+		case "path":
+			raw = c.Params(p.Name)
+		case "query":
+			raw = c.Query(p.Name)
+		default:
+			continue
+		}
+		if raw == "" {
+			if p.Required || p.In == "path" {
+				v.fail(p.Name, "required", "%s is required", p.Name)
+			}
+			continue
+		}
+		v.check(p.Name, paramValue(raw, p.Schema), p.Schema)
+	}
+	if v.errs != nil {
+		return apierror.Validation(v.errs)
+	}
+
+	if op.request == nil || !isJSON(string(c.Request().Header.ContentType())) {
+		// Other content types are left to the handler's body parser.
+		return nil
+	}
+	body, err := decode(c.Body())
+	if err != nil {
+		return apierror.BadRequest("Invalid request body")
+	}
+	v.check("", body, op.request)
+	if v.errs != nil {
+		return apierror.Validation(v.errs)
+	}
+	return nil
+}
+
+func (d *Document) validateResponse(c *fiber.Ctx, op *compiled) []apierror.FieldError {
+	status := c.Response().StatusCode()
+	expected, ok := op.responses[status]
+	if !ok {
+		return []apierror.FieldError{{Code: "status", Message: fmt.Sprintf("status %d is not documented", status)}}
+	}
+	if expected.schema == nil {
+		if len(c.Response().Body()) > 0 {
+			return []apierror.FieldError{{Code: "body", Message: fmt.Sprintf("status %d is documented without a body", status)}}
+		}
+		return nil
+	}
+
+	contentType := string(c.Response().Header.ContentType())
+	if mediaType(contentType) != mediaType(expected.contentType) {
+		return []apierror.FieldError{{Code: "content_type", Message: fmt.Sprintf("content type %q, documented %q", contentType, expected.contentType)}}
+	}
+	if !isJSON(contentType) {
+		return nil
+	}
+
+	body, err := decode(c.Response().Body())
+	if err != nil {
+		return []apierror.FieldError{{Code: "body", Message: "body is not valid JSON: " + err.Error()}}
+	}
+	v := validator{components: d.components}
+	v.check("", body, expected.schema)
+	return v.errs
+}
+
+// decode parses a single JSON value, keeping numbers exact.
+func decode(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return v, nil
+}
+
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	return mt
+}
+
+func isJSON(contentType string) bool {
+	mt := mediaType(contentType)
+	return mt == fiber.MIMEApplicationJSON || strings.HasSuffix(mt, "+json")
+}
+
+// paramValue converts a raw parameter to the JSON type its schema expects,
+// leaving it a string when it does not parse so that the type check fails.
+func paramValue(raw string, s Schema) interface{} {
+	switch schemaTypes(s)[0] {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(raw, 64); err == nil {
+			return json.Number(raw)
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(raw); err == nil {
+			return b
+		}
+	}
+	return raw
+}
+
+// validator checks decoded JSON values against schemas, recording at most
+// one error per value.
+type validator struct {
+	components schemas
+	errs       []apierror.FieldError
+}
+
+func (v *validator) fail(field, code, format string, args ...interface{}) {
+	v.errs = append(v.errs, apierror.FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) check(field string, value interface{}, s Schema) {
+	if ref, ok := s["$ref"].(string); ok {
+		s = v.components[strings.TrimPrefix(ref, "#/components/schemas/")]
+	}
+
+	if variants, ok := s["anyOf"].([]Schema); ok {
+		var first []apierror.FieldError
+		for i, variant := range variants {
+			sub := validator{components: v.components}
+			sub.check(field, value, variant)
+			if sub.errs == nil {
+				return
+			}
+			if i == 0 {
+				first = sub.errs
+			}
+		}
+		v.errs = append(v.errs, first...)
+		return
+	}
+
+	types := schemaTypes(s)
+	if types == nil {
+		return
+	}
+	actual := jsonType(value)
+	if !typeAllowed(actual, types) {
+		v.fail(field, "type", "%s must be %s", describe(field), article(types[0]))
+		return
+	}
+
+	switch value := value.(type) {
+	case string:
+		v.checkString(field, value, s)
+	case json.Number:
+		v.checkNumber(field, value, s)
+	case map[string]interface{}:
+		v.checkObject(field, value, s)
+	case []interface{}:
+		items, _ := s["items"].(Schema)
+		for i, item := range value {
+			v.check(fmt.Sprintf("%s[%d]", field, i), item, items)
+		}
+	}
+}
+
+func (v *validator) checkString(field, value string, s Schema) {
+	length := utf8.RuneCountInString(value)
+	if min, ok := s["minLength"].(int); ok && length < min {
+		if min == 1 {
+			v.fail(field, "required", "%s is required", field)
+		} else {
+			v.fail(field, "min", "%s must be at least %d characters", field, min)
+		}
+		return
+	}
+	if max, ok := s["maxLength"].(int); ok && length > max {
+		v.fail(field, "max", "%s must be at most %d characters", field, max)
+		return
+	}
+	if value == "" {
+		// Like omitempty in the struct tags, formats apply to values.
+		return
+	}
+
+	switch s["format"] {
+	case "date":
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			v.fail(field, "dateformat", "Invalid date format. Use YYYY-MM-DD format")
+			return
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339Nano, value); err != nil {
+			v.fail(field, "datetime", "%s must be an RFC 3339 date-time", field)
+			return
+		}
+	case "email":
+		if !emailRegex.MatchString(value) {
+			v.fail(field, "emailformat", "Invalid email format")
+			return
+		}
+	case "uuid":
+		if _, err := uuid.Parse(value); err != nil {
+			v.fail(field, "uuid", "%s must be a valid UUID", field)
+			return
+		}
+	}
+
+	if enum, ok := s["enum"].([]string); ok && !slices.Contains(enum, value) {
+		v.fail(field, "oneof", "%s must be one of %s", field, strings.Join(enum, ", "))
+		return
+	}
+
+	if pattern, ok := s["pattern"].(string); ok {
+		if !compile(pattern).MatchString(value) {
+			switch patternCodes[pattern] {
+			case "timeformat":
+				v.fail(field, "timeformat", "Invalid time format. Use HH:MM:SS format")
+			case "dateformat":
+				v.fail(field, "dateformat", "Invalid date format. Use YYYY-MM-DD format")
+			default:
+				v.fail(field, "pattern", "%s must match %s", field, pattern)
+			}
+		}
+	}
+}
+
+func (v *validator) checkNumber(field string, value json.Number, s Schema) {
+	n, err := value.Float64()
+	if err != nil {
+		v.fail(field, "type", "%s must be a number", describe(field))
+		return
+	}
+	if schemaTypes(s)[0] == "integer" && strings.ContainsAny(value.String(), ".eE") {
+		v.fail(field, "type", "%s must be an integer", describe(field))
+		return
+	}
+	if min, ok := s["minimum"].(int); ok && n < float64(min) {
+		v.fail(field, "min", "%s must be at least %d", field, min)
+		return
+	}
+	if max, ok := s["maximum"].(int); ok && n > float64(max) {
+		v.fail(field, "max", "%s must be at most %d", field, max)
+	}
+}
+
+func (v *validator) checkObject(field string, value map[string]interface{}, s Schema) {
+	required := map[string]bool{}
+	if names, ok := s["required"].([]string); ok {
+		for _, name := range names {
+			required[name] = true
+		}
+	}
+
+	known := map[string]bool{}
+	if props, ok := s["properties"].(*properties); ok {
+		for _, name := range props.names {
+			known[name] = true
+			child, present := value[name]
+			switch {
+			case present:
+				v.check(join(field, name), child, props.schemas[name])
+			case required[name]:
+				v.fail(join(field, name), "required", "%s is required", join(field, name))
+			}
+		}
+	}
+
+	if extra, ok := s["additionalProperties"].(Schema); ok {
+		names := make([]string, 0, len(value))
+		for name := range value {
+			if !known[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			v.check(join(field, name), value[name], extra)
+		}
+	}
+}
+
+func join(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+func describe(field string) string {
+	if field == "" {
+		return "body"
+	}
+	return field
+}
+
+func schemaTypes(s Schema) []string {
+	switch t := s["type"].(type) {
+	case string:
+		return []string{t}
+	case []string:
+		return t
+	}
+	return nil
+}
+
+func jsonType(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if strings.ContainsAny(value.String(), ".eE") {
+			return "number"
+		}
+		return "integer"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func typeAllowed(actual string, allowed []string) bool {
+	for _, t := range allowed {
+		if t == actual || t == "number" && actual == "integer" || t == "integer" && actual == "number" {
+			return true
+		}
+	}
+	return false
+}
+
+func article(t string) string {
+	switch t {
+	case "integer", "array", "object":
+		return "an " + t
+	case "null":
+		return "null"
+	default:
+		return "a " + t
+	}
+}
@@ -0,0 +1,174 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rsomcio/restapi/apierror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type thing struct {
+	ID   string `json:"id"`
+	Size int    `json:"size"`
+}
+
+// newValidatedApp serves the operations of testRequest through Validator,
+// answering with respond.
+func newValidatedApp(t *testing.T, opts ValidateOptions, respond fiber.Handler) *fiber.App {
+	t.Helper()
+	doc := Generate("Test", "1", []Operation{
+		{
+			Method: "PUT", Path: "/things/:id",
+			Params:    []Parameter{{Name: "id", In: "path", Schema: Schema{"type": "string", "format": "uuid"}}},
+			Request:   testRequest{},
+			Responses: []Response{{Status: 200, Body: thing{}}},
+			Errors:    []int{400},
+		},
+		{
+			Method: "GET", Path: "/things",
+			Params:    []Parameter{{Name: "limit", In: "query", Schema: Schema{"type": "integer", "minimum": 1, "maximum": 100}}},
+			Responses: []Response{{Status: 200, Body: []thing{}}},
+			Errors:    []int{400},
+		},
+	})
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.Handler(apierror.Options{})})
+	app.Put("/things/:id", doc.Validator("PUT", "/things/:id", opts), respond)
+	app.Get("/things", doc.Validator("GET", "/things", opts), respond)
+	return app
+}
+
+func send(t *testing.T, app *fiber.App, method, target, body string) (int, apierror.Problem) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+
+	var problem apierror.Problem
+	if resp.Header.Get("Content-Type") == apierror.ProblemContentType {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&problem))
+	}
+	return resp.StatusCode, problem
+}
+
+func TestValidatorRejectsInvalidRequests(t *testing.T) {
+	app := newValidatedApp(t, ValidateOptions{}, func(c *fiber.Ctx) error {
+		return c.JSON(thing{ID: "1"})
+	})
+	const id = "/things/123e4567-e89b-12d3-a456-426614174000"
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+		detail string
+		fields []apierror.FieldError
+	}{
+		{
+			name: "valid", method: "PUT", target: id,
+			body:   `{"title": "Fair", "day": "2024-03-15", "count": 2, "venue": null, "when": "2024-03-15T10:00:00Z"}`,
+			status: 200,
+		},
+		{
+			name: "every field problem in declaration order", method: "PUT", target: id,
+			body:   `{"title": "", "note": "too long", "day": "2024-02-30", "count": 0, "venue": {"name": 5}}`,
+			status: 400, detail: "Validation failed",
+			fields: []apierror.FieldError{
+				{Field: "title", Code: "required", Message: "title is required"},
+				{Field: "note", Code: "max", Message: "note must be at most 5 characters"},
+				{Field: "day", Code: "dateformat", Message: "Invalid date format. Use YYYY-MM-DD format"},
+				{Field: "count", Code: "min", Message: "count must be at least 1"},
+				{Field: "venue.name", Code: "type", Message: "venue.name must be a string"},
+			},
+		},
+		{
+			name: "missing fields", method: "PUT", target: id,
+			body:   `{}`,
+			status: 400, detail: "Validation failed",
+			fields: []apierror.FieldError{
+				{Field: "title", Code: "required", Message: "title is required"},
+				{Field: "day", Code: "required", Message: "day is required"},
+			},
+		},
+		{
+			name: "array items", method: "PUT", target: id,
+			body:   `{"title": "Fair", "day": "2024-03-15", "count": 1, "tags": ["red", "green"]}`,
+			status: 400, detail: "Validation failed",
+			fields: []apierror.FieldError{{Field: "tags[1]", Code: "oneof", Message: "tags[1] must be one of red, blue"}},
+		},
+		{
+			name: "body of the wrong type", method: "PUT", target: id,
+			body:   `[]`,
+			status: 400, detail: "Validation failed",
+			fields: []apierror.FieldError{{Code: "type", Message: "body must be an object"}},
+		},
+		{
+			name: "malformed JSON", method: "PUT", target: id,
+			body:   `{"title": `,
+			status: 400, detail: "Invalid request body",
+		},
+		{
+			name: "path parameter checked before the body", method: "PUT", target: "/things/abc",
+			body:   `{}`,
+			status: 400, detail: "Validation failed",
+			fields: []apierror.FieldError{{Field: "id", Code: "uuid", Message: "id must be a valid UUID"}},
+		},
+		{
+			name: "query parameter type", method: "GET", target: "/things?limit=ten",
+			status: 400, detail: "Validation failed",
+			fields: []apierror.FieldError{{Field: "limit", Code: "type", Message: "limit must be an integer"}},
+		},
+		{
+			name: "query parameter range", method: "GET", target: "/things?limit=500",
+			status: 400, detail: "Validation failed",
+			fields: []apierror.FieldError{{Field: "limit", Code: "max", Message: "limit must be at most 100"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, problem := send(t, app, tt.method, tt.target, tt.body)
+			assert.Equal(t, tt.status, status)
+			assert.Equal(t, tt.detail, problem.Detail)
+			assert.Equal(t, tt.fields, problem.Fields)
+		})
+	}
+}
+
+func TestValidatorChecksResponses(t *testing.T) {
+	var respond func(c *fiber.Ctx) error
+	app := newValidatedApp(t, ValidateOptions{Responses: true}, func(c *fiber.Ctx) error {
+		return respond(c)
+	})
+
+	respond = func(c *fiber.Ctx) error { return c.JSON([]thing{{ID: "1", Size: 2}}) }
+	status, _ := send(t, app, "GET", "/things", "")
+	assert.Equal(t, 200, status)
+
+	respond = func(c *fiber.Ctx) error { return apierror.BadRequest("nope") }
+	status, problem := send(t, app, "GET", "/things", "")
+	assert.Equal(t, 400, status, "documented problems pass")
+	assert.Equal(t, "nope", problem.Detail)
+
+	respond = func(c *fiber.Ctx) error { return c.JSON([]fiber.Map{{"id": 1}}) }
+	status, problem = send(t, app, "GET", "/things", "")
+	assert.Equal(t, 500, status)
+	assert.Equal(t, "Response does not match the OpenAPI document", problem.Detail)
+	assert.Equal(t, []apierror.FieldError{
+		{Field: "[0].id", Code: "type", Message: "[0].id must be a string"},
+		{Field: "[0].size", Code: "required", Message: "[0].size is required"},
+	}, problem.Fields)
+
+	respond = func(c *fiber.Ctx) error { return apierror.NotFound("gone") }
+	status, problem = send(t, app, "GET", "/things", "")
+	assert.Equal(t, 500, status)
+	assert.Equal(t, "status 404 is not documented", problem.Fields[0].Message)
+}
@@ -0,0 +1,122 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strconv"
+
+	"github.com/rsomcio/restapi/config"
+	"github.com/rsomcio/restapi/database"
+)
+
+// catchUpWindow is how far before the latest message seen a Feed looks for
+// messages missed while it was disconnected. Messages are numbered when
+// written but committed in any order, so one numbered before the latest seen
+// may still be committed after it.
+const catchUpWindow = 1000
+
+// Feed passes every message committed to the outbox, by this or any other
+// instance, to its callback once, in the order they were committed. It
+// learns of them with LISTEN, and after losing its connection it looks
+// through the outbox for the messages it missed.
+type Feed struct {
+	publish  func(Message)
+	logger   *slog.Logger
+	listener *database.Listener
+
+	// floor is the latest message when the feed started; earlier ones are
+	// never passed on.
+	floor int64
+	// latest is the highest Seq passed on, and seen the Seqs passed on
+	// within catchUpWindow of it.
+	latest int64
+	seen   map[int64]bool
+}
+
+// NewFeed returns a Feed that passes messages to publish. It does nothing
+// until Start is called.
+func NewFeed(publish func(Message), logger *slog.Logger) *Feed {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Feed{publish: publish, logger: logger, seen: make(map[int64]bool)}
+}
+
+// Start starts following the outbox with the connection settings of cfg.
+func (f *Feed) Start(ctx context.Context, cfg config.Database) error {
+	err := database.DB.GetContext(ctx, &f.floor, "SELECT COALESCE(MAX(seq), 0) FROM outbox")
+	if err != nil {
+		return err
+	}
+	f.latest = f.floor
+
+	f.listener, err = database.Listen(cfg, notifyChannel, f.notified, f.catchUp)
+	return err
+}
+
+// Close stops following the outbox.
+func (f *Feed) Close(ctx context.Context) error {
+	if f.listener == nil {
+		return nil
+	}
+	return f.listener.Close(ctx)
+}
+
+func (f *Feed) notified(payload string) {
+	seq, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		f.logger.Error("Ignored malformed outbox notification", "payload", payload)
+		return
+	}
+	if f.seen[seq] || seq <= f.floor {
+		return
+	}
+
+	var r row
+	err = database.DB.Get(&r, "SELECT seq, id, type, payload, created_at, attempts FROM outbox WHERE seq = $1", seq)
+	if errors.Is(err, sql.ErrNoRows) {
+		return // already deleted as published long ago
+	}
+	if err != nil {
+		f.logger.Error("Failed to read notified outbox message", "seq", seq, "error", err)
+		return
+	}
+	f.pass(r)
+}
+
+// catchUp passes on the messages committed while the feed was not
+// listening.
+func (f *Feed) catchUp() {
+	from := max(f.floor, f.latest-catchUpWindow)
+	var rows []row
+	err := database.DB.Select(&rows, "SELECT seq, id, type, payload, created_at, attempts FROM outbox WHERE seq > $1 ORDER BY seq", from)
+	if err != nil {
+		f.logger.Error("Failed to catch up with the outbox", "error", err)
+		return
+	}
+	for _, r := range rows {
+		if !f.seen[r.Seq] {
+			f.pass(r)
+		}
+	}
+}
+
+func (f *Feed) pass(r row) {
+	msg, err := r.message()
+	if err != nil {
+		f.logger.Error("Failed to pass on outbox message", "seq", r.Seq, "error", err)
+		return
+	}
+	f.seen[r.Seq] = true
+	if r.Seq > f.latest {
+		f.latest = r.Seq
+		for seq := range f.seen {
+			if seq <= f.latest-catchUpWindow {
+				delete(f.seen, seq)
+			}
+		}
+	}
+	f.publish(msg)
+}
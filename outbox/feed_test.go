@@ -0,0 +1,84 @@
+package outbox
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rsomcio/restapi/config"
+	"github.com/rsomcio/restapi/database"
+	"github.com/rsomcio/restapi/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeedForgetsOldMessages(t *testing.T) {
+	var passed []int64
+	f := NewFeed(func(msg Message) { passed = append(passed, msg.Seq) }, nil)
+
+	for _, seq := range []int64{5, 3, catchUpWindow + 4, catchUpWindow + 6} {
+		f.pass(row{Seq: seq, Payload: []byte(`{}`)})
+	}
+	assert.Equal(t, []int64{5, 3, catchUpWindow + 4, catchUpWindow + 6}, passed)
+	assert.Equal(t, int64(catchUpWindow+6), f.latest)
+	assert.False(t, f.seen[3], "messages outside the catch-up window are forgotten")
+	assert.True(t, f.seen[catchUpWindow+4])
+
+	f.pass(row{Seq: 7, Payload: []byte(`not json`)})
+	assert.Len(t, passed, 4, "undecodable messages are skipped")
+	assert.False(t, f.seen[7])
+}
+
+func TestFeedIntegration(t *testing.T) {
+	// Skip this test if no DATABASE_URL is set in environment
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("DATABASE_URL not set, skipping integration test")
+	}
+
+	ctx := context.Background()
+	cfg := config.Default().Database
+	cfg.URL = databaseURL
+	if database.DB == nil {
+		require.NoError(t, database.Connect(ctx, cfg))
+	}
+	require.NoError(t, database.CreateTables())
+
+	event := models.Event{ID: "7b6f0c1e-2a9d-4c1b-9f3e-2d4a5b6c7d8e", Name: "Feed Fair"}
+	defer database.DB.Exec("DELETE FROM outbox WHERE event_id = $1", event.ID)
+	write := func(eventType string) {
+		tx, err := database.DB.BeginTxx(ctx, nil)
+		require.NoError(t, err)
+		require.NoError(t, Write(ctx, tx, eventType, event))
+		require.NoError(t, tx.Commit())
+	}
+	// Messages written before the feed starts are not passed on.
+	write(models.EventCreated)
+
+	// Two feeds stand in for two instances.
+	received := [2]chan Message{make(chan Message, 10), make(chan Message, 10)}
+	for _, ch := range received {
+		f := NewFeed(func(msg Message) { ch <- msg }, nil)
+		require.NoError(t, f.Start(ctx, cfg))
+		defer f.Close(ctx)
+	}
+
+	write(models.EventUpdated)
+	write(models.EventDeleted)
+
+	for _, ch := range received {
+		var types []string
+		for len(types) < 2 {
+			select {
+			case msg := <-ch:
+				if msg.Event.ID == event.ID {
+					types = append(types, msg.Type)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("received only %v", types)
+			}
+		}
+		assert.Equal(t, []string{models.EventUpdated, models.EventDeleted}, types)
+	}
+}
@@ -0,0 +1,61 @@
+// Package outbox publishes changes to events reliably. A change is written
+// to the outbox table in the same transaction as the change itself, and a
+// Relay later sends it to the configured sinks, so that a crash between the
+// two can delay a message but never lose it. A Feed also passes every
+// message to every instance as soon as it is committed.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rsomcio/restapi/models"
+)
+
+// Message is a change to an event, as read back from the outbox.
+type Message struct {
+	// Seq orders the messages; messages about one event are relayed in Seq
+	// order.
+	Seq int64
+	// ID identifies the message. A message may be sent more than once, but
+	// always with the same ID.
+	ID        string
+	Type      string
+	Event     models.Event
+	CreatedAt time.Time
+	// Attempts counts earlier attempts to relay the message.
+	Attempts int
+}
+
+// Sink is where the relay sends messages. Send returns nil once the sink has
+// taken responsibility for msg; an error has it sent again later.
+type Sink interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// notifyChannel is the channel on which the Seq of each message is sent,
+// with NOTIFY, when the message is committed.
+const notifyChannel = "outbox"
+
+// Write records that event changed, as eventType, in tx. It must be called
+// after the change is written, so that the event's row is locked and changes
+// to one event are numbered in the order they commit.
+func Write(ctx context.Context, tx *sqlx.Tx, eventType string, event models.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode outbox message: %w", err)
+	}
+	query := `
+		WITH message AS (
+			INSERT INTO outbox (type, event_id, payload) VALUES ($1, $2, $3) RETURNING seq
+		)
+		SELECT pg_notify($4, seq::text) FROM message`
+	_, err = tx.ExecContext(ctx, query, eventType, event.ID, payload, notifyChannel)
+	if err != nil {
+		return fmt.Errorf("failed to write outbox message: %w", err)
+	}
+	return nil
+}
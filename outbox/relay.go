@@ -0,0 +1,312 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rsomcio/restapi/database"
+	"github.com/rsomcio/restapi/models"
+)
+
+// Config configures a Relay.
+type Config struct {
+	// Sinks are sent every message, in order. A message is only marked
+	// published once all of them accept it, so a sink that fails has the
+	// message sent again to those that did not.
+	Sinks []Sink
+	// PollInterval is how often the outbox is checked for messages when
+	// the relay is not woken.
+	PollInterval time.Duration
+	// BatchSize bounds the messages claimed at once.
+	BatchSize int
+	// RetryBackoff is the delay before a failed message is sent again,
+	// doubled after each attempt up to RetryBackoffMax.
+	RetryBackoff    time.Duration
+	RetryBackoffMax time.Duration
+	// Lease is how long a relay may take to send the messages it claims
+	// before other relays may claim them again.
+	Lease time.Duration
+	// Retention is how long published messages are kept. Zero keeps them.
+	Retention time.Duration
+	Logger    *slog.Logger
+}
+
+// cleanupInterval is how often published messages past Retention are
+// deleted.
+const cleanupInterval = time.Minute
+
+// Relay sends the messages in the outbox to its sinks. Any number of relays,
+// in any number of processes, may share the outbox: each message is claimed
+// by one of them at a time, and no message about an event is sent until the
+// earlier ones about it have been published.
+type Relay struct {
+	cfg    Config
+	logger *slog.Logger
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// New returns a Relay. Unset numbers in cfg take usable defaults. It does
+// nothing until Start is called.
+func New(cfg Config) *Relay {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = time.Second
+	}
+	if cfg.RetryBackoffMax < cfg.RetryBackoff {
+		cfg.RetryBackoffMax = cfg.RetryBackoff
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = time.Minute
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Relay{
+		cfg:    cfg,
+		logger: logger,
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Start relays messages in the background until Close is called.
+func (r *Relay) Start() {
+	go r.run()
+}
+
+// Wake has the relay check the outbox now rather than at its next poll, as
+// after a change has been committed.
+func (r *Relay) Wake() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops the relay and waits until the batch in progress has been
+// relayed or ctx is done. Messages not yet published stay in the outbox.
+func (r *Relay) Close(ctx context.Context) error {
+	r.once.Do(func() { close(r.stop) })
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("outbox relay did not stop: %w", ctx.Err())
+	}
+}
+
+func (r *Relay) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	var lastCleanup time.Time
+	for {
+		// The batch is not cancelled by Close: a message sent but not
+		// marked published would only be sent again.
+		n, err := r.RelayOnce(context.Background())
+		if err != nil {
+			r.logger.Error("Failed to relay outbox messages", "error", err)
+		}
+		if r.cfg.Retention > 0 && time.Since(lastCleanup) >= cleanupInterval {
+			lastCleanup = time.Now()
+			if err := r.cleanup(context.Background()); err != nil {
+				r.logger.Error("Failed to delete published outbox messages", "error", err)
+			}
+		}
+
+		// A full batch suggests more are waiting.
+		if n == r.cfg.BatchSize && err == nil {
+			select {
+			case <-r.stop:
+				return
+			default:
+				continue
+			}
+		}
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+type row struct {
+	Seq       int64     `db:"seq"`
+	ID        string    `db:"id"`
+	Type      string    `db:"type"`
+	Payload   []byte    `db:"payload"`
+	CreatedAt time.Time `db:"created_at"`
+	Attempts  int       `db:"attempts"`
+}
+
+func (r row) message() (Message, error) {
+	var event models.Event
+	if err := json.Unmarshal(r.Payload, &event); err != nil {
+		return Message{}, fmt.Errorf("failed to decode outbox message: %w", err)
+	}
+	return Message{Seq: r.Seq, ID: r.ID, Type: r.Type, Event: event, CreatedAt: r.CreatedAt, Attempts: r.Attempts}, nil
+}
+
+// claimQuery locks the next messages that are due, skipping those being
+// claimed by other relays and those with an earlier message about the same
+// event still unpublished. Leased messages are not due until their lease
+// runs out.
+const claimQuery = `
+	SELECT seq, id, type, payload, created_at, attempts
+	FROM outbox o
+	WHERE published_at IS NULL AND next_attempt_at <= CURRENT_TIMESTAMP
+	  AND NOT EXISTS (
+		SELECT 1 FROM outbox earlier
+		WHERE earlier.event_id = o.event_id AND earlier.published_at IS NULL AND earlier.seq < o.seq)
+	ORDER BY seq
+	LIMIT $1
+	FOR UPDATE SKIP LOCKED`
+
+// RelayOnce claims one batch of messages, sends them to the sinks and
+// records the outcome, returning how many messages were claimed.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	rows, err := r.claim(ctx)
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+
+	// Messages still being sent when the lease runs out may be claimed by
+	// another relay, so sending stops then.
+	sendCtx, cancel := context.WithTimeout(ctx, r.cfg.Lease)
+	defer cancel()
+	var mu sync.Mutex
+	var recordErr error
+	r.sendBatch(sendCtx, rows, func(row row, sendErr error) {
+		if err := r.record(ctx, row, sendErr); err != nil {
+			mu.Lock()
+			recordErr = err
+			mu.Unlock()
+		}
+	})
+	return len(rows), recordErr
+}
+
+// claim leases the next batch of messages to this relay. The lease is
+// committed before the messages are sent, so that no transaction stays open
+// while sinks take their time, and other relays skip the messages until it
+// runs out, by when they have been published or put off for a retry.
+func (r *Relay) claim(ctx context.Context) ([]row, error) {
+	tx, err := database.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var rows []row
+	if err := tx.SelectContext(ctx, &rows, claimQuery, r.cfg.BatchSize); err != nil {
+		return nil, fmt.Errorf("failed to claim outbox messages: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	seqs := make(pq.Int64Array, len(rows))
+	for i, row := range rows {
+		seqs[i] = row.Seq
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE outbox SET next_attempt_at = CURRENT_TIMESTAMP + $2 * INTERVAL '1 millisecond'
+		WHERE seq = ANY($1)`, seqs, r.cfg.Lease.Milliseconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to lease outbox messages: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// sendBatch sends the messages in rows at once, calling done with the
+// outcome of each as soon as it is known, so that a slow sink holds up only
+// the message it is slow with. Order is kept, since a batch holds at most one
+// message about each event.
+func (r *Relay) sendBatch(ctx context.Context, rows []row, done func(row, error)) {
+	var wg sync.WaitGroup
+	for _, row := range rows {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			done(row, r.send(ctx, row))
+		}()
+	}
+	wg.Wait()
+}
+
+// record marks the message in row published, or puts it off for a retry
+// after sendErr.
+func (r *Relay) record(ctx context.Context, row row, sendErr error) error {
+	if sendErr == nil {
+		_, err := database.DB.ExecContext(ctx, `
+			UPDATE outbox SET published_at = CURRENT_TIMESTAMP, attempts = attempts + 1, last_error = NULL
+			WHERE seq = $1`, row.Seq)
+		if err != nil {
+			return fmt.Errorf("failed to mark outbox message published: %w", err)
+		}
+		return nil
+	}
+
+	delay := r.backoff(row.Attempts + 1)
+	r.logger.Warn("Failed to relay outbox message, will retry",
+		"message_id", row.ID, "type", row.Type, "attempts", row.Attempts+1, "retry_in", delay, "error", sendErr)
+	_, err := database.DB.ExecContext(ctx, `
+		UPDATE outbox SET attempts = attempts + 1, last_error = $2,
+		       next_attempt_at = CURRENT_TIMESTAMP + $3 * INTERVAL '1 millisecond'
+		WHERE seq = $1`, row.Seq, sendErr.Error(), delay.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("failed to record outbox failure: %w", err)
+	}
+	return nil
+}
+
+// send sends the message in row to every sink, stopping at the first that
+// fails.
+func (r *Relay) send(ctx context.Context, row row) error {
+	msg, err := row.message()
+	if err != nil {
+		return err
+	}
+	for _, sink := range r.cfg.Sinks {
+		if err := sink.Send(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backoff is the delay after the given number of failed attempts.
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := r.cfg.RetryBackoff
+	for i := 1; i < attempts && delay < r.cfg.RetryBackoffMax; i++ {
+		delay *= 2
+	}
+	return min(delay, r.cfg.RetryBackoffMax)
+}
+
+func (r *Relay) cleanup(ctx context.Context) error {
+	_, err := database.DB.ExecContext(ctx,
+		"DELETE FROM outbox WHERE published_at < CURRENT_TIMESTAMP - $1 * INTERVAL '1 millisecond'", r.cfg.Retention.Milliseconds())
+	return err
+}
@@ -0,0 +1,164 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rsomcio/restapi/config"
+	"github.com/rsomcio/restapi/database"
+	"github.com/rsomcio/restapi/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoff(t *testing.T) {
+	r := New(Config{RetryBackoff: time.Second, RetryBackoffMax: 5 * time.Second})
+	var delays []time.Duration
+	for attempts := 1; attempts <= 5; attempts++ {
+		delays = append(delays, r.backoff(attempts))
+	}
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}, delays)
+}
+
+func TestSendStopsAtFailingSink(t *testing.T) {
+	first, second, third := &MemorySink{}, &MemorySink{}, &MemorySink{}
+	second.Fail(errors.New("unavailable"))
+	r := New(Config{Sinks: []Sink{first, second, third}})
+
+	err := r.send(context.Background(), row{Seq: 1, ID: "m1", Type: models.EventCreated, Payload: []byte(`{"id":"e1","name":"Fair"}`)})
+	assert.EqualError(t, err, "unavailable")
+	require.Len(t, first.Messages(), 1)
+	assert.Equal(t, "Fair", first.Messages()[0].Event.Name)
+	assert.Empty(t, third.Messages(), "later sinks wait until the message is sent again")
+
+	err = r.send(context.Background(), row{Seq: 2, ID: "m2", Payload: []byte(`not json`)})
+	assert.ErrorContains(t, err, "failed to decode outbox message")
+}
+
+// blockingSink holds up messages about the event blocked until release is
+// closed, and accepts the others.
+type blockingSink struct {
+	blocked string
+	release chan struct{}
+}
+
+func (s blockingSink) Send(ctx context.Context, msg Message) error {
+	if msg.Event.ID != s.blocked {
+		return nil
+	}
+	select {
+	case <-s.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestSendBatchIsNotHeldUpBySlowMessages(t *testing.T) {
+	sink := blockingSink{blocked: "slow", release: make(chan struct{})}
+	r := New(Config{Sinks: []Sink{sink}})
+
+	rows := []row{
+		{Seq: 1, ID: "m1", Payload: []byte(`{"id":"slow"}`)},
+		{Seq: 2, ID: "m2", Payload: []byte(`{"id":"e2"}`)},
+		{Seq: 3, ID: "m3", Payload: []byte(`{"id":"e3"}`)},
+	}
+	done := make(chan int64, len(rows))
+	go r.sendBatch(context.Background(), rows, func(row row, err error) {
+		assert.NoError(t, err)
+		done <- row.Seq
+	})
+
+	var sent []int64
+	for i := 0; i < 2; i++ {
+		select {
+		case seq := <-done:
+			sent = append(sent, seq)
+		case <-time.After(5 * time.Second):
+			t.Fatal("messages waited for the slow one")
+		}
+	}
+	assert.ElementsMatch(t, []int64{2, 3}, sent)
+
+	close(sink.release)
+	assert.Equal(t, int64(1), <-done)
+}
+
+func TestSendBatchStopsAtDeadline(t *testing.T) {
+	sink := blockingSink{blocked: "slow", release: make(chan struct{})}
+	r := New(Config{Sinks: []Sink{sink}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	var err error
+	r.sendBatch(ctx, []row{{Seq: 1, ID: "m1", Payload: []byte(`{"id":"slow"}`)}}, func(_ row, sendErr error) {
+		err = sendErr
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "the message is retried once its lease runs out")
+}
+
+func TestRelayIntegration(t *testing.T) {
+	// Skip this test if no DATABASE_URL is set in environment
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("DATABASE_URL not set, skipping integration test")
+	}
+
+	ctx := context.Background()
+	if database.DB == nil {
+		cfg := config.Default().Database
+		cfg.URL = databaseURL
+		require.NoError(t, database.Connect(ctx, cfg))
+	}
+	require.NoError(t, database.CreateTables())
+
+	var event models.Event
+	err := database.DB.GetContext(ctx, &event, `
+		INSERT INTO events (name, venue_name, address, date, time)
+		VALUES ('Outbox Fair', 'Hall', '1 Main St', '2030-01-01', '10:00')
+		RETURNING id, name, description, venue_name, address, date, time, contact_mobile, contact_email, contact_instagram, created_at, updated_at`)
+	require.NoError(t, err)
+	defer database.DB.Exec("DELETE FROM outbox WHERE event_id = $1", event.ID)
+	defer database.DB.Exec("DELETE FROM events WHERE id = $1", event.ID)
+
+	for _, eventType := range []string{models.EventCreated, models.EventUpdated} {
+		tx, err := database.DB.BeginTxx(ctx, nil)
+		require.NoError(t, err)
+		require.NoError(t, Write(ctx, tx, eventType, event))
+		require.NoError(t, tx.Commit())
+	}
+
+	sink := &MemorySink{}
+	r := New(Config{Sinks: []Sink{sink}, RetryBackoff: time.Millisecond})
+	received := func() []string {
+		var types []string
+		for _, msg := range sink.Messages() {
+			if msg.Event.ID == event.ID {
+				types = append(types, msg.Type)
+			}
+		}
+		return types
+	}
+
+	sink.Fail(errors.New("unavailable"))
+	_, err = r.RelayOnce(ctx)
+	require.NoError(t, err)
+	sink.Fail(nil)
+	time.Sleep(10 * time.Millisecond)
+
+	_, err = r.RelayOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{models.EventCreated}, received(), "a later message waits for the earlier one about the same event")
+
+	_, err = r.RelayOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{models.EventCreated, models.EventUpdated}, received())
+
+	var attempts []int
+	require.NoError(t, database.DB.SelectContext(ctx, &attempts,
+		"SELECT attempts FROM outbox WHERE event_id = $1 AND published_at IS NOT NULL ORDER BY seq", event.ID))
+	assert.Equal(t, []int{2, 1}, attempts)
+}
@@ -0,0 +1,53 @@
+package outbox
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// LogSink logs every message.
+type LogSink struct {
+	Logger *slog.Logger
+}
+
+func (s LogSink) Send(ctx context.Context, msg Message) error {
+	logger := s.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.InfoContext(ctx, "Published event change", "message_id", msg.ID, "type", msg.Type, "event_id", msg.Event.ID)
+	return nil
+}
+
+// MemorySink keeps the messages sent to it, for tests.
+type MemorySink struct {
+	mu       sync.Mutex
+	messages []Message
+	fail     error
+}
+
+// Messages returns the messages sent so far, oldest first.
+func (s *MemorySink) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Fail makes Send return err, without keeping the message, until it is
+// called again with nil.
+func (s *MemorySink) Fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail = err
+}
+
+func (s *MemorySink) Send(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail != nil {
+		return s.fail
+	}
+	s.messages = append(s.messages, msg)
+	return nil
+}
@@ -0,0 +1,104 @@
+// Package ratelimit throttles clients with token buckets, keeping separate
+// budgets for reads and writes.
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rsomcio/restapi/apierror"
+	"github.com/rsomcio/restapi/logging"
+)
+
+// Limit describes a token bucket: it holds at most Burst tokens and refills
+// at Rate tokens per second. Every request takes one token.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute returns a Limit allowing n requests per minute on average with
+// bursts of up to burst requests.
+func PerMinute(n, burst int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: burst}
+}
+
+// refillTime returns how long the bucket takes to gain tokens.
+func (l Limit) refillTime(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / l.Rate * float64(time.Second))
+}
+
+// Result is the state of a bucket after a Take.
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until a token is available, when not Allowed.
+	RetryAfter time.Duration
+}
+
+// Store holds the buckets. Implementations backed by a shared server let
+// several instances enforce one limit; Take must be atomic per key.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// Config configures Middleware.
+type Config struct {
+	Store Store
+	// Read applies to GET, HEAD and OPTIONS requests, Write to all others.
+	Read  Limit
+	Write Limit
+	// Key identifies the client a request counts against.
+	Key func(c *fiber.Ctx) string
+	// Logger reports store failures, during which requests are let through.
+	Logger *slog.Logger
+}
+
+// Middleware rejects requests over the client's budget with 429 and sets the
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers on every
+// response.
+func Middleware(cfg Config) fiber.Handler {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return func(c *fiber.Ctx) error {
+		kind, limit := "write", cfg.Write
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+			kind, limit = "read", cfg.Read
+		}
+
+		result, err := cfg.Store.Take(c.UserContext(), kind+":"+cfg.Key(c), limit)
+		if err != nil {
+			logging.Ctx(c, logger).Warn("Rate limit store unavailable, allowing request", "error", err)
+			return c.Next()
+		}
+
+		c.Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		c.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Set("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+		c.Set("RateLimit-Policy", strconv.Itoa(limit.Burst)+";w="+strconv.Itoa(seconds(limit.refillTime(float64(limit.Burst)))))
+
+		if !result.Allowed {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds(result.RetryAfter)))
+			return apierror.TooManyRequests("Rate limit exceeded")
+		}
+		return c.Next()
+	}
+}
+
+// seconds rounds d up to whole seconds, as the headers require.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rsomcio/restapi/apierror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryTokenBucket(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+	limit := Limit{Rate: 1, Burst: 3}
+
+	for i := 2; i >= 0; i-- {
+		result, err := m.Take(ctx, "k", limit)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, i, result.Remaining)
+	}
+
+	result, err := m.Take(ctx, "k", limit)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+	assert.Equal(t, 3*time.Second, result.Reset)
+
+	// Other keys have their own bucket.
+	result, _ = m.Take(ctx, "other", limit)
+	assert.True(t, result.Allowed)
+
+	now = now.Add(1500 * time.Millisecond)
+	result, _ = m.Take(ctx, "k", limit)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	result, _ = m.Take(ctx, "k", limit)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+}
+
+func TestMemorySweepsRefilledBuckets(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+
+	_, _ = m.Take(ctx, "idle", Limit{Rate: 10, Burst: 5})
+	_, _ = m.Take(ctx, "busy", Limit{Rate: 0.001, Burst: 5})
+	assert.Equal(t, 2, m.Len())
+
+	now = now.Add(sweepInterval)
+	_, _ = m.Take(ctx, "new", Limit{Rate: 1, Burst: 1})
+	assert.Equal(t, 2, m.Len(), "the refilled bucket is dropped")
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, Limit) (Result, error) {
+	return Result{}, errors.New("store down")
+}
+
+func newTestApp(store Store) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.Handler(apierror.Options{})})
+	app.Use(Middleware(Config{
+		Store: store,
+		Read:  Limit{Rate: 1, Burst: 2},
+		Write: Limit{Rate: 1, Burst: 1},
+		Key:   func(c *fiber.Ctx) string { return c.Get("X-API-Key") },
+	}))
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	app.Post("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	return app
+}
+
+func do(t *testing.T, app *fiber.App, method, key string) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(method, "/", nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestMiddleware(t *testing.T) {
+	app := newTestApp(NewMemory())
+
+	resp := do(t, app, "GET", "a")
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get("RateLimit-Limit"))
+	assert.Equal(t, "1", resp.Header.Get("RateLimit-Remaining"))
+	assert.Equal(t, "1", resp.Header.Get("RateLimit-Reset"))
+	assert.Equal(t, "2;w=2", resp.Header.Get("RateLimit-Policy"))
+
+	assert.Equal(t, 200, do(t, app, "GET", "a").StatusCode)
+	resp = do(t, app, "GET", "a")
+	assert.Equal(t, 429, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("Retry-After"))
+	assert.Equal(t, "0", resp.Header.Get("RateLimit-Remaining"))
+	assert.Equal(t, apierror.ProblemContentType, resp.Header.Get("Content-Type"))
+
+	// Writes have their own budget, and so do other clients.
+	assert.Equal(t, 200, do(t, app, "POST", "a").StatusCode)
+	assert.Equal(t, 429, do(t, app, "POST", "a").StatusCode)
+	assert.Equal(t, 200, do(t, app, "GET", "b").StatusCode)
+}
+
+func TestMiddlewareFailsOpen(t *testing.T) {
+	app := newTestApp(failingStore{})
+
+	for i := 0; i < 5; i++ {
+		resp := do(t, app, "POST", "a")
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("RateLimit-Limit"))
+	}
+}
@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// Stores accepted by the rate_limit.store setting.
+const (
+	StoreMemory = "memory"
+	StoreRedis  = "redis"
+)
+
+// Counters is what Redis needs of the server: Add and Incr as cache.Redis
+// implements them, where Incr keeps the expiry that Add set.
+type Counters interface {
+	Add(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	Incr(ctx context.Context, key string) (int64, error)
+}
+
+// Redis is a Store on a Redis-compatible server, so that every instance
+// using the server enforces one limit. Rather than a bucket it counts
+// requests in fixed windows of the time a bucket takes to refill, allowing
+// Burst requests in each: the same rate on average, with up to twice the
+// burst across the end of a window.
+type Redis struct {
+	counters Counters
+	prefix   string
+	now      func() time.Time
+}
+
+// NewRedis returns a Store keeping its counts in counters, under keys
+// starting with prefix.
+func NewRedis(counters Counters, prefix string) *Redis {
+	return &Redis{counters: counters, prefix: prefix, now: time.Now}
+}
+
+func (r *Redis) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	window := max(limit.refillTime(float64(limit.Burst)), time.Millisecond)
+	now := r.now()
+	n := now.UnixNano() / int64(window)
+	reset := time.Unix(0, (n+1)*int64(window)).Sub(now)
+
+	// The window's number is in the key, so a count is never read after
+	// its window; it expires a little later so clocks may differ.
+	key = r.prefix + key + ":" + strconv.FormatInt(n, 10)
+	if _, err := r.counters.Add(ctx, key, []byte("0"), reset+time.Second); err != nil {
+		return Result{}, err
+	}
+	count, err := r.counters.Incr(ctx, key)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{
+		Allowed:   count <= int64(limit.Burst),
+		Remaining: max(limit.Burst-int(count), 0),
+		Reset:     reset,
+	}
+	if !result.Allowed {
+		result.RetryAfter = reset
+	}
+	return result, nil
+}
@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rsomcio/restapi/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ Counters = (*cache.Redis)(nil)
+
+// memoryCounters behaves as Redis does for SET NX PX and INCR.
+type memoryCounters struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	values  map[string]int64
+	expires map[string]time.Time
+}
+
+func newMemoryCounters(now func() time.Time) *memoryCounters {
+	return &memoryCounters{now: now, values: map[string]int64{}, expires: map[string]time.Time{}}
+}
+
+func (m *memoryCounters) Add(_ context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.values[key]; ok && m.now().Before(m.expires[key]) {
+		return false, nil
+	}
+	n, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return false, err
+	}
+	m.values[key], m.expires[key] = n, m.now().Add(ttl)
+	return true, nil
+}
+
+func (m *memoryCounters) Incr(_ context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[key]++
+	return m.values[key], nil
+}
+
+func TestRedisSharesWindows(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000002, 0) // a second into a 3s window
+	clock := func() time.Time { return now }
+	counters := newMemoryCounters(clock)
+	// Two instances on one server count against one limit.
+	a, b := NewRedis(counters, "rl:"), NewRedis(counters, "rl:")
+	a.now, b.now = clock, clock
+	limit := Limit{Rate: 1, Burst: 3}
+
+	for i, store := range []*Redis{a, b, a} {
+		result, err := store.Take(ctx, "k", limit)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 2-i, result.Remaining)
+	}
+
+	result, err := b.Take(ctx, "k", limit)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 2*time.Second, result.RetryAfter, "the 3s window started a second ago")
+	assert.Equal(t, 2*time.Second, result.Reset)
+
+	result, _ = a.Take(ctx, "other", limit)
+	assert.True(t, result.Allowed, "other keys have their own count")
+
+	now = now.Add(2 * time.Second)
+	result, _ = b.Take(ctx, "k", limit)
+	assert.True(t, result.Allowed, "a new window starts afresh")
+	assert.Equal(t, 2, result.Remaining)
+	assert.Equal(t, 3*time.Second, result.Reset)
+}
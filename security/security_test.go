@@ -0,0 +1,58 @@
+package security
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaders(t *testing.T) {
+	app := fiber.New()
+	app.Use(Headers(Config{
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+		ContentSecurityPolicy: "default-src 'self'",
+	}))
+	app.Get("/json", func(c *fiber.Ctx) error { return c.JSON(fiber.Map{"ok": true}) })
+	app.Get("/html", func(c *fiber.Ctx) error {
+		c.Type("html")
+		return c.SendString("<html></html>")
+	})
+
+	app.Get("/own-policy", func(c *fiber.Ctx) error {
+		c.Set("Content-Security-Policy", "default-src 'none'")
+		c.Type("html")
+		return c.SendString("<html></html>")
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/json", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+	assert.Equal(t, "DENY", resp.Header.Get("X-Frame-Options"))
+	assert.Equal(t, "no-referrer", resp.Header.Get("Referrer-Policy"))
+	assert.Equal(t, "max-age=31536000; includeSubDomains", resp.Header.Get("Strict-Transport-Security"))
+	assert.Empty(t, resp.Header.Get("Content-Security-Policy"))
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/html", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "default-src 'self'", resp.Header.Get("Content-Security-Policy"))
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/own-policy", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "default-src 'none'", resp.Header.Get("Content-Security-Policy"))
+}
+
+func TestHeadersWithoutHSTS(t *testing.T) {
+	app := fiber.New()
+	app.Use(Headers(Config{}))
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	require.NoError(t, err)
+	assert.Empty(t, resp.Header.Get("Strict-Transport-Security"))
+	assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rsomcio/restapi/config"
+	"github.com/rsomcio/restapi/handlers"
+	"github.com/rsomcio/restapi/health"
+	"github.com/rsomcio/restapi/metrics"
+	"github.com/rsomcio/restapi/models"
+	"github.com/rsomcio/restapi/openapi"
+)
+
+// apiVersion is the version of the API described by the OpenAPI document.
+const apiVersion = "1.0.0"
+
+// route is an entry of the route table, from which New registers the
+// handlers and document generates the OpenAPI description. chain runs in
+// order, the last entry being the handler.
+type route struct {
+	openapi.Operation
+	chain []fiber.Handler
+}
+
+var eventIDParam = openapi.Parameter{
+	Name:        "id",
+	In:          "path",
+	Description: "Event ID",
+	Schema:      openapi.Schema{"type": "string", "format": "uuid"},
+}
+
+var idempotencyKeyParam = openapi.Parameter{
+	Name:        handlers.IdempotencyKeyHeader,
+	In:          "header",
+	Description: "Key that makes retries of this write replay its first successful response",
+	Schema:      openapi.Schema{"type": "string", "minLength": 1, "maxLength": 255},
+}
+
+var webhookIDParam = openapi.Parameter{
+	Name:        "id",
+	In:          "path",
+	Description: "Webhook ID",
+	Schema:      openapi.Schema{"type": "string", "format": "uuid"},
+}
+
+// streamParams filter and resume a stream of changes to events.
+var streamParams = []openapi.Parameter{
+	{
+		Name:        "venue",
+		In:          "query",
+		Description: "Only changes to events at this venue, ignoring case",
+		Schema:      openapi.Schema{"type": "string", "maxLength": 255},
+	},
+	{
+		Name:        "from",
+		In:          "query",
+		Description: "Only changes to events on or after this date (YYYY-MM-DD)",
+		Schema:      openapi.Schema{"type": "string", "format": "date"},
+	},
+	{
+		Name:        "to",
+		In:          "query",
+		Description: "Only changes to events on or before this date (YYYY-MM-DD)",
+		Schema:      openapi.Schema{"type": "string", "format": "date"},
+	},
+	{
+		Name:        fiber.HeaderLastEventID,
+		In:          "header",
+		Description: "ID of the last change received, to resume a stream after it",
+		Schema:      openapi.Schema{"type": "string"},
+	},
+}
+
+// pageParams are the query parameters of a list of things.
+func pageParams(things string) []openapi.Parameter {
+	return []openapi.Parameter{
+		{
+			Name:        "limit",
+			In:          "query",
+			Description: "Maximum number of " + things + " to return; all of them when absent",
+			Schema:      openapi.Schema{"type": "integer", "minimum": 1, "maximum": handlers.MaxPageSize},
+		},
+		{
+			Name:        "offset",
+			In:          "query",
+			Description: "Number of " + things + " to skip",
+			Schema:      openapi.Schema{"type": "integer", "minimum": 0},
+		},
+	}
+}
+
+func routes(cfg *config.Config) []route {
+	timeout := func(method, path string) fiber.Handler {
+		return handlers.QueryTimeout(cfg.Database.TimeoutFor(method, path))
+	}
+	api := func(tag string, authenticated bool) func(method, path string, handler fiber.Handler, op openapi.Operation) route {
+		return func(method, path string, handler fiber.Handler, op openapi.Operation) route {
+			op.Method, op.Path, op.Tags = method, path, []string{tag}
+			if authenticated {
+				op.Errors = append(op.Errors, 401)
+			}
+			// Writes taking an Idempotency-Key may meet a retry still
+			// running, or a key reused for another body.
+			if slices.ContainsFunc(op.Params, func(p openapi.Parameter) bool { return p.Name == idempotencyKeyParam.Name }) {
+				for _, status := range []int{409, 422} {
+					if !slices.Contains(op.Errors, status) {
+						op.Errors = append(op.Errors, status)
+					}
+				}
+			}
+			return route{Operation: op, chain: []fiber.Handler{timeout(method, path), handler}}
+		}
+	}
+	// Webhooks always need a key; see New.
+	event, webhook := api("events", cfg.Security.RequireAPIKey), api("webhooks", true)
+
+	var table []route
+	if cfg.Features.Metrics {
+		table = append(table, route{
+			Operation: openapi.Operation{
+				Method: "GET", Path: "/metrics", ID: "getMetrics", Summary: "Prometheus metrics", Tags: []string{"operations"},
+				Responses: []openapi.Response{{Status: 200, ContentType: "text/plain; version=0.0.4", Body: ""}},
+			},
+			chain: []fiber.Handler{metrics.Handler()},
+		})
+	}
+
+	return append(table,
+		route{
+			Operation: openapi.Operation{
+				Method: "GET", Path: "/healthz", ID: "getLiveness", Summary: "Liveness probe", Tags: []string{"operations"},
+				Responses: []openapi.Response{{Status: 200, Body: map[string]string{}}},
+			},
+			chain: []fiber.Handler{health.Liveness},
+		},
+		route{
+			Operation: openapi.Operation{
+				Method: "GET", Path: "/readyz", ID: "getReadiness", Summary: "Readiness probe with a check per dependency", Tags: []string{"operations"},
+				Responses: []openapi.Response{
+					{Status: 200, Body: health.Report{}},
+					{Status: 503, Description: "Not ready", Body: health.Report{}},
+				},
+			},
+			chain: []fiber.Handler{health.Readiness},
+		},
+
+		event("POST", "/api/events", handlers.CreateEvent, openapi.Operation{
+			ID: "createEvent", Summary: "Create an event",
+			Params:    []openapi.Parameter{idempotencyKeyParam},
+			Request:   models.CreateEventRequest{},
+			Responses: []openapi.Response{{Status: 201, Body: models.Event{}}},
+			Errors:    []int{400, 409, 413, 429, 500, 503, 504},
+		}),
+		event("GET", "/api/events", handlers.GetAllEvents, openapi.Operation{
+			ID: "listEvents", Summary: "List events ordered by date and time",
+			Params:    pageParams("events"),
+			Responses: []openapi.Response{{Status: 200, Body: []models.Event{}}},
+			Errors:    []int{400, 429, 500, 503, 504},
+		}),
+		// Registered before /api/events/:id, which would match them too.
+		event("GET", "/api/events/stream", handlers.StreamEvents(cfg.Stream.Heartbeat, cfg.Stream.Buffer), openapi.Operation{
+			ID: "streamEvents", Summary: "Stream changes to events as server-sent events",
+			Params:    streamParams,
+			Responses: []openapi.Response{{Status: 200, ContentType: "text/event-stream", Body: ""}},
+			Errors:    []int{400, 429, 500, 503},
+		}),
+		event("GET", "/api/events/ws", handlers.EventsWebSocket(cfg.CORS.AllowOrigins, cfg.Stream.Heartbeat, cfg.Stream.Buffer), openapi.Operation{
+			ID: "subscribeEvents", Summary: "Subscribe to changes to events over a WebSocket",
+			Params: []openapi.Parameter{{
+				Name:        fiber.HeaderSecWebSocketProtocol,
+				In:          "header",
+				Description: "Subprotocols offered: " + handlers.WebSocketProtocol + ", and from browsers " + handlers.APIKeyProtocolPrefix + " followed by the API key",
+				Schema:      openapi.Schema{"type": "string"},
+			}},
+			Responses: []openapi.Response{{Status: 101, Description: "Switching to the WebSocket protocol"}},
+			Errors:    []int{403, 426, 429, 500, 503},
+		}),
+		event("GET", "/api/events/:id", handlers.GetEventByID, openapi.Operation{
+			ID: "getEvent", Summary: "Get an event",
+			Params:    []openapi.Parameter{eventIDParam},
+			Responses: []openapi.Response{{Status: 200, Body: models.Event{}}},
+			Errors:    []int{400, 404, 429, 500, 503, 504},
+		}),
+		event("PUT", "/api/events/:id", handlers.UpdateEvent, openapi.Operation{
+			ID: "updateEvent", Summary: "Replace an event",
+			Params:    []openapi.Parameter{eventIDParam, idempotencyKeyParam},
+			Request:   models.UpdateEventRequest{},
+			Responses: []openapi.Response{{Status: 200, Body: models.Event{}}},
+			Errors:    []int{400, 404, 409, 413, 429, 500, 503, 504},
+		}),
+		event("DELETE", "/api/events/:id", handlers.DeleteEvent, openapi.Operation{
+			ID: "deleteEvent", Summary: "Delete an event",
+			Params:    []openapi.Parameter{eventIDParam, idempotencyKeyParam},
+			Responses: []openapi.Response{{Status: 204}},
+			Errors:    []int{400, 404, 429, 500, 503, 504},
+		}),
+
+		webhook("POST", "/api/webhooks", handlers.CreateWebhook, openapi.Operation{
+			ID: "createWebhook", Summary: "Register a webhook; the response holds its signing secret",
+			Params:    []openapi.Parameter{idempotencyKeyParam},
+			Request:   models.CreateWebhookRequest{},
+			Responses: []openapi.Response{{Status: 201, Body: models.Webhook{}}},
+			Errors:    []int{400, 413, 429, 500, 503, 504},
+		}),
+		webhook("GET", "/api/webhooks", handlers.GetAllWebhooks, openapi.Operation{
+			ID: "listWebhooks", Summary: "List webhooks",
+			Params:    pageParams("webhooks"),
+			Responses: []openapi.Response{{Status: 200, Body: []models.Webhook{}}},
+			Errors:    []int{400, 429, 500, 503, 504},
+		}),
+		webhook("GET", "/api/webhooks/:id", handlers.GetWebhookByID, openapi.Operation{
+			ID: "getWebhook", Summary: "Get a webhook",
+			Params:    []openapi.Parameter{webhookIDParam},
+			Responses: []openapi.Response{{Status: 200, Body: models.Webhook{}}},
+			Errors:    []int{400, 404, 429, 500, 503, 504},
+		}),
+		webhook("PUT", "/api/webhooks/:id", handlers.UpdateWebhook, openapi.Operation{
+			ID: "updateWebhook", Summary: "Replace a webhook, re-enabling it if enabled is true",
+			Params:    []openapi.Parameter{webhookIDParam, idempotencyKeyParam},
+			Request:   models.UpdateWebhookRequest{},
+			Responses: []openapi.Response{{Status: 200, Body: models.Webhook{}}},
+			Errors:    []int{400, 404, 413, 429, 500, 503, 504},
+		}),
+		webhook("DELETE", "/api/webhooks/:id", handlers.DeleteWebhook, openapi.Operation{
+			ID: "deleteWebhook", Summary: "Delete a webhook",
+			Params:    []openapi.Parameter{webhookIDParam, idempotencyKeyParam},
+			Responses: []openapi.Response{{Status: 204}},
+			Errors:    []int{400, 404, 429, 500, 503, 504},
+		}),
+		webhook("GET", "/api/webhooks/:id/deliveries", handlers.GetWebhookDeliveries, openapi.Operation{
+			ID: "listWebhookDeliveries", Summary: "List delivery attempts of a webhook, newest first",
+			Params:    append([]openapi.Parameter{webhookIDParam}, pageParams("attempts")...),
+			Responses: []openapi.Response{{Status: 200, Body: []models.WebhookDelivery{}}},
+			Errors:    []int{400, 404, 429, 500, 503, 504},
+		}),
+	)
+}
+
+// document describes the routes of cfg as an OpenAPI document.
+func document(cfg *config.Config) *openapi.Document {
+	table := routes(cfg)
+	ops := make([]openapi.Operation, len(table))
+	for i, r := range table {
+		ops[i] = r.Operation
+	}
+	return openapi.Generate("Events API", apiVersion, ops)
+}
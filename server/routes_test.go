@@ -0,0 +1,148 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/rsomcio/restapi/apierror"
+	"github.com/rsomcio/restapi/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "rewrite openapi.json from the route table")
+
+const goldenDocument = "openapi.json"
+
+// TestOpenAPIDocument fails when routes or models change without the
+// committed openapi.json following. Run `go test ./server -run OpenAPI -update` to
+// regenerate it, then review the diff.
+func TestOpenAPIDocument(t *testing.T) {
+	got, err := json.MarshalIndent(document(config.Default()), "", "  ")
+	require.NoError(t, err)
+	got = append(got, '\n')
+
+	if *update {
+		require.NoError(t, os.WriteFile(goldenDocument, got, 0o644))
+	}
+
+	want, err := os.ReadFile(goldenDocument)
+	require.NoError(t, err)
+	if !bytes.Equal(want, got) {
+		t.Fatalf("%s is out of date; run `go test ./server -run OpenAPI -update` and review the diff", goldenDocument)
+	}
+}
+
+func TestEveryRouteIsDocumented(t *testing.T) {
+	app := newTestApp(t, func(cfg *config.Config) {
+		cfg.Features.Metrics = true
+	})
+
+	var registered []string
+	for _, r := range app.GetRoutes(true) {
+		if r.Method == "HEAD" || r.Path == "/openapi.json" || r.Path == "/docs" {
+			continue
+		}
+		registered = append(registered, r.Method+" "+r.Path)
+	}
+
+	var documented []string
+	for _, r := range routes(config.Default()) {
+		documented = append(documented, r.Method+" "+r.Path)
+	}
+
+	sort.Strings(registered)
+	sort.Strings(documented)
+	assert.Equal(t, documented, registered)
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	app := newTestApp(t, nil)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/openapi.json", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	var doc map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&doc))
+	assert.Equal(t, "3.1.0", doc["openapi"])
+	assert.Contains(t, doc["paths"], "/api/events/{id}")
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/docs", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode, "the docs page needs the script's hash")
+}
+
+func TestServeDocs(t *testing.T) {
+	const integrity = "sha384-oqVuAfXRKap7fdgcCY5uykM6+R9GqQ8K/uxy9rx7HNQlGYl1kPzQho1wx4JwY8wC"
+	app := newTestApp(t, func(cfg *config.Config) {
+		cfg.Server.DocsScriptIntegrity = integrity
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/docs", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Contains(t, resp.Header.Get("Content-Security-Policy"), "script-src 'self' https://cdn.jsdelivr.net/npm/redoc@2.1.5/bundles/redoc.standalone.js;")
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), `spec-url="/openapi.json"`)
+	assert.Contains(t, string(body), `integrity="`+integrity+`" crossorigin="anonymous"`)
+}
+
+func TestRequestsValidatedAgainstDocument(t *testing.T) {
+	app := newTestApp(t, nil)
+
+	tests := []struct {
+		method, target, body string
+		fields               []apierror.FieldError
+	}{
+		{
+			method: "POST", target: "/api/events",
+			body: `{"name": "Fair", "date": "2024/03/15", "time": "14:30", "contact_email": "nope"}`,
+			fields: []apierror.FieldError{
+				{Field: "venue_name", Code: "required", Message: "venue_name is required"},
+				{Field: "address", Code: "required", Message: "address is required"},
+				{Field: "date", Code: "dateformat", Message: "Invalid date format. Use YYYY-MM-DD format"},
+				{Field: "time", Code: "timeformat", Message: "Invalid time format. Use HH:MM:SS format"},
+				{Field: "contact_email", Code: "emailformat", Message: "Invalid email format"},
+			},
+		},
+		{
+			method: "GET", target: "/api/events/abc",
+			fields: []apierror.FieldError{{Field: "id", Code: "uuid", Message: "id must be a valid UUID"}},
+		},
+		{
+			method: "PUT", target: "/api/events/123e4567-e89b-12d3-a456-426614174000",
+			body: `{"name": 1}`,
+			fields: []apierror.FieldError{
+				{Field: "name", Code: "type", Message: "name must be a string"},
+				{Field: "venue_name", Code: "required", Message: "venue_name is required"},
+				{Field: "address", Code: "required", Message: "address is required"},
+				{Field: "date", Code: "required", Message: "date is required"},
+				{Field: "time", Code: "required", Message: "time is required"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+
+			assert.Equal(t, 400, resp.StatusCode)
+			var problem apierror.Problem
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&problem))
+			assert.Equal(t, tt.fields, problem.Fields)
+		})
+	}
+}
@@ -0,0 +1,136 @@
+// Package server assembles the HTTP application from the route table, so that
+// the binary and tests of other packages serve the same API.
+package server
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/rsomcio/restapi/apierror"
+	"github.com/rsomcio/restapi/apikey"
+	"github.com/rsomcio/restapi/cache"
+	"github.com/rsomcio/restapi/config"
+	"github.com/rsomcio/restapi/handlers"
+	"github.com/rsomcio/restapi/logging"
+	"github.com/rsomcio/restapi/metrics"
+	"github.com/rsomcio/restapi/openapi"
+	"github.com/rsomcio/restapi/ratelimit"
+	"github.com/rsomcio/restapi/security"
+	"github.com/rsomcio/restapi/tracing"
+)
+
+// apiKeyCacheTTL is how long a checked API key is trusted before it is looked
+// up again, and so how long a revoked key keeps working.
+const apiKeyCacheTTL = 30 * time.Second
+
+// New builds the HTTP application: middleware in the order requests pass
+// through it, then the routes. Dependencies such as the database and the
+// cache are set up by the caller.
+func New(cfg *config.Config, logger *slog.Logger) *fiber.App {
+	app := fiber.New(fiber.Config{
+		BodyLimit:    cfg.Server.BodyLimit,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+		ErrorHandler: apierror.Handler(apierror.Options{
+			Legacy: cfg.Server.ErrorFormat == "legacy",
+			Logger: logger,
+		}),
+	})
+
+	app.Use(requestid.New())
+	if cfg.Features.Tracing {
+		app.Use(tracing.Middleware())
+	}
+	app.Use(logging.Middleware(logger))
+	if cfg.Features.Metrics {
+		app.Use(metrics.Middleware())
+	}
+	app.Use(recover.New())
+	app.Use(security.Headers(security.Config{
+		HSTSMaxAge:            cfg.Security.HSTSMaxAge,
+		HSTSIncludeSubdomains: cfg.Security.HSTSIncludeSubdomains,
+		ContentSecurityPolicy: cfg.Security.ContentSecurityPolicy,
+	}))
+	// Without allowed origins no CORS headers are sent, so browsers refuse
+	// every cross-origin request; the middleware would otherwise default to
+	// allowing all.
+	if len(cfg.CORS.AllowOrigins) > 0 {
+		app.Use(cors.New(cors.Config{
+			AllowOrigins:     strings.Join(cfg.CORS.AllowOrigins, ","),
+			AllowMethods:     strings.Join(cfg.CORS.AllowMethods, ","),
+			AllowHeaders:     strings.Join(cfg.CORS.AllowHeaders, ","),
+			ExposeHeaders:    strings.Join(cfg.CORS.ExposeHeaders, ","),
+			AllowCredentials: cfg.CORS.AllowCredentials,
+			MaxAge:           int(cfg.CORS.MaxAge.Seconds()),
+		}))
+	}
+
+	// Webhooks have the server send requests on the caller's behalf, so
+	// they need a key even when the rest of the API does not.
+	authenticated := "/api/webhooks"
+	if cfg.Security.RequireAPIKey {
+		authenticated = "/api"
+	}
+	// Requests are counted by IP before their keys are checked, so that
+	// guessing keys is throttled too.
+	if cfg.RateLimit.Enabled {
+		perIP := ratelimit.PerMinute(cfg.RateLimit.IPPerMinute, cfg.RateLimit.IPBurst)
+		app.Use(authenticated, ratelimit.Middleware(ratelimit.Config{
+			Store:  rateLimitStore(cfg, "ip"),
+			Read:   perIP,
+			Write:  perIP,
+			Key:    handlers.ClientIPKey,
+			Logger: logger,
+		}))
+	}
+	app.Use(authenticated, apikey.Middleware(apikey.Config{CacheTTL: apiKeyCacheTTL, Logger: logger}))
+	if cfg.RateLimit.Enabled {
+		app.Use("/api", ratelimit.Middleware(ratelimit.Config{
+			Store:  rateLimitStore(cfg, "client"),
+			Read:   ratelimit.PerMinute(cfg.RateLimit.ReadPerMinute, cfg.RateLimit.ReadBurst),
+			Write:  ratelimit.PerMinute(cfg.RateLimit.WritePerMinute, cfg.RateLimit.WriteBurst),
+			Key:    handlers.ClientKey,
+			Logger: logger,
+		}))
+	}
+	app.Use("/api", handlers.Idempotent(cfg.Server.IdempotencyTTL))
+
+	doc := document(cfg)
+	validate := openapi.ValidateOptions{Responses: cfg.Server.ValidateResponses}
+	for _, r := range routes(cfg) {
+		chain := append([]fiber.Handler{doc.Validator(r.Method, r.Path, validate)}, r.chain...)
+		if r.Method == fiber.MethodGet {
+			app.Get(r.Path, chain...) // also answers HEAD
+		} else {
+			app.Add(r.Method, r.Path, chain...)
+		}
+	}
+	app.Get("/openapi.json", openapi.Handler(doc))
+	// The page runs a third-party script, so it is only served once the
+	// script's hash is pinned.
+	if cfg.Server.DocsScriptIntegrity != "" {
+		app.Get("/docs", openapi.DocsHandler("/openapi.json", openapi.DocsScript{
+			URL:       cfg.Server.DocsScriptURL,
+			Integrity: cfg.Server.DocsScriptIntegrity,
+		}))
+	}
+
+	return app
+}
+
+// rateLimitStore returns the store of the limiter called name, as chosen by
+// rate_limit.store. Limiters keep apart in a shared store, since both key
+// clients by IP.
+func rateLimitStore(cfg *config.Config, name string) ratelimit.Store {
+	if cfg.RateLimit.Store == ratelimit.StoreRedis {
+		redis := cache.NewRedis(cfg.Cache.RedisAddr, cfg.Cache.RedisPassword, cfg.Cache.RedisDB, cfg.Cache.RedisTimeout)
+		return ratelimit.NewRedis(redis, "ratelimit:"+name+":")
+	}
+	return ratelimit.NewMemory()
+}
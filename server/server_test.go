@@ -0,0 +1,138 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rsomcio/restapi/apierror"
+	"github.com/rsomcio/restapi/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestApp(t *testing.T, configure func(cfg *config.Config)) *fiber.App {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Features.Tracing = false
+	cfg.Features.Metrics = false
+	cfg.Server.ValidateResponses = true
+	if configure != nil {
+		configure(cfg)
+	}
+	return New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestBodyLimit(t *testing.T) {
+	app := newTestApp(t, func(cfg *config.Config) {
+		cfg.Server.BodyLimit = 64
+	})
+
+	// app.Test reports the oversized body as its own error, so go through
+	// a real listener to see the response a client gets.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go app.Listener(ln)
+	defer app.Shutdown()
+
+	body := strings.NewReader(`{"name":"` + strings.Repeat("x", 100) + `"}`)
+	resp, err := http.Post("http://"+ln.Addr().String()+"/api/events", "application/json", body)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, 413, resp.StatusCode)
+	assert.Equal(t, apierror.ProblemContentType, resp.Header.Get("Content-Type"))
+	var problem apierror.Problem
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&problem))
+	assert.Equal(t, apierror.TypeBaseURI+"payload-too-large", problem.Type)
+}
+
+func TestCORSAndSecurityHeaders(t *testing.T) {
+	app := newTestApp(t, func(cfg *config.Config) {
+		cfg.CORS.AllowOrigins = []string{"https://app.example.com"}
+		cfg.CORS.AllowCredentials = true
+	})
+
+	req := httptest.NewRequest("OPTIONS", "/api/events", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, 204, resp.StatusCode)
+	assert.Equal(t, "https://app.example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", resp.Header.Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "GET,HEAD,POST,PUT,DELETE", resp.Header.Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Content-Type,X-API-Key,X-Request-ID,Idempotency-Key", resp.Header.Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", resp.Header.Get("Access-Control-Max-Age"))
+
+	req = httptest.NewRequest("GET", "/healthz", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	assert.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+	assert.Equal(t, "max-age=15552000", resp.Header.Get("Strict-Transport-Security"))
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	app := newTestApp(t, func(cfg *config.Config) {
+		cfg.Security.RequireAPIKey = true
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/events", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 401, resp.StatusCode)
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/healthz", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode, "only /api needs a key")
+}
+
+func TestWebhooksRequireAPIKey(t *testing.T) {
+	app := newTestApp(t, nil)
+
+	for _, path := range []string{"/api/webhooks", "/api/webhooks/3f9a61c2-17d4-4a55-9b1e-2f0c8d6a7b10/deliveries"} {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		require.NoError(t, err)
+		assert.Equal(t, 401, resp.StatusCode, "%s needs a key even when the rest of the API does not", path)
+	}
+}
+
+func TestRateLimitBeforeAPIKey(t *testing.T) {
+	app := newTestApp(t, func(cfg *config.Config) {
+		cfg.Security.RequireAPIKey = true
+		cfg.RateLimit.IPBurst = 2
+	})
+
+	var statuses []int
+	for i := 0; i < 3; i++ {
+		resp, err := app.Test(httptest.NewRequest("GET", "/api/events", nil))
+		require.NoError(t, err)
+		statuses = append(statuses, resp.StatusCode)
+	}
+	assert.Equal(t, []int{401, 401, 429}, statuses, "failed attempts count against the client's IP")
+}
+
+func TestEventStreamRoute(t *testing.T) {
+	app := newTestApp(t, nil)
+
+	// Without a change bus the streams are refused, rather than "stream"
+	// or "ws" being taken for an event ID.
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/events/stream", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 503, resp.StatusCode)
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/api/events/stream?to=soon", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/api/events/ws", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 503, resp.StatusCode)
+}
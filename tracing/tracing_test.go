@@ -0,0 +1,92 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// setupInMemory installs a tracer provider that records finished spans
+// synchronously into the returned exporter.
+func setupInMemory() *tracetest.InMemoryExporter {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	exp := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp)))
+	return exp
+}
+
+func setupTestApp() *fiber.App {
+	app := fiber.New()
+	app.Use(Middleware())
+	app.Get("/api/events/:id", func(c *fiber.Ctx) error {
+		_, span := Tracer().Start(c.UserContext(), "child")
+		span.End()
+		return c.SendString("ok")
+	})
+	app.Get("/fail", func(c *fiber.Ctx) error {
+		return errors.New("boom")
+	})
+	return app
+}
+
+func TestMiddlewareContinuesRemoteTrace(t *testing.T) {
+	exp := setupInMemory()
+	app := setupTestApp()
+
+	req := httptest.NewRequest("GET", "/api/events/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	spans := exp.GetSpans()
+	require.Len(t, spans, 2)
+
+	child, server := spans[0], spans[1]
+	assert.Equal(t, "GET /api/events/:id", server.Name)
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID().String())
+	assert.True(t, server.Parent.IsRemote())
+	assert.Contains(t, server.Attributes, semconv.HTTPRoute("/api/events/:id"))
+	assert.Contains(t, server.Attributes, semconv.HTTPResponseStatusCode(200))
+
+	assert.Equal(t, "child", child.Name)
+	assert.Equal(t, server.SpanContext.SpanID(), child.Parent.SpanID())
+}
+
+func TestMiddlewareMarksServerErrors(t *testing.T) {
+	exp := setupInMemory()
+	app := setupTestApp()
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/fail", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 500, resp.StatusCode)
+
+	spans := exp.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.Contains(t, spans[0].Attributes, attribute.Int("http.response.status_code", 500))
+}
+
+func TestSetupRejectsUnknownExporter(t *testing.T) {
+	_, err := Setup(context.Background(), "zipkin")
+	assert.Error(t, err)
+
+	shutdown, err := Setup(context.Background(), ExporterNone)
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+}
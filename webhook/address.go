@@ -0,0 +1,105 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrInternalAddress is returned for deliveries to addresses that are not on
+// the public internet.
+var ErrInternalAddress = errors.New("webhook: address is not public")
+
+// internalNetworks are the ranges, besides those the net package knows to be
+// loopback, private, link-local or multicast, that are not publicly routed.
+var internalNetworks = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",      // this network
+		"100.64.0.0/10",  // carrier-grade NAT
+		"192.0.0.0/24",   // protocol assignments
+		"198.18.0.0/15",  // benchmarking
+		"240.0.0.0/4",    // reserved, and broadcast
+		"64:ff9b::/96",   // NAT64, which reaches any IPv4 address
+		"64:ff9b:1::/48", // local NAT64
+		"2001:db8::/32",  // documentation
+		"2002::/16",      // 6to4, which embeds an IPv4 address
+		"100::/64",       // discard
+		"2001::/32",      // Teredo, which embeds an IPv4 address
+		"fec0::/10",      // deprecated site-local
+	} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// PublicAddress reports whether ip is on the public internet, and so may be
+// sent webhook deliveries.
+func PublicAddress(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range internalNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// PublicHost reports whether host, the host of a webhook URL without its
+// port, may be public: a name other than localhost, or a public address.
+// Names are only checked for what they resolve to when delivered.
+func PublicHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		return PublicAddress(ip)
+	}
+	return true
+}
+
+// refuseInternal is a net.Dialer Control function that refuses connections
+// to addresses that are not public. It sees the address being dialed, after
+// the host has been resolved, so a name that resolved to a public address
+// when the webhook was registered and resolves to an internal one later is
+// refused too.
+func refuseInternal(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !PublicAddress(ip) {
+		return fmt.Errorf("%w: %s", ErrInternalAddress, host)
+	}
+	return nil
+}
+
+// newClient returns the client deliveries are sent with. Unless
+// allowInternal is set it only connects to public addresses, and it never
+// goes through a proxy, which would hide the address of the receiver.
+func newClient(timeout time.Duration, allowInternal bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if !allowInternal {
+		dialer.Control = refuseInternal
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
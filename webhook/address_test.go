@@ -0,0 +1,51 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublicAddress(t *testing.T) {
+	for _, addr := range []string{"93.184.215.14", "2606:4700::6810:84e5"} {
+		assert.True(t, PublicAddress(net.ParseIP(addr)), addr)
+	}
+	for _, addr := range []string{
+		"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1",
+		"0.0.0.0", "255.255.255.255", "::1", "fd00::1", "fe80::1", "::ffff:10.0.0.1", "64:ff9b::a00:1",
+	} {
+		assert.False(t, PublicAddress(net.ParseIP(addr)), addr)
+	}
+}
+
+func TestPublicHost(t *testing.T) {
+	assert.True(t, PublicHost("hooks.example.com"))
+	assert.True(t, PublicHost("93.184.215.14"))
+	assert.False(t, PublicHost("localhost"))
+	assert.False(t, PublicHost("api.localhost."))
+	assert.False(t, PublicHost("[::1]"))
+	assert.False(t, PublicHost("169.254.169.254"))
+}
+
+func TestClientRefusesInternalAddresses(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer receiver.Close()
+
+	// The check is made on the address dialed, whatever the URL names.
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, receiver.URL, nil)
+	require.NoError(t, err)
+	_, err = newClient(time.Second, false).Do(req)
+	assert.True(t, errors.Is(err, ErrInternalAddress), "got %v", err)
+
+	resp, err := newClient(time.Second, true).Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+}
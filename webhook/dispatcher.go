@@ -0,0 +1,323 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rsomcio/restapi/models"
+	"github.com/rsomcio/restapi/outbox"
+)
+
+// Store holds the webhooks and the record of their deliveries.
+type Store interface {
+	// Subscribers returns the enabled webhooks subscribed to eventType.
+	Subscribers(ctx context.Context, eventType string) ([]models.Webhook, error)
+	// Progress returns, by webhook ID, the attempts made so far to deliver
+	// the message with messageID.
+	Progress(ctx context.Context, messageID string) (map[string]Progress, error)
+	// RecordAttempt stores the outcome of one delivery attempt.
+	RecordAttempt(ctx context.Context, attempt models.WebhookDelivery) error
+	// RecordResult counts a message that was, or finally was not,
+	// delivered to the webhook. A run of disableAfter undelivered messages
+	// disables it, which RecordResult reports; zero never does.
+	RecordResult(ctx context.Context, webhookID string, delivered bool, disableAfter int) (disabled bool, err error)
+	// DeleteAttempts deletes the record of attempts made longer than age
+	// ago.
+	DeleteAttempts(ctx context.Context, age time.Duration) error
+}
+
+// Progress sums up the attempts to deliver a message to a webhook.
+type Progress struct {
+	Attempts  int       `db:"attempts"`
+	Delivered bool      `db:"delivered"`
+	Last      time.Time `db:"last"`
+}
+
+// Config configures a Dispatcher.
+type Config struct {
+	Store Store
+	// Client sends the deliveries. It defaults to a client with Timeout
+	// that only connects to public addresses, unless AllowInternal is set.
+	Client        *http.Client
+	Timeout       time.Duration
+	AllowInternal bool
+	// MaxAttempts is how many times a message is sent to a webhook before
+	// it is given up. Backoff is the delay before the first retry, doubled
+	// after each attempt up to BackoffMax.
+	MaxAttempts int
+	Backoff     time.Duration
+	BackoffMax  time.Duration
+	// DisableAfter is how many messages in a row a webhook may fail to
+	// accept before it is disabled. Zero never disables webhooks.
+	DisableAfter int
+	// Concurrency bounds the requests in flight.
+	Concurrency int
+	// Retention is how long the record of each attempt is kept. Zero keeps
+	// them.
+	Retention time.Duration
+	Logger    *slog.Logger
+}
+
+// cleanupInterval is how often attempts past Retention are deleted.
+const cleanupInterval = time.Minute
+
+// Dispatcher sends messages to the webhooks subscribed to them, as an
+// outbox sink: a message stays in the outbox, and is sent again, until every
+// webhook has accepted it or been given up.
+type Dispatcher struct {
+	cfg    Config
+	client *http.Client
+	logger *slog.Logger
+	slots  chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	mu     sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// New returns a Dispatcher. Unset numbers in cfg take usable defaults.
+func New(cfg Config) *Dispatcher {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 1
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = time.Second
+	}
+	if cfg.BackoffMax < cfg.Backoff {
+		cfg.BackoffMax = cfg.Backoff
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	client := cfg.Client
+	if client == nil {
+		client = newClient(cfg.Timeout, cfg.AllowInternal)
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		cfg:    cfg,
+		client: client,
+		logger: logger,
+		slots:  make(chan struct{}, cfg.Concurrency),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+var _ outbox.Sink = (*Dispatcher)(nil)
+
+// Start deletes attempts past Retention in the background until Close is
+// called.
+func (d *Dispatcher) Start() {
+	if d.cfg.Retention <= 0 {
+		return
+	}
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		ticker := time.NewTicker(cleanupInterval)
+		defer ticker.Stop()
+		for {
+			if err := d.cfg.Store.DeleteAttempts(d.ctx, d.cfg.Retention); err != nil && d.ctx.Err() == nil {
+				d.logger.Error("Failed to delete webhook deliveries", "error", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-d.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Send makes one attempt to deliver msg to each subscribed webhook that
+// has neither accepted it nor been given up, and whose backoff since its last
+// attempt has passed, and waits for them. It fails while any webhook may
+// still accept msg, so that the outbox sends it again later. Attempts are
+// recorded in the Store, so a later Send, by any instance, carries on where
+// this one stopped. A webhook is given up after MaxAttempts attempts.
+func (d *Dispatcher) Send(ctx context.Context, msg outbox.Message) error {
+	webhooks, err := d.cfg.Store.Subscribers(ctx, msg.Type)
+	if err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+	progress, err := d.cfg.Store.Progress(ctx, msg.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find webhook deliveries: %w", err)
+	}
+	m := Message{ID: msg.ID, Type: msg.Type, CreatedAt: msg.CreatedAt.UTC(), Data: msg.Event}
+	body, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook message: %w", err)
+	}
+
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return errors.New("webhook dispatcher is closed")
+	}
+	d.wg.Add(1)
+	d.mu.Unlock()
+	defer d.wg.Done()
+
+	var pending atomic.Int32
+	var wg sync.WaitGroup
+	for _, wh := range webhooks {
+		p := progress[wh.ID]
+		if p.Delivered || p.Attempts >= d.cfg.MaxAttempts {
+			continue
+		}
+		if p.Attempts > 0 && time.Since(p.Last) < d.backoff(p.Attempts) {
+			pending.Add(1)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !d.deliver(ctx, wh, m, body, p.Attempts+1) {
+				pending.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := pending.Load(); n > 0 {
+		return fmt.Errorf("%d of %d webhooks have not accepted the message yet", n, len(webhooks))
+	}
+	return nil
+}
+
+// Close stops sending and waits until the attempts in flight finish or ctx
+// is done. Messages not accepted yet stay in the outbox.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+	d.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("webhook deliveries did not finish: %w", ctx.Err())
+	}
+}
+
+// deliver makes the given attempt to send msg to wh and records it. It
+// reports whether wh is done with msg: it accepted it, or this was its last
+// attempt.
+func (d *Dispatcher) deliver(ctx context.Context, wh models.Webhook, msg Message, body []byte, attempt int) bool {
+	select {
+	case d.slots <- struct{}{}:
+	case <-ctx.Done():
+		return false
+	case <-d.ctx.Done():
+		return false
+	}
+	record := d.send(wh, msg, body)
+	<-d.slots
+
+	record.Attempt = attempt
+	if err := d.cfg.Store.RecordAttempt(context.Background(), record); err != nil {
+		d.logger.Error("Failed to record webhook delivery", "webhook_id", wh.ID, "message_id", msg.ID, "error", err)
+	}
+	if record.Delivered || attempt >= d.cfg.MaxAttempts {
+		d.finish(wh, msg, record.Delivered)
+		return true
+	}
+	return false
+}
+
+// backoff is the delay after the given number of failed attempts.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.cfg.Backoff
+	for i := 1; i < attempts && delay < d.cfg.BackoffMax; i++ {
+		delay *= 2
+	}
+	return min(delay, d.cfg.BackoffMax)
+}
+
+// send makes one delivery attempt. Any 2xx response accepts the message.
+func (d *Dispatcher) send(wh models.Webhook, msg Message, body []byte) models.WebhookDelivery {
+	record := models.WebhookDelivery{WebhookID: wh.ID, MessageID: msg.ID, EventType: msg.Type}
+	fail := func(err error) models.WebhookDelivery {
+		text := err.Error()
+		record.Error = &text
+		return record
+	}
+
+	// Close lets requests in flight finish, so they are not cancelled
+	// with d.ctx; nor with the outbox's ctx, so that an accepted message is
+	// recorded as such.
+	ctx, cancel := context.WithTimeout(context.Background(), d.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return fail(err)
+	}
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "restapi-webhooks/1")
+	req.Header.Set(IDHeader, msg.ID)
+	req.Header.Set(EventHeader, msg.Type)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(SignatureHeader, Sign(wh.Secret, now.Unix(), body))
+
+	resp, err := d.client.Do(req)
+	record.DurationMS = int(time.Since(now).Milliseconds())
+	if err != nil {
+		return fail(err)
+	}
+	// Drain a little of the body so the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	record.StatusCode = &resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fail(fmt.Errorf("unexpected status %d", resp.StatusCode))
+	}
+	record.Delivered = true
+	return record
+}
+
+func (d *Dispatcher) finish(wh models.Webhook, msg Message, delivered bool) {
+	logger := d.logger.With("webhook_id", wh.ID, "message_id", msg.ID, "type", msg.Type)
+	if !delivered {
+		logger.Warn("Gave up delivering webhook", "attempts", d.cfg.MaxAttempts)
+	}
+	disabled, err := d.cfg.Store.RecordResult(context.Background(), wh.ID, delivered, d.cfg.DisableAfter)
+	if err != nil {
+		logger.Error("Failed to record webhook result", "error", err)
+		return
+	}
+	if disabled {
+		logger.Warn("Disabled webhook after repeated failures", "failures", d.cfg.DisableAfter)
+	}
+}
@@ -0,0 +1,276 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rsomcio/restapi/models"
+	"github.com/rsomcio/restapi/outbox"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore is a Store over a fixed set of webhooks.
+type memoryStore struct {
+	mu       sync.Mutex
+	webhooks []models.Webhook
+	attempts []models.WebhookDelivery
+	results  chan bool
+}
+
+func newMemoryStore(webhooks ...models.Webhook) *memoryStore {
+	return &memoryStore{webhooks: webhooks, results: make(chan bool, 100)}
+}
+
+func (s *memoryStore) Subscribers(ctx context.Context, eventType string) ([]models.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var subscribed []models.Webhook
+	for _, wh := range s.webhooks {
+		if wh.Enabled && (len(wh.EventTypes) == 0 || slices.Contains(wh.EventTypes, eventType)) {
+			subscribed = append(subscribed, wh)
+		}
+	}
+	return subscribed, nil
+}
+
+func (s *memoryStore) Progress(ctx context.Context, messageID string) (map[string]Progress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	progress := map[string]Progress{}
+	for _, a := range s.attempts {
+		if a.MessageID == messageID {
+			p := progress[a.WebhookID]
+			p.Attempts++
+			p.Delivered = p.Delivered || a.Delivered
+			p.Last = a.CreatedAt
+			progress[a.WebhookID] = p
+		}
+	}
+	return progress, nil
+}
+
+func (s *memoryStore) RecordAttempt(ctx context.Context, a models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a.CreatedAt = time.Now()
+	s.attempts = append(s.attempts, a)
+	return nil
+}
+
+func (s *memoryStore) RecordResult(ctx context.Context, id string, delivered bool, disableAfter int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() { s.results <- delivered }()
+	for i := range s.webhooks {
+		wh := &s.webhooks[i]
+		if wh.ID != id {
+			continue
+		}
+		if delivered {
+			wh.ConsecutiveFailures = 0
+			return false, nil
+		}
+		wh.ConsecutiveFailures++
+		if disableAfter > 0 && wh.ConsecutiveFailures >= disableAfter && wh.Enabled {
+			wh.Enabled = false
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *memoryStore) DeleteAttempts(ctx context.Context, age time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts = slices.DeleteFunc(s.attempts, func(a models.WebhookDelivery) bool {
+		return time.Since(a.CreatedAt) > age
+	})
+	return nil
+}
+
+func (s *memoryStore) waitResult(t *testing.T) bool {
+	t.Helper()
+	select {
+	case delivered := <-s.results:
+		return delivered
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery finished")
+		return false
+	}
+}
+
+func testConfig(store Store) Config {
+	return Config{Store: store, AllowInternal: true, MaxAttempts: 3, Backoff: time.Millisecond, BackoffMax: 4 * time.Millisecond, DisableAfter: 2, Concurrency: 2}
+}
+
+// send sends a new message about event to d.
+func send(t *testing.T, d *Dispatcher, eventType string, event models.Event) outbox.Message {
+	t.Helper()
+	msg := outbox.Message{ID: uuid.NewString(), Type: eventType, Event: event, CreatedAt: time.Now()}
+	require.NoError(t, d.Send(context.Background(), msg))
+	return msg
+}
+
+// relay sends msg to d as the outbox does: again, after a pause, until d
+// accepts it.
+func relay(t *testing.T, d *Dispatcher, msg outbox.Message) {
+	t.Helper()
+	for sends := 1; ; sends++ {
+		if err := d.Send(context.Background(), msg); err == nil {
+			return
+		}
+		require.Less(t, sends, 20, "the message was never accepted")
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDeliverySignedAndFiltered(t *testing.T) {
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	deliveries := make(chan received, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- received{r.Header, body}
+	}))
+	defer receiver.Close()
+
+	store := newMemoryStore(
+		models.Webhook{ID: "all", URL: receiver.URL, Secret: "secret-one", Enabled: true},
+		models.Webhook{ID: "deletes", URL: receiver.URL + "/deletes", Secret: "secret-two", Enabled: true, EventTypes: []string{models.EventDeleted}},
+		models.Webhook{ID: "off", URL: receiver.URL + "/off", Secret: "secret-three"},
+	)
+	d := New(testConfig(store))
+
+	sent := send(t, d, models.EventCreated, models.Event{ID: "e1", Name: "Fair"})
+	assert.True(t, store.waitResult(t))
+
+	got := <-deliveries
+	assert.Equal(t, models.EventCreated, got.header.Get(EventHeader))
+	assert.NoError(t, Verify("secret-one", got.header.Get(SignatureHeader), got.header.Get(TimestampHeader), got.body, time.Minute))
+	assert.Error(t, Verify("secret-two", got.header.Get(SignatureHeader), got.header.Get(TimestampHeader), got.body, time.Minute))
+
+	var msg Message
+	require.NoError(t, json.Unmarshal(got.body, &msg))
+	assert.Equal(t, sent.ID, msg.ID, "the message keeps its outbox ID")
+	assert.Equal(t, got.header.Get(IDHeader), msg.ID)
+	assert.Equal(t, models.EventCreated, msg.Type)
+	assert.Equal(t, "Fair", msg.Data.Name)
+
+	require.NoError(t, d.Close(context.Background()))
+	assert.Empty(t, deliveries, "only subscribed, enabled webhooks are sent the message")
+	assert.Len(t, store.attempts, 1)
+
+	err := d.Send(context.Background(), outbox.Message{ID: uuid.NewString(), Type: models.EventCreated})
+	assert.EqualError(t, err, "webhook dispatcher is closed", "the outbox keeps messages sent after Close")
+}
+
+func TestDeliveryRetriesAndDisables(t *testing.T) {
+	var calls atomic.Int32
+	var fail atomic.Bool
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 || fail.Load() {
+			w.WriteHeader(503)
+		}
+	}))
+	defer receiver.Close()
+
+	store := newMemoryStore(models.Webhook{ID: "wh", URL: receiver.URL, Secret: "s", Enabled: true})
+	d := New(testConfig(store))
+	defer d.Close(context.Background())
+
+	msg := outbox.Message{ID: uuid.NewString(), Type: models.EventUpdated, Event: models.Event{ID: "e1"}, CreatedAt: time.Now()}
+	err := d.Send(context.Background(), msg)
+	assert.EqualError(t, err, "1 of 1 webhooks have not accepted the message yet", "the outbox keeps a message until it is accepted")
+	relay(t, d, msg)
+	assert.True(t, store.waitResult(t))
+	store.mu.Lock()
+	require.Len(t, store.attempts, 2)
+	assert.Equal(t, 503, *store.attempts[0].StatusCode)
+	assert.Equal(t, "unexpected status 503", *store.attempts[0].Error)
+	assert.Equal(t, []int{1, 2}, []int{store.attempts[0].Attempt, store.attempts[1].Attempt})
+	assert.Equal(t, store.attempts[0].MessageID, store.attempts[1].MessageID, "retries resend the same message")
+	assert.True(t, store.attempts[1].Delivered)
+	store.mu.Unlock()
+
+	require.NoError(t, d.Send(context.Background(), msg))
+	assert.Equal(t, int32(2), calls.Load(), "an accepted message is not sent again")
+
+	fail.Store(true)
+	for i := 0; i < 2; i++ {
+		relay(t, d, outbox.Message{ID: uuid.NewString(), Type: models.EventUpdated, Event: models.Event{ID: "e1"}})
+		assert.False(t, store.waitResult(t))
+	}
+
+	store.mu.Lock()
+	assert.Len(t, store.attempts, 2+3+3, "each message is attempted MaxAttempts times")
+	assert.False(t, store.webhooks[0].Enabled, "the webhook is disabled after DisableAfter failed messages")
+	store.mu.Unlock()
+}
+
+func TestDeliveryResumesWithoutRepeats(t *testing.T) {
+	var good, flaky atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/good" {
+			good.Add(1)
+			return
+		}
+		if flaky.Add(1) == 1 {
+			w.WriteHeader(503)
+		}
+	}))
+	defer receiver.Close()
+
+	store := newMemoryStore(
+		models.Webhook{ID: "good", URL: receiver.URL + "/good", Secret: "s", Enabled: true},
+		models.Webhook{ID: "flaky", URL: receiver.URL + "/flaky", Secret: "s", Enabled: true},
+	)
+	msg := outbox.Message{ID: uuid.NewString(), Type: models.EventCreated, Event: models.Event{ID: "e1"}, CreatedAt: time.Now()}
+	require.Error(t, New(testConfig(store)).Send(context.Background(), msg))
+
+	// Another instance, as after a restart, carries on from the record.
+	d := New(testConfig(store))
+	defer d.Close(context.Background())
+	relay(t, d, msg)
+	assert.Equal(t, int32(1), good.Load(), "a webhook that accepted the message is not sent it again")
+	assert.Equal(t, int32(2), flaky.Load())
+}
+
+func TestDeliveryRetention(t *testing.T) {
+	store := newMemoryStore()
+	store.attempts = []models.WebhookDelivery{
+		{MessageID: "old", CreatedAt: time.Now().Add(-2 * time.Hour)},
+		{MessageID: "new", CreatedAt: time.Now()},
+	}
+	cfg := testConfig(store)
+	cfg.Retention = time.Hour
+	d := New(cfg)
+	d.Start()
+	require.NoError(t, d.Close(context.Background()))
+
+	require.Len(t, store.attempts, 1)
+	assert.Equal(t, "new", store.attempts[0].MessageID)
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	now := time.Now().Unix()
+	sig := Sign("secret", now, body)
+
+	assert.NoError(t, Verify("secret", sig, strconv.FormatInt(now, 10), body, time.Minute))
+	assert.EqualError(t, Verify("secret", sig, strconv.FormatInt(now, 10), []byte(`{"id":"2"}`), time.Minute), "webhook: signature mismatch")
+	assert.EqualError(t, Verify("secret", Sign("secret", now-600, body), strconv.FormatInt(now-600, 10), body, time.Minute), "webhook: timestamp outside tolerance")
+	assert.EqualError(t, Verify("secret", sig, "soon", body, time.Minute), "webhook: invalid timestamp")
+}
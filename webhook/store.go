@@ -0,0 +1,89 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rsomcio/restapi/database"
+	"github.com/rsomcio/restapi/models"
+)
+
+// DatabaseStore is the Store backed by the webhooks and webhook_deliveries
+// tables.
+type DatabaseStore struct{}
+
+var _ Store = DatabaseStore{}
+
+func (DatabaseStore) Subscribers(ctx context.Context, eventType string) ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	query := `
+		SELECT id, url, event_types, secret, enabled, consecutive_failures, disabled_at, created_at, updated_at
+		FROM webhooks
+		WHERE enabled AND (cardinality(event_types) = 0 OR $1 = ANY(event_types))`
+	if err := database.DB.SelectContext(ctx, &webhooks, query, eventType); err != nil {
+		return nil, fmt.Errorf("failed to find webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+func (DatabaseStore) Progress(ctx context.Context, messageID string) (map[string]Progress, error) {
+	var rows []struct {
+		WebhookID string `db:"webhook_id"`
+		Progress
+	}
+	query := `
+		SELECT webhook_id, count(*) AS attempts, bool_or(delivered) AS delivered, max(created_at) AS last
+		FROM webhook_deliveries
+		WHERE message_id = $1
+		GROUP BY webhook_id`
+	if err := database.DB.SelectContext(ctx, &rows, query, messageID); err != nil {
+		return nil, err
+	}
+	progress := make(map[string]Progress, len(rows))
+	for _, row := range rows {
+		progress[row.WebhookID] = row.Progress
+	}
+	return progress, nil
+}
+
+func (DatabaseStore) RecordAttempt(ctx context.Context, a models.WebhookDelivery) error {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, message_id, event_type, attempt, status_code, error, duration_ms, delivered)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err := database.DB.ExecContext(ctx, query, a.WebhookID, a.MessageID, a.EventType, a.Attempt, a.StatusCode, a.Error, a.DurationMS, a.Delivered)
+	return err
+}
+
+func (DatabaseStore) RecordResult(ctx context.Context, webhookID string, delivered bool, disableAfter int) (bool, error) {
+	// The right-hand sides see the row as it was before the update.
+	query := `
+		UPDATE webhooks SET
+			consecutive_failures = CASE WHEN $2 THEN 0 ELSE consecutive_failures + 1 END,
+			enabled = enabled AND ($2 OR $3 = 0 OR consecutive_failures + 1 < $3),
+			disabled_at = CASE WHEN enabled AND NOT $2 AND $3 > 0 AND consecutive_failures + 1 >= $3
+				THEN CURRENT_TIMESTAMP ELSE disabled_at END
+		WHERE id = $1
+		RETURNING enabled, consecutive_failures`
+
+	var result struct {
+		Enabled  bool `db:"enabled"`
+		Failures int  `db:"consecutive_failures"`
+	}
+	err := database.DB.GetContext(ctx, &result, query, webhookID, delivered, disableAfter)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil // deleted while its message was being delivered
+	}
+	if err != nil {
+		return false, err
+	}
+	return !result.Enabled && disableAfter > 0 && result.Failures == disableAfter, nil
+}
+
+func (DatabaseStore) DeleteAttempts(ctx context.Context, age time.Duration) error {
+	_, err := database.DB.ExecContext(ctx,
+		"DELETE FROM webhook_deliveries WHERE created_at < CURRENT_TIMESTAMP - $1 * INTERVAL '1 millisecond'", age.Milliseconds())
+	return err
+}
@@ -0,0 +1,60 @@
+// Package webhook delivers signed notifications of event changes to the
+// endpoints registered under /api/webhooks.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rsomcio/restapi/models"
+)
+
+// Headers sent with every delivery. The signature is
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)), where the
+// timestamp is the value of TimestampHeader in Unix seconds.
+const (
+	IDHeader        = "X-Webhook-ID"
+	EventHeader     = "X-Webhook-Event"
+	TimestampHeader = "X-Webhook-Timestamp"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+// Message is the JSON body of a delivery. Retries of a message keep its ID,
+// so receivers can discard duplicates.
+type Message struct {
+	ID        string       `json:"id"`
+	Type      string       `json:"type"`
+	CreatedAt time.Time    `json:"created_at"`
+	Data      models.Event `json:"data"`
+}
+
+// Sign returns the SignatureHeader value for body sent at timestamp.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and timestamp headers of a delivery, for
+// receivers written in Go. Deliveries older than tolerance are rejected to
+// prevent replays.
+func Verify(secret, signature, timestamp string, body []byte, tolerance time.Duration) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("webhook: invalid timestamp")
+	}
+	if age := time.Since(time.Unix(ts, 0)); age > tolerance || age < -tolerance {
+		return errors.New("webhook: timestamp outside tolerance")
+	}
+	if !strings.HasPrefix(signature, "sha256=") || !hmac.Equal([]byte(signature), []byte(Sign(secret, ts, body))) {
+		return errors.New("webhook: signature mismatch")
+	}
+	return nil
+}